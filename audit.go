@@ -0,0 +1,198 @@
+package fastotp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// AuditOperation is the operation an AuditRecord describes.
+type AuditOperation string
+
+const (
+	// AuditGenerate records GenerateOTP and first sends of GenerateForPurpose.
+	AuditGenerate AuditOperation = "generate"
+	// AuditResend records GenerateForPurpose sending again to an identifier
+	// with a pending OTP.
+	AuditResend AuditOperation = "resend"
+	// AuditValidate records ValidateOTP and ValidateForPurpose.
+	AuditValidate AuditOperation = "validate"
+	// AuditGet records GetOtp.
+	AuditGet AuditOperation = "get"
+	// AuditCancel records CancelOTP.
+	AuditCancel AuditOperation = "cancel"
+)
+
+// AuditOutcome is whether an audited operation succeeded.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditRecord describes one operation. It never holds the token, and holds
+// the identifier only as a hash.
+type AuditRecord struct {
+	Time      time.Time      `json:"time"`
+	Operation AuditOperation `json:"operation"`
+	Outcome   AuditOutcome   `json:"outcome"`
+	// ErrorClass is a coarse category of the failure, such as "rejected",
+	// "rate_limited", "policy", "server", "timeout" or "transport".
+	ErrorClass string `json:"error_class,omitempty"`
+
+	Actor    string `json:"actor,omitempty"`
+	ClientIP string `json:"client_ip,omitempty"`
+
+	// IdentifierHash is the hex HMAC-SHA256 of the identifier under the key
+	// set with WithAuditKey, or its plain SHA-256 without one.
+	IdentifierHash string `json:"identifier_hash,omitempty"`
+	Purpose        string `json:"purpose,omitempty"`
+	OTPID          string `json:"otp_id,omitempty"`
+}
+
+// AuditSink receives audit records. It is called synchronously, so slow
+// sinks should hand records off.
+type AuditSink interface {
+	Audit(ctx context.Context, record AuditRecord)
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(ctx context.Context, record AuditRecord)
+
+// Audit calls f(ctx, record).
+func (f AuditFunc) Audit(ctx context.Context, record AuditRecord) {
+	f(ctx, record)
+}
+
+// WithAuditSink sends an AuditRecord for every operation to sink. It may be
+// given more than once to feed several sinks.
+func WithAuditSink(sink AuditSink) Option {
+	return func(f *FastOTP) {
+		f.auditSinks = append(f.auditSinks, sink)
+	}
+}
+
+// WithAuditKey keys the identifier hashes of audit records, so they cannot
+// be reversed by hashing candidate emails or phone numbers.
+func WithAuditKey(key []byte) Option {
+	return func(f *FastOTP) {
+		f.auditKey = key
+	}
+}
+
+type auditContextKey int
+
+const (
+	actorKey auditContextKey = iota
+	clientIPKey
+)
+
+// WithActor returns a copy of ctx carrying the actor recorded in audit
+// records, such as the signed in user or the calling service.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// WithClientIP returns a copy of ctx carrying the IP address of the client
+// the operation is made for.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIPFromContext returns the client IP carried by ctx.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+func (f *FastOTP) audit(ctx context.Context, operation AuditOperation, purpose, identifier, id string, err error) {
+	if len(f.auditSinks) == 0 {
+		return
+	}
+
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Outcome:   AuditSuccess,
+		Actor:     ActorFromContext(ctx),
+		ClientIP:  ClientIPFromContext(ctx),
+		Purpose:   purpose,
+		OTPID:     id,
+	}
+	if identifier != "" {
+		record.IdentifierHash = f.hashIdentifier(identifier)
+	}
+	if err != nil {
+		record.Outcome = AuditFailure
+		record.ErrorClass = errorClass(err)
+	}
+
+	for _, sink := range f.auditSinks {
+		sink.Audit(ctx, record)
+	}
+}
+
+func (f *FastOTP) hashIdentifier(identifier string) string {
+	if f.auditKey == nil {
+		sum := sha256.Sum256([]byte(identifier))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, f.auditKey)
+	mac.Write([]byte(identifier))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func otpID(otp *OTP) string {
+	if otp == nil {
+		return ""
+	}
+	return otp.ID
+}
+
+// errorClass sorts err into the categories of AuditRecord.ErrorClass.
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrResendCooldown), errors.Is(err, ErrMaxResends), errors.Is(err, ErrMaxAttempts):
+		return "policy"
+	case errors.Is(err, ErrPurposeMismatch), errors.Is(err, ErrOTPCancelled):
+		return "rejected"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "transport"
+	}
+
+	if apiErr, ok := AsAPIError(err); ok {
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			return "unauthorized"
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return "rate_limited"
+		case apiErr.IsClientError():
+			return "rejected"
+		default:
+			return "server"
+		}
+	}
+	return "internal"
+}
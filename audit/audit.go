@@ -0,0 +1,56 @@
+// Package audit provides sinks for the audit records of fastotp.FastOTP:
+//
+//	file, err := audit.OpenFile("/var/log/fastotp/audit.jsonl", audit.WithMaxSize(50<<20))
+//	client := fastotp.NewFastOTP(apiKey,
+//		fastotp.WithAuditSink(file),
+//		fastotp.WithAuditSink(audit.NewSlogSink(slog.Default())),
+//		fastotp.WithAuditKey(auditKey))
+//
+// Any other destination can be used by implementing fastotp.AuditSink.
+package audit
+
+import (
+	"context"
+	"log/slog"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// SlogSink writes audit records to a slog.Logger.
+type SlogSink struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogSink creates a new SlogSink logging to logger at Info level.
+func NewSlogSink(logger *slog.Logger) *SlogSink {
+	return &SlogSink{logger: logger, level: slog.LevelInfo}
+}
+
+// WithLevel returns a copy of s logging at level.
+func (s *SlogSink) WithLevel(level slog.Level) *SlogSink {
+	c := *s
+	c.level = level
+	return &c
+}
+
+// Audit implements fastotp.AuditSink.
+func (s *SlogSink) Audit(ctx context.Context, record fastotp.AuditRecord) {
+	attrs := []slog.Attr{
+		slog.String("operation", string(record.Operation)),
+		slog.String("outcome", string(record.Outcome)),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, slog.String(key, value))
+		}
+	}
+	add("error_class", record.ErrorClass)
+	add("actor", record.Actor)
+	add("client_ip", record.ClientIP)
+	add("identifier_hash", record.IdentifierHash)
+	add("purpose", record.Purpose)
+	add("otp_id", record.OTPID)
+
+	s.logger.LogAttrs(ctx, s.level, "fastotp audit", attrs...)
+}
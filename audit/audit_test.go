@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ fastotp.AuditSink = (*File)(nil)
+var _ fastotp.AuditSink = (*SlogSink)(nil)
+
+func newRecord(id string) fastotp.AuditRecord {
+	return fastotp.AuditRecord{
+		Time:           time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC),
+		Operation:      fastotp.AuditValidate,
+		Outcome:        fastotp.AuditFailure,
+		ErrorClass:     "rejected",
+		Actor:          "user-1",
+		ClientIP:       "203.0.113.9",
+		IdentifierHash: "abc",
+		OTPID:          id,
+	}
+}
+
+func readRecords(t *testing.T, path string) []fastotp.AuditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []fastotp.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r fastotp.AuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	f, err := OpenFile(path)
+	require.NoError(t, err)
+
+	f.Audit(context.Background(), newRecord("otp-1"))
+	f.Audit(context.Background(), newRecord("otp-2"))
+	require.NoError(t, f.Close())
+
+	// reopening appends
+	f, err = OpenFile(path)
+	require.NoError(t, err)
+	f.Audit(context.Background(), newRecord("otp-3"))
+	require.NoError(t, f.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, newRecord("otp-1"), records[0])
+	assert.Equal(t, "otp-3", records[2].OTPID)
+}
+
+func TestFile_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	line, err := json.Marshal(newRecord("otp-0"))
+	require.NoError(t, err)
+
+	// room for two records per file
+	f, err := OpenFile(path, WithMaxSize(int64(2*(len(line)+1))), WithMaxBackups(2))
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, id := range []string{"otp-0", "otp-1", "otp-2", "otp-3", "otp-4", "otp-5", "otp-6"} {
+		f.Audit(context.Background(), newRecord(id))
+	}
+
+	ids := func(path string) []string {
+		var out []string
+		for _, r := range readRecords(t, path) {
+			out = append(out, r.OTPID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"otp-6"}, ids(path))
+	assert.Equal(t, []string{"otp-4", "otp-5"}, ids(path+".1"))
+	assert.Equal(t, []string{"otp-2", "otp-3"}, ids(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, f.Rotate())
+	assert.Empty(t, ids(path))
+	assert.Equal(t, []string{"otp-6"}, ids(path+".1"))
+}
+
+func TestFile_FailedRotationKeepsWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var errs []error
+	f, err := OpenFile(path, WithMaxSize(1), WithMaxBackups(2), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	require.NoError(t, err)
+	defer f.Close()
+
+	// path.1 cannot be shifted onto a non-empty directory
+	require.NoError(t, os.WriteFile(path+".1", nil, 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".2", "taken"), 0o700))
+
+	f.Audit(context.Background(), newRecord("otp-1"))
+	f.Audit(context.Background(), newRecord("otp-2"))
+	assert.Len(t, errs, 1)
+	assert.Error(t, f.Rotate())
+
+	var ids []string
+	for _, r := range readRecords(t, path) {
+		ids = append(ids, r.OTPID)
+	}
+	assert.Equal(t, []string{"otp-1", "otp-2"}, ids)
+}
+
+func TestFile_ErrorsAfterClose(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	f, err := OpenFile(filepath.Join(t.TempDir(), "audit.jsonl"), WithErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f.Audit(context.Background(), newRecord("otp-1"))
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], os.ErrClosed)
+
+	// rotating does not reopen the file
+	assert.ErrorIs(t, f.Rotate(), os.ErrClosed)
+	_, err = os.Stat(f.path + ".1")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSlogSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewSlogSink(slog.New(slog.NewJSONHandler(&buf, nil))).WithLevel(slog.LevelWarn)
+
+	record := newRecord("otp-1")
+	record.Purpose = ""
+	sink.Audit(context.Background(), record)
+
+	var logged map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	assert.Equal(t, "WARN", logged["level"])
+	assert.Equal(t, "fastotp audit", logged["msg"])
+	assert.Equal(t, "validate", logged["operation"])
+	assert.Equal(t, "failure", logged["outcome"])
+	assert.Equal(t, "rejected", logged["error_class"])
+	assert.Equal(t, "otp-1", logged["otp_id"])
+	assert.NotContains(t, logged, "purpose")
+}
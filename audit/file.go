@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 5
+)
+
+// FileOption configures a File.
+type FileOption func(*File)
+
+// WithMaxSize rotates the file once writing a record would take it past n
+// bytes. Defaults to 100 MiB; 0 disables rotation by size.
+func WithMaxSize(n int64) FileOption {
+	return func(f *File) {
+		f.maxSize = n
+	}
+}
+
+// WithMaxBackups keeps n rotated files, named path.1 (the newest) to path.n.
+// Defaults to 5.
+func WithMaxBackups(n int) FileOption {
+	return func(f *File) {
+		f.maxBackups = n
+	}
+}
+
+// WithErrorHandler calls fn with write and rotation errors, which are logged
+// with the standard logger by default. Records that fail are dropped.
+func WithErrorHandler(fn func(error)) FileOption {
+	return func(f *File) {
+		f.onError = fn
+	}
+}
+
+// File is a fastotp.AuditSink appending one JSON record per line to a file,
+// rotating it by size.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	onError    func(error)
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenFile opens the file at path for appending, creating it if needed.
+func OpenFile(path string, opts ...FileOption) (*File, error) {
+	f := &File{
+		path:       path,
+		maxSize:    defaultMaxSize,
+		maxBackups: defaultMaxBackups,
+		onError: func(err error) {
+			log.Printf("fastotp audit: %v", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	file, size, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	f.size = size
+	return f, nil
+}
+
+func openAppend(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// Audit implements fastotp.AuditSink.
+func (f *File) Audit(_ context.Context, record fastotp.AuditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		f.onError(err)
+		return
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		f.onError(fmt.Errorf("write %s: %w", f.path, os.ErrClosed))
+		return
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		// on failure the record still goes to the current file
+		if err := f.rotate(); err != nil {
+			f.onError(err)
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		f.onError(err)
+	}
+}
+
+// Rotate starts a new file, for example on SIGHUP. It fails with
+// os.ErrClosed once the File is closed.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return fmt.Errorf("rotate %s: %w", f.path, os.ErrClosed)
+	}
+	return f.rotate()
+}
+
+// rotate shifts path.i to path.i+1, dropping the oldest, moves the current
+// file to path.1 and opens a new one. The current file is only closed once
+// the new one is open, so that a failed rotation leaves records going to it.
+func (f *File) rotate() error {
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, size, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		f.onError(err)
+	}
+	f.file = file
+	f.size = size
+	return nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,134 @@
+package fastotp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestAudit(t *testing.T) {
+	var records []AuditRecord
+	key := []byte("audit-key")
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithAuditKey(key),
+		WithAuditSink(AuditFunc(func(ctx context.Context, record AuditRecord) {
+			records = append(records, record)
+		})),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				if p, ok := payload.(ValidateOTPPayload); ok && p.Token != "123456" {
+					return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "Invalid or expired token."})
+				}
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Identifier: "user@example.com"}})
+			},
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		}),
+	)
+
+	ctx := WithClientIP(WithActor(context.Background(), "support-agent-7"), "203.0.113.9")
+	_, err := fastOtp.GenerateOTP(ctx, GenerateOTPPayload{Identifier: "user@example.com"})
+	require.NoError(t, err)
+	_, err = fastOtp.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "user@example.com", Token: "654321"})
+	require.Error(t, err)
+	_, err = fastOtp.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "user@example.com", Token: "123456"})
+	require.NoError(t, err)
+	_, err = fastOtp.GetOtp(context.Background(), "otp-1")
+	require.Error(t, err)
+	_, err = fastOtp.CancelOTP(context.Background(), "otp-1")
+	require.Error(t, err)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("user@example.com"))
+	hash := hex.EncodeToString(mac.Sum(nil))
+
+	require.Len(t, records, 5)
+	for _, r := range records[:3] {
+		assert.Equal(t, "support-agent-7", r.Actor)
+		assert.Equal(t, "203.0.113.9", r.ClientIP)
+		assert.Equal(t, hash, r.IdentifierHash)
+		assert.WithinDuration(t, time.Now(), r.Time, time.Minute)
+	}
+
+	assert.Equal(t, AuditGenerate, records[0].Operation)
+	assert.Equal(t, AuditSuccess, records[0].Outcome)
+	assert.Equal(t, "otp-1", records[0].OTPID)
+
+	assert.Equal(t, AuditValidate, records[1].Operation)
+	assert.Equal(t, AuditFailure, records[1].Outcome)
+	assert.Equal(t, "rejected", records[1].ErrorClass)
+
+	assert.Equal(t, AuditSuccess, records[2].Outcome)
+
+	assert.Equal(t, AuditGet, records[3].Operation)
+	assert.Equal(t, "otp-1", records[3].OTPID)
+	assert.Equal(t, "internal", records[3].ErrorClass)
+	assert.Empty(t, records[3].IdentifierHash)
+
+	assert.Equal(t, AuditCancel, records[4].Operation)
+	assert.Equal(t, "otp-1", records[4].OTPID)
+	assert.Equal(t, AuditFailure, records[4].Outcome)
+
+	// neither the token nor the identifier ever reach a sink
+	b, err := json.Marshal(records)
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(string(b), "123456"))
+	assert.False(t, strings.Contains(string(b), "654321"))
+	assert.False(t, strings.Contains(string(b), "user@example.com"))
+}
+
+func TestAudit_Resend(t *testing.T) {
+	var records []AuditRecord
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPolicy("login", Policy{Type: OTPTypeNumeric, TokenLength: 6, Validity: 300, Cooldown: time.Minute}),
+		WithAuditSink(AuditFunc(func(ctx context.Context, record AuditRecord) {
+			records = append(records, record)
+		})),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Identifier: "login:user123"}})
+			},
+		}),
+	)
+	fastOtp.tracker.now = func() time.Time { return now }
+
+	delivery := OTPDelivery{"email": "test@example.com"}
+	_, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.Error(t, err)
+	now = now.Add(time.Minute)
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("user123"))
+	require.Len(t, records, 3)
+	assert.Equal(t, AuditGenerate, records[0].Operation)
+	assert.Equal(t, "login", records[0].Purpose)
+	assert.Equal(t, hex.EncodeToString(sum[:]), records[0].IdentifierHash)
+	assert.Equal(t, AuditResend, records[1].Operation)
+	assert.Equal(t, "policy", records[1].ErrorClass)
+	assert.Equal(t, AuditResend, records[2].Operation)
+	assert.Equal(t, AuditSuccess, records[2].Outcome)
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "timeout", errorClass(context.DeadlineExceeded))
+	assert.Equal(t, "circuit_open", errorClass(ErrCircuitOpen))
+	assert.Equal(t, "unauthorized", errorClass(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.Equal(t, "rate_limited", errorClass(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.Equal(t, "server", errorClass(&APIError{StatusCode: http.StatusBadGateway}))
+}
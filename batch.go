@@ -0,0 +1,137 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const defaultBatchConcurrency = 4
+
+// ErrBatchAborted is the error recorded for batch items that were not sent
+// because an earlier item failed with BatchOptions.FailFast set.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// Limiter throttles outgoing requests. *rate.Limiter from
+// golang.org/x/time/rate satisfies it.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// BatchOptions configures GenerateOTPBatch and ValidateOTPBatch.
+type BatchOptions struct {
+	// Concurrency is the maximum number of requests in flight. Defaults to 4.
+	Concurrency int
+	// FailFast stops sending new requests after the first failed item.
+	FailFast bool
+	// Limiter, if set, is waited on before every request.
+	Limiter Limiter
+	// OnProgress, if set, is called after each item completes with the number
+	// of completed items. Calls are never concurrent.
+	OnProgress func(done, total int)
+}
+
+// BatchResult is the outcome of one item of a batch.
+type BatchResult struct {
+	OTP *OTP
+	Err error
+}
+
+// GenerateOTPBatch generates an OTP for every payload using a bounded pool of
+// workers. Results are in the same order as payloads. The returned error is
+// the first item error when opts.FailFast is set, or the context error if
+// ctx ends before the batch completes.
+func (f *FastOTP) GenerateOTPBatch(ctx context.Context, payloads []GenerateOTPPayload, opts BatchOptions) ([]BatchResult, error) {
+	return runBatch(ctx, len(payloads), opts, func(ctx context.Context, i int) (*OTP, error) {
+		return f.GenerateOTP(ctx, payloads[i])
+	})
+}
+
+// ValidateOTPBatch validates every payload using a bounded pool of workers.
+// It reports results the same way as GenerateOTPBatch.
+func (f *FastOTP) ValidateOTPBatch(ctx context.Context, payloads []ValidateOTPPayload, opts BatchOptions) ([]BatchResult, error) {
+	return runBatch(ctx, len(payloads), opts, func(ctx context.Context, i int) (*OTP, error) {
+		return f.ValidateOTP(ctx, payloads[i])
+	})
+}
+
+func runBatch(ctx context.Context, total int, opts BatchOptions, call func(ctx context.Context, i int) (*OTP, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, total)
+	if total == 0 {
+		return results, nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > total {
+		concurrency = total
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		done     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	jobs := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var result BatchResult
+				if opts.Limiter != nil {
+					result.Err = opts.Limiter.Wait(batchCtx)
+				}
+				if result.Err == nil {
+					result.OTP, result.Err = call(batchCtx, i)
+				}
+
+				mu.Lock()
+				results[i] = result
+				done++
+				if result.Err != nil && opts.FailFast && firstErr == nil {
+					firstErr = result.Err
+					cancel()
+				}
+				if opts.OnProgress != nil {
+					opts.OnProgress(done, total)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	next := 0
+	for ; next < total; next++ {
+		select {
+		case jobs <- next:
+			continue
+		case <-batchCtx.Done():
+		}
+		break
+	}
+	close(jobs)
+	wg.Wait()
+
+	if next < total {
+		reason := ErrBatchAborted
+		if firstErr == nil {
+			reason = ctx.Err()
+		}
+		for i := next; i < total; i++ {
+			results[i].Err = reason
+		}
+	}
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	return results, ctx.Err()
+}
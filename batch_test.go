@@ -0,0 +1,144 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+type countingLimiter struct {
+	calls int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.calls, 1)
+	return ctx.Err()
+}
+
+func batchPayloads(identifiers ...string) []GenerateOTPPayload {
+	payloads := make([]GenerateOTPPayload, len(identifiers))
+	for i, identifier := range identifiers {
+		payloads[i] = GenerateOTPPayload{
+			Delivery:    OTPDelivery{"email": "test@example.com"},
+			Identifier:  identifier,
+			TokenLength: 6,
+			Type:        OTPTypeNumeric,
+			Validity:    120,
+		}
+	}
+	return payloads
+}
+
+func TestGenerateOTPBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			p := payload.(GenerateOTPPayload)
+			if p.Identifier == "bad" {
+				return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "invalid identifier"})
+			}
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier}})
+		},
+	}))
+
+	var (
+		mu       sync.Mutex
+		progress []int
+	)
+	limiter := &countingLimiter{}
+	results, err := fastOtp.GenerateOTPBatch(context.TODO(), batchPayloads("a", "b", "bad", "d", "e", "f"), BatchOptions{
+		Concurrency: 2,
+		Limiter:     limiter,
+		OnProgress: func(done, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, 6, total)
+			progress = append(progress, done)
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 6)
+
+	for i, identifier := range []string{"a", "b", "bad", "d", "e", "f"} {
+		if identifier == "bad" {
+			assert.Nil(t, results[i].OTP)
+			assert.ErrorContains(t, results[i].Err, "invalid identifier")
+			continue
+		}
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, identifier, results[i].OTP.Identifier)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, progress)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&limiter.calls))
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+}
+
+func TestGenerateOTPBatch_FailFast(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			if payload.(GenerateOTPPayload).Identifier == "a" {
+				return nil, errors.New("some error")
+			}
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{})
+		},
+	}))
+
+	results, err := fastOtp.GenerateOTPBatch(context.TODO(), batchPayloads("a", "b", "c", "d"), BatchOptions{
+		Concurrency: 1,
+		FailFast:    true,
+	})
+	require.EqualError(t, err, "some error")
+	require.Len(t, results, 4)
+	assert.EqualError(t, results[0].Err, "some error")
+	assert.ErrorIs(t, results[3].Err, ErrBatchAborted)
+}
+
+func TestValidateOTPBatch(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			assert.Equal(t, "/validate", endpoint)
+			p := payload.(ValidateOTPPayload)
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier, Status: OTPStatusValidated}})
+		},
+	}))
+
+	results, err := fastOtp.ValidateOTPBatch(context.TODO(), []ValidateOTPPayload{
+		{Identifier: "a", Token: "123456"},
+		{Identifier: "b", Token: "654321"},
+	}, BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", results[0].OTP.Identifier)
+	assert.Equal(t, "b", results[1].OTP.Identifier)
+	assert.Equal(t, OTPStatusValidated, results[1].OTP.Status)
+}
+
+func TestGenerateOTPBatch_ContextCancelled(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := fastOtp.GenerateOTPBatch(ctx, batchPayloads("a", "b"), BatchOptions{Limiter: &countingLimiter{}})
+	assert.ErrorIs(t, err, context.Canceled)
+	for _, result := range results {
+		assert.ErrorIs(t, result.Err, context.Canceled)
+	}
+}
@@ -0,0 +1,237 @@
+package fastotp
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// flightTimeout bounds a GetOtp request shared by coalesced callers, which
+// runs detached from their contexts.
+const flightTimeout = 30 * time.Second
+
+// Cache stores OTPs by ID to serve GetOtp. Implementations backed by a shared
+// store let several processes share lookups, and must be safe for
+// concurrent use.
+type Cache interface {
+	// Get returns the cached OTP for id, if any.
+	Get(ctx context.Context, id string) (*OTP, bool)
+	// Set stores otp under its ID for at most ttl.
+	Set(ctx context.Context, otp *OTP, ttl time.Duration)
+	// Delete removes the OTP with id from the cache.
+	Delete(ctx context.Context, id string)
+}
+
+// CacheStats reports how GetOtp calls were served by the cache.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// WithCache serves GetOtp from cache, keeping entries for at most ttl and
+// never beyond the OTP's ExpiresAt. Concurrent misses for the same ID share
+// a single API request, and ValidateOTP results update the cached entry.
+func WithCache(cache Cache, ttl time.Duration) Option {
+	return func(f *FastOTP) {
+		f.cache = cache
+		f.cacheTTL = ttl
+	}
+}
+
+// CacheStats returns the hit and miss counts of the GetOtp cache.
+func (f *FastOTP) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&f.cacheHits),
+		Misses: atomic.LoadUint64(&f.cacheMisses),
+	}
+}
+
+func (f *FastOTP) getCachedOtp(ctx context.Context, id string) (*OTP, error) {
+	if otp, ok := f.cache.Get(ctx, id); ok {
+		atomic.AddUint64(&f.cacheHits, 1)
+		return otp.clone(), nil
+	}
+	atomic.AddUint64(&f.cacheMisses, 1)
+
+	otp, err := f.flight.do(ctx, id, func(ctx context.Context) (*OTP, error) {
+		otp, err := f.getOtp(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		f.cacheOtp(ctx, otp)
+		return otp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return otp.clone(), nil
+}
+
+// cacheOtp stores otp, unless it has already expired.
+func (f *FastOTP) cacheOtp(ctx context.Context, otp *OTP) {
+	if f.cache == nil || otp.ID == "" {
+		return
+	}
+
+	ttl := f.cacheTTL
+	if !otp.ExpiresAt.IsZero() {
+		if untilExpiry := time.Until(otp.ExpiresAt); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl <= 0 {
+		f.cache.Delete(ctx, otp.ID)
+		return
+	}
+	f.cache.Set(ctx, otp.clone(), ttl)
+	f.subjects.add(otp.Identifier, otp.ID, time.Now().Add(ttl))
+}
+
+// clone returns a copy of o that shares no memory with it.
+func (o *OTP) clone() *OTP {
+	c := *o
+	if o.DeliveryMethods != nil {
+		c.DeliveryMethods = append([]string(nil), o.DeliveryMethods...)
+	}
+	c.DeliveryDetails = o.DeliveryDetails.clone()
+	return &c
+}
+
+// flightGroup coalesces concurrent loads of the same key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	otp  *OTP
+	err  error
+}
+
+// do runs fn once for all concurrent callers with the same key and hands
+// each of them its result. fn runs detached from the callers' contexts,
+// keeping only the values of the first one, so that a caller giving up does
+// not fail the others; each caller stops waiting once its own ctx is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*OTP, error)) (*OTP, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(ctx, key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.otp, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, call *flightCall, fn func(ctx context.Context) (*OTP, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flightTimeout)
+	defer cancel()
+
+	call.otp, call.err = fn(ctx)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+}
+
+// LRUCache is an in-memory Cache that evicts the least recently used entry
+// once it holds its maximum number of entries.
+type LRUCache struct {
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	otp       *OTP
+	expiresAt time.Time
+}
+
+// NewLRUCache creates a new LRUCache holding at most size entries.
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 1
+	}
+	return &LRUCache{
+		size:    size,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached OTP for id, if any.
+func (c *LRUCache) Get(_ context.Context, id string) (*OTP, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.otp, true
+}
+
+// Set stores otp under its ID for at most ttl.
+func (c *LRUCache) Set(_ context.Context, otp *OTP, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{otp: otp, expiresAt: c.now().Add(ttl)}
+	if el, ok := c.entries[otp.ID]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[otp.ID] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete removes the OTP with id from the cache.
+func (c *LRUCache) Delete(_ context.Context, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+}
+
+// Len returns the number of entries in the cache, including expired ones
+// that have not been evicted yet.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).otp.ID)
+}
@@ -0,0 +1,160 @@
+package fastotp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	cache := NewLRUCache(2)
+	cache.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	cache.Set(ctx, &OTP{ID: "a"}, time.Minute)
+	cache.Set(ctx, &OTP{ID: "b"}, time.Minute)
+	_, ok := cache.Get(ctx, "a")
+	require.True(t, ok)
+
+	// "b" is now the least recently used entry
+	cache.Set(ctx, &OTP{ID: "c"}, time.Minute)
+	_, ok = cache.Get(ctx, "b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+
+	now = now.Add(time.Minute)
+	_, ok = cache.Get(ctx, "a")
+	assert.False(t, ok, "entry expired")
+
+	cache.Delete(ctx, "c")
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestFastOtp_GetOtpCached(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithCache(NewLRUCache(10), time.Minute),
+		WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:        id,
+					Status:    OTPStatusPending,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}})
+			},
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:        "test",
+					Status:    OTPStatusValidated,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}})
+			},
+		}),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			otp, err := fastOtp.GetOtp(context.TODO(), "test")
+			require.NoError(t, err)
+			assert.Equal(t, OTPStatusPending, otp.Status)
+		}()
+	}
+	// give every goroutine the chance to join the in-flight request
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	otp, err := fastOtp.GetOtp(context.TODO(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusPending, otp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 5}, fastOtp.CacheStats())
+
+	// callers cannot modify the cached value
+	otp.Status = OTPStatusValidated
+	otp, err = fastOtp.GetOtp(context.TODO(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusPending, otp.Status)
+
+	_, err = fastOtp.ValidateOTP(context.TODO(), ValidateOTPPayload{Identifier: "test_identifier", Token: "123456"})
+	require.NoError(t, err)
+
+	otp, err = fastOtp.GetOtp(context.TODO(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFastOtp_GetOtpCachedOutlivesFirstCaller(t *testing.T) {
+	release := make(chan struct{})
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithCache(NewLRUCache(10), time.Minute),
+		WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				<-release
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: id, Status: OTPStatusPending}})
+			},
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	first := make(chan error, 1)
+	go func() {
+		_, err := fastOtp.GetOtp(ctx, "test")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, err := fastOtp.GetOtp(context.TODO(), "test")
+		second <- err
+	}()
+
+	// the first caller gives up while both wait on the request it started
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+
+	close(release)
+	assert.NoError(t, <-second)
+}
+
+func TestFastOtp_GetOtpCacheSkipsExpired(t *testing.T) {
+	var calls int32
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithCache(NewLRUCache(10), time.Minute),
+		WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:        id,
+					ExpiresAt: time.Now().Add(-time.Second),
+				}})
+			},
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		_, err := fastOtp.GetOtp(context.TODO(), "test")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
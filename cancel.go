@@ -0,0 +1,108 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/ttlmap"
+)
+
+// ErrOTPCancelled is returned when validating a code whose OTP was cancelled
+// with CancelOTP.
+var ErrOTPCancelled = errors.New("otp was cancelled")
+
+// cancelRetention is how long the cancellation of an OTP without an expiry
+// is remembered.
+const cancelRetention = 24 * time.Hour
+
+// CancelStore records which OTPs were cancelled. The FastOTP API cannot
+// cancel OTPs, so cancellations are only honoured by the FastOTP instances
+// that share a CancelStore. store.NewCancelStore keeps them in a
+// store.OTPStore.
+type CancelStore interface {
+	// Cancel records the OTP with id as cancelled until the time until.
+	Cancel(ctx context.Context, id string, until time.Time) error
+	// Cancelled reports whether the OTP with id was cancelled.
+	Cancelled(ctx context.Context, id string) (bool, error)
+}
+
+// WithCancelStore keeps cancellations in s instead of in memory, so that
+// every instance sharing s rejects the codes of cancelled OTPs.
+func WithCancelStore(s CancelStore) Option {
+	return func(f *FastOTP) {
+		f.cancelStore = s
+	}
+}
+
+// CancelOTP cancels the pending OTP with id, so that ValidateOTP rejects its
+// code with ErrOTPCancelled and GetOtp reports it as OTPStatusCancelled.
+// The FastOTP API itself still accepts the code: the cancellation is only
+// known to this process, until the OTP expires, unless a shared store is set
+// with WithCancelStore. An OTP that was already validated is returned
+// unchanged.
+func (f *FastOTP) CancelOTP(ctx context.Context, id string) (*OTP, error) {
+	otp, err := f.cancelOTP(ctx, id)
+
+	identifier := ""
+	if otp != nil {
+		identifier = otp.Identifier
+	}
+	f.audit(ctx, AuditCancel, "", identifier, id, err)
+	return otp, err
+}
+
+func (f *FastOTP) cancelOTP(ctx context.Context, id string) (*OTP, error) {
+	otp, err := f.getOtp(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if otp.Status == OTPStatusValidated {
+		return otp, nil
+	}
+
+	until := otp.ExpiresAt
+	if until.IsZero() {
+		until = time.Now().Add(cancelRetention)
+	}
+	if err := f.cancellations().Cancel(ctx, otp.ID, until); err != nil {
+		return nil, err
+	}
+	if f.cache != nil {
+		f.cache.Delete(ctx, otp.ID)
+	}
+
+	otp.Status = OTPStatusCancelled
+	return otp, nil
+}
+
+// cancellations returns the store set with WithCancelStore, or the
+// in-memory one.
+func (f *FastOTP) cancellations() CancelStore {
+	if f.cancelStore != nil {
+		return f.cancelStore
+	}
+	return &f.cancelled
+}
+
+// cancelledSet is the CancelStore used without WithCancelStore. It
+// remembers the IDs of cancelled OTPs in memory until they expire.
+type cancelledSet struct {
+	mu  sync.Mutex
+	ids ttlmap.Map[string, struct{}]
+}
+
+func (s *cancelledSet) Cancel(ctx context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids.Set(id, struct{}{}, until, time.Now())
+	return nil
+}
+
+func (s *cancelledSet) Cancelled(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids.Get(id, time.Now())
+	return ok, nil
+}
@@ -0,0 +1,143 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestFastOtp_CancelOTP(t *testing.T) {
+	var gets int32
+	validated := "otp-1"
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithCache(NewLRUCache(10), time.Minute),
+		WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				atomic.AddInt32(&gets, 1)
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:        id,
+					Status:    OTPStatusPending,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}})
+			},
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:     validated,
+					Status: OTPStatusValidated,
+				}})
+			},
+		}),
+	)
+	ctx := context.TODO()
+
+	otp, err := fastOtp.GetOtp(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusPending, otp.Status)
+
+	otp, err = fastOtp.CancelOTP(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusCancelled, otp.Status)
+
+	// the cached pending entry is gone
+	otp, err = fastOtp.GetOtp(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusCancelled, otp.Status)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&gets))
+
+	_, err = fastOtp.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "test_identifier", Token: "123456"})
+	assert.ErrorIs(t, err, ErrOTPCancelled)
+
+	// other OTPs of the identifier still validate
+	validated = "otp-2"
+	otp, err = fastOtp.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "test_identifier", Token: "654321"})
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+}
+
+func TestFastOtp_CancelOTPValidated(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: id, Status: OTPStatusValidated}})
+			},
+		}),
+	)
+
+	otp, err := fastOtp.CancelOTP(context.TODO(), "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+	cancelled, err := fastOtp.cancelled.Cancelled(context.TODO(), "otp-1")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+}
+
+// sharedCancels is a CancelStore two FastOTP instances can share.
+type sharedCancels struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func (s *sharedCancels) Cancel(ctx context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = until
+	return nil
+}
+
+func (s *sharedCancels) Cancelled(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[id]
+	return ok, nil
+}
+
+func TestFastOtp_CancelOTPSharedStore(t *testing.T) {
+	shared := &sharedCancels{ids: map[string]time.Time{}}
+	client := mockedHTTPClient{
+		GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: id, Status: OTPStatusPending}})
+		},
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Status: OTPStatusValidated}})
+		},
+	}
+	first := NewFastOTP(mockAPIKey, WithHTTPClient(client), WithCancelStore(shared))
+	second := NewFastOTP(mockAPIKey, WithHTTPClient(client), WithCancelStore(shared))
+	ctx := context.TODO()
+
+	_, err := first.CancelOTP(ctx, "otp-1")
+	require.NoError(t, err)
+
+	_, err = second.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "test_identifier", Token: "123456"})
+	assert.ErrorIs(t, err, ErrOTPCancelled)
+	otp, err := second.GetOtp(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusCancelled, otp.Status)
+}
+
+type failingCancels struct{ err error }
+
+func (s failingCancels) Cancel(context.Context, string, time.Time) error { return s.err }
+
+func (s failingCancels) Cancelled(context.Context, string) (bool, error) { return false, s.err }
+
+func TestFastOtp_CancelStoreErrors(t *testing.T) {
+	storeErr := errors.New("store unavailable")
+	fastOtp := NewFastOTP(mockAPIKey, WithCancelStore(failingCancels{storeErr}), WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Status: OTPStatusValidated}})
+		},
+	}))
+
+	// a code is not accepted when its cancellation cannot be checked
+	_, err := fastOtp.ValidateOTP(context.TODO(), ValidateOTPPayload{Identifier: "test_identifier", Token: "123456"})
+	assert.ErrorIs(t, err, storeErr)
+}
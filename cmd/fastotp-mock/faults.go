@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// faults injects the failures requested on the command line into the API
+// endpoints.
+type faults struct {
+	rate    float64
+	status  int
+	every   int
+	latency time.Duration
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	count int
+}
+
+func newFaults(rate float64, status, every int, latency time.Duration, seed int64) *faults {
+	return &faults{
+		rate:    rate,
+		status:  status,
+		every:   every,
+		latency: latency,
+		rand:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+// inject reports the status to fail the request with, or 0 to serve it.
+func (f *faults) inject() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.count++
+	if f.every > 0 && f.count%f.every == 0 {
+		return f.status
+	}
+	if f.rate > 0 && f.rand.Float64() < f.rate {
+		return f.status
+	}
+	return 0
+}
+
+func (f *faults) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.latency > 0 {
+			select {
+			case <-time.After(f.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if status := f.inject(); status != 0 {
+			writeJSON(w, status, map[string]string{"message": "injected failure"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+// Command fastotp-mock emulates the FastOTP API for offline development.
+//
+// Point the client at it with fastotp.WithBaseURL("http://localhost:8090").
+// Issued codes are logged, listed as JSON at /_debug/codes and shown on the
+// HTML page at /_inbox.
+//
+// Usage:
+//
+//	fastotp-mock [-addr :8090] [-state fastotp-mock.json] [-api-key key]
+//	             [-fail-rate 0.1] [-fail-every 5] [-fail-status 503]
+//	             [-latency 200ms] [-seed 1]
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+func main() {
+	var (
+		addr       = flag.String("addr", ":8090", "address to listen on")
+		statePath  = flag.String("state", "", "file to persist issued codes to between restarts")
+		apiKey     = flag.String("api-key", "", "API key to require; any non-empty key is accepted when unset")
+		quiet      = flag.Bool("quiet", false, "do not log issued codes")
+		failRate   = flag.Float64("fail-rate", 0, "probability of failing an API request")
+		failEvery  = flag.Int("fail-every", 0, "fail every Nth API request")
+		failStatus = flag.Int("fail-status", http.StatusServiceUnavailable, "status code of injected failures")
+		latency    = flag.Duration("latency", 0, "delay added to every API request")
+		seed       = flag.Int64("seed", time.Now().UnixNano(), "seed for -fail-rate, to reproduce a run")
+	)
+	flag.Parse()
+
+	s, err := loadState(*statePath)
+	if err != nil {
+		log.Fatalf("loading state: %v", err)
+	}
+
+	m := &mock{state: s, apiKey: *apiKey, quiet: *quiet, now: time.Now}
+	f := newFaults(*failRate, *failStatus, *failEvery, *latency, *seed)
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           m.routes(f),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("fastotp-mock listening on %s, inbox at http://localhost%s/_inbox", *addr, *addr)
+	log.Fatal(server.ListenAndServe())
+}
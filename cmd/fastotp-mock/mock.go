@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/internal/randutil"
+)
+
+var alphabets = map[fastotp.OTPType]string{
+	fastotp.OTPTypeNumeric:      "0123456789",
+	fastotp.OTPTypeAlpha:        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	fastotp.OTPTypeAlphaNumeric: "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+}
+
+// mock emulates the FastOTP API paths used by lib.APIClient.
+type mock struct {
+	state  *state
+	apiKey string
+	quiet  bool
+	now    func() time.Time
+}
+
+func (m *mock) routes(f *faults) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/generate", m.generate)
+	api.HandleFunc("/validate", m.validate)
+	api.HandleFunc("/", m.get)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_debug/codes", m.debugCodes)
+	mux.HandleFunc("/_inbox", m.inbox)
+	mux.Handle("/", f.wrap(m.authenticate(api)))
+	return mux
+}
+
+func (m *mock) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("x-api-key")
+		if key == "" || (m.apiKey != "" && key != m.apiKey) {
+			writeJSON(w, http.StatusUnauthorized, fastotp.ErrorResponse{Message: "Unauthenticated."})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *mock) generate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, fastotp.ErrorResponse{Message: "Method not allowed."})
+		return
+	}
+
+	var payload fastotp.GenerateOTPPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, fastotp.ErrorResponse{Message: "Invalid JSON body."})
+		return
+	}
+
+	errs := map[string][]string{}
+	if payload.Identifier == "" {
+		errs["identifier"] = []string{"The identifier field is required."}
+	}
+	if len(payload.Delivery) == 0 {
+		errs["delivery"] = []string{"The delivery field is required."}
+	}
+	if _, ok := alphabets[payload.Type]; !ok {
+		errs["type"] = []string{"The selected type is invalid."}
+	}
+	if payload.TokenLength < 4 || payload.TokenLength > 12 {
+		errs["token_length"] = []string{"The token length must be between 4 and 12."}
+	}
+	if payload.Validity <= 0 {
+		errs["validity"] = []string{"The validity must be at least 1."}
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, fastotp.ErrorResponse{Message: "The given data was invalid.", Errors: errs})
+		return
+	}
+
+	token, err := randutil.String(alphabets[payload.Type], payload.TokenLength)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, fastotp.ErrorResponse{Message: "Server error."})
+		return
+	}
+	id, err := randutil.UUID()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, fastotp.ErrorResponse{Message: "Server error."})
+		return
+	}
+
+	now := m.now().UTC()
+	otp := &issued{
+		OTP: fastotp.OTP{
+			ID:              id,
+			Identifier:      payload.Identifier,
+			Status:          fastotp.OTPStatusPending,
+			Type:            payload.Type,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			ExpiresAt:       now.Add(time.Duration(payload.Validity) * time.Second),
+			DeliveryDetails: fastotp.DeliveryDetails{Email: payload.Delivery["email"]},
+		},
+		Token:    token,
+		Delivery: payload.Delivery,
+	}
+	for channel := range payload.Delivery {
+		otp.OTP.DeliveryMethods = append(otp.OTP.DeliveryMethods, channel)
+	}
+
+	m.state.mu.Lock()
+	m.state.otp[otp.OTP.ID] = otp
+	err = m.state.save()
+	m.state.mu.Unlock()
+	if err != nil {
+		log.Printf("saving state: %v", err)
+	}
+
+	if !m.quiet {
+		log.Printf("issued %s for %s via %v: %s", otp.OTP.ID, otp.OTP.Identifier, otp.OTP.DeliveryMethods, token)
+	}
+	writeJSON(w, http.StatusOK, fastotp.OTPResponse{OTP: otp.OTP})
+}
+
+func (m *mock) validate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, fastotp.ErrorResponse{Message: "Method not allowed."})
+		return
+	}
+
+	var payload fastotp.ValidateOTPPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, fastotp.ErrorResponse{Message: "Invalid JSON body."})
+		return
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	now := m.now().UTC()
+	// only the newest pending OTP of an identifier can be validated
+	for _, otp := range m.state.list() {
+		if otp.OTP.Identifier != payload.Identifier || otp.OTP.Status != fastotp.OTPStatusPending {
+			continue
+		}
+		if !now.Before(otp.OTP.ExpiresAt) {
+			break
+		}
+		if otp.Token != payload.Token {
+			break
+		}
+
+		otp.OTP.Status = fastotp.OTPStatusValidated
+		otp.OTP.UpdatedAt = now
+		if err := m.state.save(); err != nil {
+			log.Printf("saving state: %v", err)
+		}
+		writeJSON(w, http.StatusOK, fastotp.OTPResponse{OTP: otp.OTP})
+		return
+	}
+
+	writeJSON(w, http.StatusBadRequest, fastotp.ErrorResponse{Message: "Invalid or expired token."})
+}
+
+func (m *mock) get(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/")
+	if r.Method != http.MethodGet || id == "" || strings.Contains(id, "/") {
+		writeJSON(w, http.StatusNotFound, fastotp.ErrorResponse{Message: "Not found."})
+		return
+	}
+
+	m.state.mu.Lock()
+	otp, ok := m.state.otp[id]
+	m.state.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, fastotp.ErrorResponse{Message: "OTP not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, fastotp.OTPResponse{OTP: otp.OTP})
+}
+
+func (m *mock) debugCodes(w http.ResponseWriter, r *http.Request) {
+	m.state.mu.Lock()
+	list := m.state.list()
+	m.state.mu.Unlock()
+
+	if identifier := r.URL.Query().Get("identifier"); identifier != "" {
+		filtered := list[:0:0]
+		for _, otp := range list {
+			if otp.OTP.Identifier == identifier {
+				filtered = append(filtered, otp)
+			}
+		}
+		list = filtered
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+var inboxTemplate = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>FastOTP mock inbox</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: .4em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+.token { font-family: monospace; font-size: 1.4em; }
+</style>
+</head>
+<body>
+<h1>FastOTP mock inbox</h1>
+<table>
+<tr><th>Issued</th><th>Identifier</th><th>Delivery</th><th>Code</th><th>Status</th><th>Expires</th></tr>
+{{range .}}<tr>
+<td>{{.OTP.CreatedAt.Format "15:04:05"}}</td>
+<td>{{.OTP.Identifier}}</td>
+<td>{{range $channel, $target := .Delivery}}{{$channel}}: {{$target}} {{end}}</td>
+<td class="token">{{.Token}}</td>
+<td>{{.OTP.Status}}</td>
+<td>{{.OTP.ExpiresAt.Format "15:04:05"}}</td>
+</tr>{{else}}<tr><td colspan="6">No codes issued yet.</td></tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+func (m *mock) inbox(w http.ResponseWriter, r *http.Request) {
+	m.state.mu.Lock()
+	list := m.state.list()
+	m.state.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := inboxTemplate.Execute(w, list); err != nil {
+		log.Printf("rendering inbox: %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startMock(t *testing.T, statePath string, f *faults) (*httptest.Server, *fastotp.FastOTP) {
+	t.Helper()
+	s, err := loadState(statePath)
+	require.NoError(t, err)
+
+	m := &mock{state: s, quiet: true, now: time.Now}
+	server := httptest.NewServer(m.routes(f))
+	t.Cleanup(server.Close)
+	return server, fastotp.NewFastOTP("test_api_key", fastotp.WithBaseURL(server.URL))
+}
+
+func issuedCodes(t *testing.T, server *httptest.Server, identifier string) []issued {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/_debug/codes?identifier=" + identifier)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var codes []issued
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&codes))
+	return codes
+}
+
+func TestMock(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	server, client := startMock(t, statePath, newFaults(0, 0, 0, 0, 1))
+	ctx := context.Background()
+
+	otp, err := client.GenerateOTP(ctx, fastotp.GenerateOTPPayload{
+		Delivery:    fastotp.OTPDelivery{"email": "test@example.com"},
+		Identifier:  "user123",
+		TokenLength: 6,
+		Type:        fastotp.OTPTypeNumeric,
+		Validity:    120,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusPending, otp.Status)
+	assert.Equal(t, "test@example.com", otp.DeliveryDetails.Email)
+
+	codes := issuedCodes(t, server, "user123")
+	require.Len(t, codes, 1)
+	assert.Len(t, codes[0].Token, 6)
+
+	_, err = client.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: "user123", Token: "wrong"})
+	assert.ErrorContains(t, err, "Invalid or expired token.")
+
+	// codes survive a restart
+	server, client = startMock(t, statePath, newFaults(0, 0, 0, 0, 1))
+
+	validated, err := client.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: "user123", Token: codes[0].Token})
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusValidated, validated.Status)
+
+	got, err := client.GetOtp(ctx, otp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusValidated, got.Status)
+
+	resp, err := http.Get(server.URL + "/_inbox")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMock_ValidationErrors(t *testing.T) {
+	server, client := startMock(t, "", newFaults(0, 0, 0, 0, 1))
+
+	_, err := client.GenerateOTP(context.Background(), fastotp.GenerateOTPPayload{Type: "emoji"})
+	apiErr, ok := fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Contains(t, apiErr.Errors, "identifier")
+	assert.Contains(t, apiErr.Errors, "type")
+
+	_, err = fastotp.NewFastOTP("", fastotp.WithBaseURL(server.URL)).GetOtp(context.Background(), "x")
+	apiErr, ok = fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestMock_InjectedFailures(t *testing.T) {
+	_, client := startMock(t, "", newFaults(0, http.StatusBadGateway, 2, 0, 1))
+
+	_, err := client.GetOtp(context.Background(), "missing")
+	apiErr, ok := fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	_, err = client.GetOtp(context.Background(), "missing")
+	apiErr, ok = fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+}
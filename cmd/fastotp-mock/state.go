@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// issued is an OTP the mock has generated, together with its token.
+type issued struct {
+	OTP      fastotp.OTP         `json:"otp"`
+	Token    string              `json:"token"`
+	Delivery fastotp.OTPDelivery `json:"delivery"`
+}
+
+// state holds every issued OTP and, when given a path, persists them as JSON
+// so codes survive restarts.
+type state struct {
+	path string
+
+	mu  sync.Mutex
+	otp map[string]*issued
+}
+
+func loadState(path string) (*state, error) {
+	s := &state{path: path, otp: make(map[string]*issued)}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*issued
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, otp := range list {
+		s.otp[otp.OTP.ID] = otp
+	}
+	return s, nil
+}
+
+// list returns the issued OTPs, newest first. The caller must hold s.mu.
+func (s *state) list() []*issued {
+	list := make([]*issued, 0, len(s.otp))
+	for _, otp := range s.otp {
+		list = append(list, otp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].OTP.CreatedAt.After(list[j].OTP.CreatedAt)
+	})
+	return list
+}
+
+// save writes the state to disk. The caller must hold s.mu.
+func (s *state) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".fastotp-mock-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
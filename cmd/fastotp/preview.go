@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/CeoFred/fast-otp/message"
+)
+
+// vars collects repeated -var name=value flags.
+type vars map[string]interface{}
+
+func (v vars) String() string {
+	return fmt.Sprint(map[string]interface{}(v))
+}
+
+func (v vars) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return errors.New("want name=value")
+	}
+	v[name] = value
+	return nil
+}
+
+func runPreview(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		dir         = flags.String("templates", "", "directory of templates to load over the built-in ones")
+		purpose     = flags.String("purpose", message.Default, "purpose of the message")
+		channel     = flags.String("channel", "email", "delivery channel")
+		locale      = flags.String("locale", "en", "locale of the reader")
+		token       = flags.String("token", "123456", "code to show")
+		identifier  = flags.String("identifier", "user@example.com", "identifier to show")
+		validity    = flags.Duration("validity", 5*time.Minute, "how long the code is valid")
+		maxSegments = flags.Int("max-segments", 0, "fail when an SMS needs more segments")
+		htmlOut     = flags.String("html", "", "write the HTML body to this file instead of printing it")
+		values      = vars{}
+	)
+	flags.Var(values, "var", "template variable as name=value, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	catalog := message.NewCatalog(message.WithMaxSegments(*maxSegments), message.WithVars(values))
+	if *dir != "" {
+		if err := catalog.LoadFS(os.DirFS(*dir), "."); err != nil {
+			return err
+		}
+	}
+
+	msg, err := catalog.Render(*purpose, *channel, *locale, message.Data{
+		Token:      *token,
+		Identifier: *identifier,
+		ExpiresAt:  time.Now().Add(*validity),
+		ExpiresIn:  *validity,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Locales:  %s\n", strings.Join(catalog.Locales(*locale), " > "))
+	if msg.Subject != "" {
+		fmt.Fprintf(stdout, "Subject:  %s\n", msg.Subject)
+	}
+	fmt.Fprintf(stdout, "SMS:      %d segment(s), %s, %d characters\n", msg.Segments, msg.Encoding, len([]rune(msg.Text)))
+	fmt.Fprintf(stdout, "\n%s\n", msg.Text)
+
+	if msg.HTML == "" {
+		return nil
+	}
+	if *htmlOut != "" {
+		if err := os.WriteFile(*htmlOut, []byte(msg.HTML), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "\nHTML written to %s\n", *htmlOut)
+		return nil
+	}
+	fmt.Fprintf(stdout, "\n--- HTML\n%s\n", msg.HTML)
+	return nil
+}
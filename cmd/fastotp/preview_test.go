@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "login.sms.pt.txt.tmpl"),
+		[]byte("{{.Vars.Product}}: seu codigo e {{.Token}}"), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"preview", "-templates", dir, "-purpose", "login", "-channel", "sms",
+		"-locale", "pt-BR", "-token", "987654", "-var", "Product=Acme"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	assert.Contains(t, stdout.String(), "Locales:  pt-BR > pt > en")
+	assert.Contains(t, stdout.String(), "SMS:      1 segment(s), GSM-7")
+	assert.Contains(t, stdout.String(), "Acme: seu codigo e 987654")
+}
+
+func TestPreview_HTML(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "preview.html")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"preview", "-html", out}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	assert.Contains(t, stdout.String(), "Subject:  Your verification code")
+	html, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(html), "<strong>123456</strong>")
+}
+
+func TestPreview_TooLong(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"preview", "-channel", "sms", "-max-segments", "1", "-token", string(bytes.Repeat([]byte("9"), 200))}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "message too long")
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"nope"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "preview")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/store"
+)
+
+// config is read from the JSON file given with -config, then overridden by
+// the environment.
+type config struct {
+	// Addr is the address to listen on.
+	Addr string `json:"addr"`
+	// APIKey is the FastOTP API key. APIKeyFile is preferred in production
+	// as it is re-read when the key is rotated.
+	APIKey     string `json:"api_key"`
+	APIKeyFile string `json:"api_key_file"`
+	// BaseURLs overrides the FastOTP API base URL, in failover order.
+	BaseURLs []string `json:"base_urls"`
+	// AuthTokens are the bearer tokens clients of fastotpd must present.
+	AuthTokens []string `json:"auth_tokens"`
+	// ShutdownTimeout bounds how long in-flight requests may take to
+	// finish on shutdown.
+	ShutdownTimeout duration `json:"shutdown_timeout"`
+	// CircuitBreaker enables the API client's circuit breaker.
+	CircuitBreaker bool `json:"circuit_breaker"`
+	// Policies are registered by purpose on the FastOTP client.
+	Policies map[string]policyConfig `json:"policies"`
+	// Database keeps the cancellations of OTPs where every replica sees
+	// them. POST /v1/otp/{id}/cancel is only served when it is set.
+	Database *databaseConfig `json:"database"`
+}
+
+type databaseConfig struct {
+	// Driver is the name of a database/sql driver linked into fastotpd,
+	// such as "sqlite" when built with -tags sqlite.
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	// Table defaults to the store package's table name.
+	Table string `json:"table"`
+	// Placeholder is "question", the default, or "dollar".
+	Placeholder string `json:"placeholder"`
+}
+
+func (d *databaseConfig) options() ([]store.SQLOption, error) {
+	var opts []store.SQLOption
+	if d.Table != "" {
+		opts = append(opts, store.WithTable(d.Table))
+	}
+	switch d.Placeholder {
+	case "", "question":
+	case "dollar":
+		opts = append(opts, store.WithPlaceholder(store.Dollar))
+	default:
+		return nil, fmt.Errorf("unknown database placeholder %q", d.Placeholder)
+	}
+	return opts, nil
+}
+
+type policyConfig struct {
+	Type        fastotp.OTPType `json:"type"`
+	TokenLength int             `json:"token_length"`
+	Validity    int             `json:"validity"`
+	Channels    []string        `json:"channels"`
+	MaxResends  int             `json:"max_resends"`
+	MaxAttempts int             `json:"max_attempts"`
+	Cooldown    duration        `json:"cooldown"`
+}
+
+func (p policyConfig) policy() fastotp.Policy {
+	return fastotp.Policy{
+		Type:        p.Type,
+		TokenLength: p.TokenLength,
+		Validity:    p.Validity,
+		Channels:    p.Channels,
+		MaxResends:  p.MaxResends,
+		MaxAttempts: p.MaxAttempts,
+		Cooldown:    time.Duration(p.Cooldown),
+	}
+}
+
+// duration is a time.Duration written as a string such as "30s" in JSON.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func loadConfig(path string, getenv func(string) string) (*config, error) {
+	cfg := &config{
+		Addr:            ":8080",
+		ShutdownTimeout: duration(15 * time.Second),
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	if v := getenv("FASTOTPD_ADDR"); v != "" {
+		cfg.Addr = v
+	}
+	if v := getenv("FASTOTP_API_KEY"); v != "" {
+		cfg.APIKey = v
+	}
+	if v := getenv("FASTOTP_API_KEY_FILE"); v != "" {
+		cfg.APIKeyFile = v
+	}
+	if v := getenv("FASTOTP_BASE_URLS"); v != "" {
+		cfg.BaseURLs = splitList(v)
+	}
+	if v := getenv("FASTOTPD_AUTH_TOKENS"); v != "" {
+		cfg.AuthTokens = splitList(v)
+	}
+	if v := getenv("FASTOTPD_DATABASE_DSN"); v != "" {
+		if cfg.Database == nil {
+			cfg.Database = &databaseConfig{}
+		}
+		cfg.Database.DSN = v
+	}
+
+	if cfg.APIKey == "" && cfg.APIKeyFile == "" {
+		return nil, errors.New("no FastOTP API key configured")
+	}
+	if len(cfg.AuthTokens) == 0 {
+		return nil, errors.New("no auth tokens configured")
+	}
+	if db := cfg.Database; db != nil {
+		if db.Driver == "" || db.DSN == "" {
+			return nil, errors.New("database needs a driver and a DSN")
+		}
+		if _, err := db.options(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
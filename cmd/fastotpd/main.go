@@ -0,0 +1,150 @@
+// Command fastotpd exposes the FastOTP client, with its policies, circuit
+// breaker and failover, as a REST API for services not written in Go.
+//
+// Usage:
+//
+//	fastotpd -config /etc/fastotpd.json
+//
+// The configuration file is JSON; FASTOTPD_ADDR, FASTOTP_API_KEY,
+// FASTOTP_API_KEY_FILE, FASTOTP_BASE_URLS, FASTOTPD_AUTH_TOKENS and
+// FASTOTPD_DATABASE_DSN override it. The API is described by the OpenAPI
+// document served at /openapi.json.
+//
+// Cancelling OTPs needs a database shared by every replica, as the FastOTP
+// API cannot cancel them. No database driver is linked in by default: build
+// with -tags sqlite for SQLite, or add a file importing another
+// database/sql driver.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	httpclient "github.com/CeoFred/fast-otp/lib"
+	"github.com/CeoFred/fast-otp/store"
+)
+
+func main() {
+	configPath := flag.String("config", "", "path to the JSON configuration file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newClient(cfg *config, cancels fastotp.CancelStore) *fastotp.FastOTP {
+	var opts []fastotp.Option
+	if cancels != nil {
+		opts = append(opts, fastotp.WithCancelStore(cancels))
+	}
+	if cfg.APIKeyFile != "" {
+		opts = append(opts, fastotp.WithCredentials(httpclient.NewFileCredentials(cfg.APIKeyFile)))
+	}
+	if len(cfg.BaseURLs) > 0 {
+		opts = append(opts, fastotp.WithAPIClientOptions(httpclient.WithBaseURLs(cfg.BaseURLs...)))
+	}
+	if cfg.CircuitBreaker {
+		opts = append(opts, fastotp.WithCircuitBreaker(httpclient.BreakerSettings{
+			OnStateChange: func(name string, from, to httpclient.BreakerState) {
+				log.Printf("circuit breaker %s: %s -> %s", name, from, to)
+			},
+		}))
+	}
+	for purpose, policy := range cfg.Policies {
+		opts = append(opts, fastotp.WithPolicy(purpose, policy.policy()))
+	}
+	return fastotp.NewFastOTP(cfg.APIKey, opts...)
+}
+
+// openCancelStore opens the database keeping cancellations, if one is
+// configured, and sweeps expired ones until ctx is done.
+func openCancelStore(ctx context.Context, cfg *databaseConfig) (fastotp.CancelStore, func(), error) {
+	if cfg == nil {
+		return nil, func() {}, nil
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts, err := cfg.options()
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	s, err := store.NewSQLStore(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	go store.Sweep(ctx, s, time.Minute, func(err error) {
+		log.Printf("sweeping cancellations: %v", err)
+	})
+	return store.NewCancelStore(s), func() { db.Close() }, nil
+}
+
+func run(ctx context.Context, cfg *config) error {
+	cancels, closeDB, err := openCancelStore(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	s := newServer(newClient(cfg, cancels), cfg.AuthTokens)
+	s.cancels = cancels != nil
+	httpServer := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("fastotpd listening on %s", cfg.Addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// fail readiness first so load balancers stop sending traffic
+	s.ready.Store(false)
+	log.Print("fastotpd shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metrics counts requests per route and status, and exposes them in the
+// Prometheus text format.
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	duration map[string]*durationSum
+}
+
+type requestKey struct {
+	route  string
+	status int
+}
+
+type durationSum struct {
+	count uint64
+	sum   time.Duration
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestKey]uint64),
+		duration: make(map[string]*durationSum),
+	}
+}
+
+func (m *metrics) observe(route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route: route, status: status}]++
+	d, ok := m.duration[route]
+	if !ok {
+		d = &durationSum{}
+		m.duration[route] = d
+	}
+	d.count++
+	d.sum += elapsed
+}
+
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	fmt.Fprintln(w, "# HELP fastotpd_requests_total Requests handled, by route and status code.")
+	fmt.Fprintln(w, "# TYPE fastotpd_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "fastotpd_requests_total{route=%q,code=%q} %d\n", key.route, strconv.Itoa(key.status), m.requests[key])
+	}
+
+	routes := make([]string, 0, len(m.duration))
+	for route := range m.duration {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	fmt.Fprintln(w, "# HELP fastotpd_request_duration_seconds Time spent handling requests, by route.")
+	fmt.Fprintln(w, "# TYPE fastotpd_request_duration_seconds summary")
+	for _, route := range routes {
+		d := m.duration[route]
+		fmt.Fprintf(w, "fastotpd_request_duration_seconds_sum{route=%q} %g\n", route, d.sum.Seconds())
+		fmt.Fprintf(w, "fastotpd_request_duration_seconds_count{route=%q} %d\n", route, d.count)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/httpotp"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// otpService is the part of fastotp.FastOTP the server exposes.
+type otpService interface {
+	GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error)
+	ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error)
+	GetOtp(ctx context.Context, id string) (*fastotp.OTP, error)
+	CancelOTP(ctx context.Context, id string) (*fastotp.OTP, error)
+	GenerateForPurpose(ctx context.Context, purpose, identifier string, delivery fastotp.OTPDelivery) (*fastotp.OTP, error)
+	ValidateForPurpose(ctx context.Context, purpose, identifier, token string) (*fastotp.OTP, error)
+}
+
+type server struct {
+	otp     otpService
+	tokens  [][]byte
+	metrics *metrics
+	ready   atomic.Bool
+	// cancels is set when cancellations are kept in a database shared by
+	// every replica. Without one, a cancellation would only be known to the
+	// replica that received it, so the endpoint is not served.
+	cancels bool
+}
+
+func newServer(otp otpService, tokens []string) *server {
+	s := &server{
+		otp:     otp,
+		metrics: newMetrics(),
+	}
+	for _, token := range tokens {
+		s.tokens = append(s.tokens, []byte(token))
+	}
+	return s
+}
+
+type generateRequest struct {
+	Purpose string `json:"purpose"`
+	fastotp.GenerateOTPPayload
+}
+
+type validateRequest struct {
+	Purpose string `json:"purpose"`
+	fastotp.ValidateOTPPayload
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", s.instrument("healthz", http.HandlerFunc(s.healthz)))
+	mux.Handle("/readyz", s.instrument("readyz", http.HandlerFunc(s.readyz)))
+	mux.Handle("/metrics", http.HandlerFunc(s.serveMetrics))
+	mux.Handle("/openapi.json", http.HandlerFunc(serveOpenAPI))
+	mux.Handle("/v1/otp/generate", s.instrument("generate", s.authenticate(http.HandlerFunc(s.generate))))
+	mux.Handle("/v1/otp/validate", s.instrument("validate", s.authenticate(http.HandlerFunc(s.validate))))
+	mux.Handle("/v1/otp/resend", s.instrument("resend", s.authenticate(http.HandlerFunc(s.resend))))
+	mux.Handle("/v1/otp/", s.instrument("otp", s.authenticate(http.HandlerFunc(s.otpByID))))
+	return mux
+}
+
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *server) readyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w)
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPIDocument)
+}
+
+func (s *server) generate(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	var (
+		otp *fastotp.OTP
+		err error
+	)
+	if req.Purpose != "" {
+		otp, err = s.otp.GenerateForPurpose(r.Context(), req.Purpose, req.Identifier, req.Delivery)
+	} else {
+		otp, err = s.otp.GenerateOTP(r.Context(), req.GenerateOTPPayload)
+	}
+	writeOTP(w, otp, err)
+}
+
+func (s *server) validate(w http.ResponseWriter, r *http.Request) {
+	var req validateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	var (
+		otp *fastotp.OTP
+		err error
+	)
+	if req.Purpose != "" {
+		otp, err = s.otp.ValidateForPurpose(r.Context(), req.Purpose, req.Identifier, req.Token)
+	} else {
+		otp, err = s.otp.ValidateOTP(r.Context(), req.ValidateOTPPayload)
+	}
+	writeOTP(w, otp, err)
+}
+
+// resend sends a pending OTP again, subject to the purpose's cooldown and
+// resend limit.
+func (s *server) resend(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Purpose == "" {
+		httpotp.WriteError(w, &httpotp.Error{
+			Status:  http.StatusBadRequest,
+			Code:    httpotp.CodeInvalidRequest,
+			Message: "invalid request",
+			Fields:  map[string][]string{"purpose": {"is required"}},
+		})
+		return
+	}
+
+	otp, err := s.otp.GenerateForPurpose(r.Context(), req.Purpose, req.Identifier, req.Delivery)
+	writeOTP(w, otp, err)
+}
+
+// otpByID serves GET /v1/otp/{id} and POST /v1/otp/{id}/cancel.
+func (s *server) otpByID(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/otp/"), "/")
+	switch {
+	case id == "":
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusNotFound, Code: httpotp.CodeInvalidRequest, Message: "not found"})
+	case action == "" && r.Method == http.MethodGet:
+		otp, err := s.otp.GetOtp(r.Context(), id)
+		writeOTP(w, otp, err)
+	case action == "cancel" && r.Method == http.MethodPost && !s.cancels:
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusNotImplemented, Code: "not_implemented", Message: "cancelling requires a database"})
+	case action == "cancel" && r.Method == http.MethodPost:
+		otp, err := s.otp.CancelOTP(r.Context(), id)
+		writeOTP(w, otp, err)
+	case action == "" || action == "cancel":
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusMethodNotAllowed, Code: httpotp.CodeMethodNotAllowed, Message: "method not allowed"})
+	default:
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusNotFound, Code: httpotp.CodeInvalidRequest, Message: "not found"})
+	}
+}
+
+// authenticate requires one of the configured bearer tokens.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok {
+			for _, want := range s.tokens {
+				if subtle.ConstantTimeCompare([]byte(token), want) == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fastotpd"`)
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "missing or invalid bearer token"})
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (s *server) instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.metrics.observe(route, rec.status, time.Since(start))
+	})
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusMethodNotAllowed, Code: httpotp.CodeMethodNotAllowed, Message: "method not allowed"})
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		httpotp.WriteError(w, &httpotp.Error{Status: http.StatusBadRequest, Code: httpotp.CodeInvalidRequest, Message: "invalid JSON body"})
+		return false
+	}
+	return true
+}
+
+func writeOTP(w http.ResponseWriter, otp *fastotp.OTP, err error) {
+	if err != nil {
+		httpotp.WriteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, fastotp.OTPResponse{OTP: *otp})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOTPService struct {
+	purposes []string
+}
+
+func (s *fakeOTPService) GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error) {
+	return &fastotp.OTP{ID: "otp-1", Identifier: payload.Identifier, Status: fastotp.OTPStatusPending}, nil
+}
+
+func (s *fakeOTPService) ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error) {
+	return &fastotp.OTP{ID: "otp-1", Identifier: payload.Identifier, Status: fastotp.OTPStatusValidated}, nil
+}
+
+func (s *fakeOTPService) GetOtp(ctx context.Context, id string) (*fastotp.OTP, error) {
+	if id != "otp-1" {
+		return nil, &fastotp.APIError{StatusCode: http.StatusNotFound, Message: "otp not found"}
+	}
+	return &fastotp.OTP{ID: id, Status: fastotp.OTPStatusPending}, nil
+}
+
+func (s *fakeOTPService) CancelOTP(ctx context.Context, id string) (*fastotp.OTP, error) {
+	if id != "otp-1" {
+		return nil, &fastotp.APIError{StatusCode: http.StatusNotFound, Message: "otp not found"}
+	}
+	return &fastotp.OTP{ID: id, Status: fastotp.OTPStatusCancelled}, nil
+}
+
+func (s *fakeOTPService) GenerateForPurpose(ctx context.Context, purpose, identifier string, delivery fastotp.OTPDelivery) (*fastotp.OTP, error) {
+	s.purposes = append(s.purposes, purpose)
+	if len(s.purposes) > 1 {
+		return nil, fastotp.ErrResendCooldown
+	}
+	return &fastotp.OTP{ID: "otp-1", Identifier: identifier, Status: fastotp.OTPStatusPending}, nil
+}
+
+func (s *fakeOTPService) ValidateForPurpose(ctx context.Context, purpose, identifier, token string) (*fastotp.OTP, error) {
+	return nil, fastotp.ErrPurposeMismatch
+}
+
+func do(t *testing.T, h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	service := &fakeOTPService{}
+	s := newServer(service, []string{"secret"})
+	s.cancels = true
+	h := s.routes()
+
+	rec := do(t, h, http.MethodPost, "/v1/otp/generate", "", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = do(t, h, http.MethodPost, "/v1/otp/generate", "wrong", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do(t, h, http.MethodPost, "/v1/otp/generate", "secret", `{"identifier": "user123", "delivery": {"email": "test@example.com"}, "token_length": 6}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp fastotp.OTPResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "user123", resp.OTP.Identifier)
+
+	rec = do(t, h, http.MethodPost, "/v1/otp/generate", "secret", `{"purpose": "login", "identifier": "user123", "delivery": {"email": "test@example.com"}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(t, h, http.MethodPost, "/v1/otp/resend", "secret", `{"purpose": "login", "identifier": "user123", "delivery": {"email": "test@example.com"}}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	rec = do(t, h, http.MethodPost, "/v1/otp/resend", "secret", `{"identifier": "user123"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(t, h, http.MethodPost, "/v1/otp/validate", "secret", `{"identifier": "user123", "token": "123456"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(t, h, http.MethodPost, "/v1/otp/validate", "secret", `{"purpose": "payment", "identifier": "user123", "token": "123456"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = do(t, h, http.MethodGet, "/v1/otp/otp-1", "secret", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(t, h, http.MethodGet, "/v1/otp/missing", "secret", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(t, h, http.MethodPost, "/v1/otp/otp-1/cancel", "secret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, fastotp.OTPStatusCancelled, resp.OTP.Status)
+	rec = do(t, h, http.MethodGet, "/v1/otp/otp-1/cancel", "secret", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec = do(t, h, http.MethodDelete, "/v1/otp/otp-1", "secret", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = do(t, h, http.MethodGet, "/metrics", "", "")
+	assert.Contains(t, rec.Body.String(), `fastotpd_requests_total{route="generate",code="401"} 2`)
+	assert.Contains(t, rec.Body.String(), `fastotpd_request_duration_seconds_count{route="otp"} 5`)
+}
+
+func TestServer_CancelNeedsDatabase(t *testing.T) {
+	h := newServer(&fakeOTPService{}, []string{"secret"}).routes()
+
+	rec := do(t, h, http.MethodPost, "/v1/otp/otp-1/cancel", "secret", "")
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestServer_HealthAndDocs(t *testing.T) {
+	s := newServer(&fakeOTPService{}, []string{"secret"})
+	h := s.routes()
+
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/healthz", "", "").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, do(t, h, http.MethodGet, "/readyz", "", "").Code)
+	s.ready.Store(true)
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/readyz", "", "").Code)
+
+	rec := do(t, h, http.MethodGet, "/openapi.json", "", "")
+	var doc map[string]interface{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{
+		"FASTOTP_API_KEY":      "key",
+		"FASTOTPD_AUTH_TOKENS": "a, b,",
+	}
+	cfg, err := loadConfig("", func(name string) string { return env[name] })
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, []string{"a", "b"}, cfg.AuthTokens)
+
+	assert.Nil(t, cfg.Database)
+
+	// a database needs a driver as well as the DSN
+	env["FASTOTPD_DATABASE_DSN"] = "postgres://localhost/fastotpd"
+	_, err = loadConfig("", func(name string) string { return env[name] })
+	assert.Error(t, err)
+
+	delete(env, "FASTOTPD_DATABASE_DSN")
+	delete(env, "FASTOTPD_AUTH_TOKENS")
+	_, err = loadConfig("", func(name string) string { return env[name] })
+	assert.Error(t, err)
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package main
+
+// With -tags sqlite, the database can be "sqlite", for replicas sharing a
+// host or a volume.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,27 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenCancelStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cancels, closeDB, err := openCancelStore(ctx, &databaseConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "fastotpd.db")})
+	require.NoError(t, err)
+	defer closeDB()
+
+	require.NoError(t, cancels.Cancel(ctx, "otp-1", time.Now().Add(time.Minute)))
+	cancelled, err := cancels.Cancelled(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+}
@@ -0,0 +1,104 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/ttlmap"
+)
+
+// Eraser purges everything kept locally about a subject, for example to
+// honour a deletion request.
+type Eraser interface {
+	Erase(ctx context.Context, identifier string) error
+}
+
+// EraserFunc adapts a function to an Eraser.
+type EraserFunc func(ctx context.Context, identifier string) error
+
+// Erase calls f(ctx, identifier).
+func (f EraserFunc) Erase(ctx context.Context, identifier string) error {
+	return f(ctx, identifier)
+}
+
+// Erase erases identifier from every eraser, carrying on past failures, and
+// returns the joined errors.
+func Erase(ctx context.Context, identifier string, erasers ...Eraser) error {
+	var errs []error
+	for _, eraser := range erasers {
+		if err := eraser.Erase(ctx, identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Erase forgets identifier: the resend and attempt counters of every
+// registered purpose, its pseudonyms, and its OTPs in the GetOtp cache.
+// OTPs held by the API itself are not affected.
+func (f *FastOTP) Erase(ctx context.Context, identifier string) error {
+	subjects := []string{identifier}
+	f.policiesMu.RLock()
+	for purpose := range f.policies {
+		subjects = append(subjects, purposeIdentifier(purpose, identifier))
+	}
+	f.policiesMu.RUnlock()
+
+	for _, subject := range subjects {
+		f.tracker.forget(subject)
+		if f.pseudonymizer != nil {
+			_ = f.pseudonymizer.Erase(ctx, subject)
+		}
+		for _, id := range f.subjects.take(subject) {
+			if f.cache != nil {
+				f.cache.Delete(ctx, id)
+			}
+		}
+	}
+	return nil
+}
+
+// subjectIndex remembers the IDs of the cached OTPs of each identifier, so
+// that Erase can find them. An identifier is kept until the last of its
+// OTPs expires.
+type subjectIndex struct {
+	mu  sync.Mutex
+	ids ttlmap.Map[string, map[string]time.Time]
+}
+
+func (s *subjectIndex) add(identifier, id string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	ids, ok := s.ids.Get(identifier, now)
+	if !ok {
+		ids = make(map[string]time.Time)
+	}
+	ids[id] = until
+	latest := until
+	for id, until := range ids {
+		if !now.Before(until) {
+			delete(ids, id)
+		} else if until.After(latest) {
+			latest = until
+		}
+	}
+	s.ids.Set(identifier, ids, latest, now)
+}
+
+// take returns and forgets the IDs indexed for identifier.
+func (s *subjectIndex) take(identifier string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, _ := s.ids.Get(identifier, time.Now())
+	var out []string
+	for id := range ids {
+		out = append(out, id)
+	}
+	s.ids.Delete(identifier)
+	return out
+}
@@ -0,0 +1,62 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestFastOtp_Erase(t *testing.T) {
+	ctx := context.Background()
+	api := &pseudonymAPI{issued: map[string]string{}}
+	p, err := NewPseudonymizer(PseudonymKey{ID: "k1", Secret: []byte("secret")})
+	require.NoError(t, err)
+
+	cache := NewLRUCache(10)
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPseudonymizer(p),
+		WithCache(cache, time.Minute),
+		WithPolicy("login", Policy{Type: OTPTypeNumeric, TokenLength: 6, Validity: 300, Cooldown: time.Hour}),
+		WithHTTPClient(api.client()),
+	)
+
+	_, err = fastOtp.GenerateForPurpose(ctx, "login", "user@example.com", OTPDelivery{"email": "user@example.com"})
+	require.NoError(t, err)
+	_, err = fastOtp.GetOtp(ctx, "otp-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, cache.Len())
+	_, ok := p.Identifier(api.seen[0])
+	require.True(t, ok)
+
+	// the cooldown applies until the identifier is erased
+	_, err = fastOtp.GenerateForPurpose(ctx, "login", "user@example.com", OTPDelivery{"email": "user@example.com"})
+	assert.ErrorIs(t, err, ErrResendCooldown)
+
+	require.NoError(t, fastOtp.Erase(ctx, "user@example.com"))
+	assert.Equal(t, 0, cache.Len())
+	_, ok = p.Identifier(api.seen[0])
+	assert.False(t, ok)
+	_, err = fastOtp.GenerateForPurpose(ctx, "login", "user@example.com", OTPDelivery{"email": "user@example.com"})
+	assert.NoError(t, err)
+}
+
+func TestErase(t *testing.T) {
+	var erased []string
+	ok := EraserFunc(func(ctx context.Context, identifier string) error {
+		erased = append(erased, identifier)
+		return nil
+	})
+	failing := EraserFunc(func(ctx context.Context, identifier string) error {
+		return errors.New("database is down")
+	})
+
+	err := Erase(context.Background(), "user123", ok, failing, ok)
+	assert.ErrorContains(t, err, "database is down")
+	assert.Equal(t, []string{"user123", "user123"}, erased)
+
+	assert.NoError(t, Erase(context.Background(), "user123"))
+}
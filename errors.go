@@ -0,0 +1,57 @@
+package fastotp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ErrCannotResend is returned by services that cannot deliver the code of an
+// existing OTP again, such as a local.Provider without a resend key.
+var ErrCannotResend = errors.New("otp cannot be resent")
+
+// APIError is returned when the FastOTP API answers with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Errors holds the API's validation errors by field, if any.
+	Errors map[string][]string
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if len(e.Errors) > 0 {
+		return formatValidationError(e.Errors)
+	}
+	return fmt.Sprintf("API error: %s", e.Message)
+}
+
+// IsClientError reports whether the API rejected the request itself, for
+// example because of an invalid token or payload, rather than failing.
+func (e *APIError) IsClientError() bool {
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError
+}
+
+// AsAPIError returns the *APIError in err's chain, if any.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+func formatValidationError(errors map[string][]string) string {
+	fields := make([]string, 0, len(errors))
+	for field := range errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var errorMessage string
+	for _, field := range fields {
+		for _, err := range errors[field] {
+			errorMessage += fmt.Sprintf("%s: %s\n", field, err)
+		}
+	}
+	return fmt.Sprintf("validation errors:\n%s", errorMessage)
+}
@@ -0,0 +1,46 @@
+package fastotp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestAPIError(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusUnprocessableEntity, ErrorResponse{
+				Message: "The given data was invalid.",
+				Errors: map[string][]string{
+					"token_length": {"must be at least 4"},
+					"identifier":   {"is required"},
+				},
+			})
+		},
+		GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+			return httpmock.NewStringResponse(http.StatusBadGateway, "<html>bad gateway</html>"), nil
+		},
+	}))
+
+	_, err := fastOtp.GenerateOTP(context.TODO(), GenerateOTPPayload{})
+	apiErr, ok := AsAPIError(fmt.Errorf("wrapped: %w", err))
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.True(t, apiErr.IsClientError())
+	assert.Equal(t, []string{"is required"}, apiErr.Errors["identifier"])
+	assert.Equal(t, "validation errors:\nidentifier: is required\ntoken_length: must be at least 4\n", err.Error())
+
+	_, err = fastOtp.GetOtp(context.TODO(), "test")
+	apiErr, ok = AsAPIError(err)
+	require.True(t, ok)
+	assert.False(t, apiErr.IsClientError())
+	assert.Equal(t, "API error: Bad Gateway", err.Error())
+
+	_, ok = AsAPIError(ErrCircuitOpen)
+	assert.False(t, ok)
+}
@@ -0,0 +1,419 @@
+// Package factors manages the second factors of users behind one API:
+// codes sent by email or SMS through FastOTP, TOTP authenticator apps and
+// recovery codes.
+//
+// A Manager enrols factors per user, runs challenges against them and
+// checks responses with the provider each factor needs, recording when
+// every factor was last used.
+package factors
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/recovery"
+)
+
+var (
+	// ErrUnknownFactor is returned for a factor ID the user does not have.
+	ErrUnknownFactor = errors.New("unknown factor")
+	// ErrInvalidResponse is returned by Verify for a wrong, expired or
+	// reused code.
+	ErrInvalidResponse = errors.New("invalid response")
+	// ErrNotConfigured is returned for a kind of factor whose provider was
+	// not given to New.
+	ErrNotConfigured = errors.New("factor kind not configured")
+)
+
+// Kind is the kind of a factor.
+type Kind string
+
+const (
+	// KindEmail factors receive codes by email through FastOTP.
+	KindEmail Kind = "email"
+	// KindSMS factors receive codes by SMS through FastOTP.
+	KindSMS Kind = "sms"
+	// KindTOTP factors are authenticator apps.
+	KindTOTP Kind = "totp"
+	// KindRecovery factors are sets of recovery codes. A user has at most
+	// one.
+	KindRecovery Kind = "recovery"
+)
+
+// Factor is a second factor enrolled by a user.
+type Factor struct {
+	ID   string `json:"id"`
+	User string `json:"user"`
+	Kind Kind   `json:"kind"`
+	// Target is the email address or phone number codes are sent to.
+	Target string `json:"target,omitempty"`
+	// Secret is the TOTP secret. Manager.List and Manager.Verify leave it
+	// out.
+	Secret []byte `json:"secret,omitempty"`
+	// LastCounter is the time step of the last TOTP code accepted, so that
+	// a code cannot be used twice.
+	LastCounter int64 `json:"last_counter,omitempty"`
+	// Verified is set once a response to the factor has been accepted.
+	// Email, SMS and TOTP factors are enrolled unverified.
+	Verified   bool      `json:"verified"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func (f *Factor) clone() *Factor {
+	c := *f
+	if f.Secret != nil {
+		c.Secret = append([]byte(nil), f.Secret...)
+	}
+	return &c
+}
+
+// public returns a copy of f without its secret.
+func (f *Factor) public() *Factor {
+	c := f.clone()
+	c.Secret = nil
+	return c
+}
+
+// OTPService sends and checks codes for email and SMS factors.
+// *fastotp.FastOTP and *local.Provider implement it.
+type OTPService interface {
+	GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error)
+	ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error)
+}
+
+// Manager enrols and checks the factors of users.
+type Manager struct {
+	store    Store
+	otp      OTPService
+	recovery *recovery.Manager
+	issuer   string
+	skew     int
+	otpType  fastotp.OTPType
+	length   int
+	validity int
+	now      func() time.Time
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithOTP sends and checks the codes of email and SMS factors with service.
+func WithOTP(service OTPService) Option {
+	return func(m *Manager) {
+		m.otp = service
+	}
+}
+
+// WithOTPSettings sets the type, length and validity in seconds of codes
+// sent to email and SMS factors. Defaults to 6 digits valid for 5 minutes.
+func WithOTPSettings(otpType fastotp.OTPType, tokenLength, validity int) Option {
+	return func(m *Manager) {
+		m.otpType = otpType
+		m.length = tokenLength
+		m.validity = validity
+	}
+}
+
+// WithRecovery keeps recovery codes with codes.
+func WithRecovery(codes *recovery.Manager) Option {
+	return func(m *Manager) {
+		m.recovery = codes
+	}
+}
+
+// WithIssuer names the service in the URIs of TOTP enrolments.
+func WithIssuer(issuer string) Option {
+	return func(m *Manager) {
+		m.issuer = issuer
+	}
+}
+
+// WithTOTPSkew accepts TOTP codes up to steps time steps early or late.
+// Defaults to 1.
+func WithTOTPSkew(steps int) Option {
+	return func(m *Manager) {
+		m.skew = steps
+	}
+}
+
+// New creates a new Manager keeping factors in store.
+func New(store Store, opts ...Option) *Manager {
+	m := &Manager{
+		store:    store,
+		skew:     1,
+		otpType:  fastotp.OTPTypeNumeric,
+		length:   6,
+		validity: 300,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Manager) create(ctx context.Context, user string, kind Kind, target string, secret []byte) (*Factor, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	factor := &Factor{
+		ID:        hex.EncodeToString(id),
+		User:      user,
+		Kind:      kind,
+		Target:    target,
+		Secret:    secret,
+		CreatedAt: m.now(),
+	}
+	if err := m.store.Create(ctx, factor); err != nil {
+		return nil, err
+	}
+	return factor, nil
+}
+
+// EnrollEmail adds an email factor sending codes to address. It stays
+// unverified until a code sent by Challenge is verified.
+func (m *Manager) EnrollEmail(ctx context.Context, user, address string) (*Factor, error) {
+	if m.otp == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, KindEmail)
+	}
+	return m.create(ctx, user, KindEmail, address, nil)
+}
+
+// EnrollSMS adds an SMS factor sending codes to phone. It stays unverified
+// until a code sent by Challenge is verified.
+func (m *Manager) EnrollSMS(ctx context.Context, user, phone string) (*Factor, error) {
+	if m.otp == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, KindSMS)
+	}
+	return m.create(ctx, user, KindSMS, phone, nil)
+}
+
+// TOTPEnrollment is what a user needs to add a TOTP factor to an
+// authenticator app.
+type TOTPEnrollment struct {
+	// Secret is the base32 secret, for typing in by hand.
+	Secret string
+	// URI is the otpauth:// URI, usually shown as a QR code.
+	URI string
+}
+
+// EnrollTOTP adds a TOTP factor for an authenticator app, and returns the
+// secret to show the user once. The factor stays unverified until the
+// first code from the app is verified. account names the user in the app.
+func (m *Manager) EnrollTOTP(ctx context.Context, user, account string) (*Factor, *TOTPEnrollment, error) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return nil, nil, err
+	}
+	factor, err := m.create(ctx, user, KindTOTP, "", secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	totp := TOTP{Secret: secret}
+	return factor.public(), &TOTPEnrollment{
+		Secret: b32.EncodeToString(secret),
+		URI:    totp.URI(m.issuer, account),
+	}, nil
+}
+
+// EnrollRecovery generates recovery codes for user and returns them to
+// show the user once. A user has one recovery factor: enrolling again
+// replaces the codes.
+func (m *Manager) EnrollRecovery(ctx context.Context, user string) (*Factor, []string, error) {
+	if m.recovery == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotConfigured, KindRecovery)
+	}
+
+	factors, err := m.store.List(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	var factor *Factor
+	for _, f := range factors {
+		if f.Kind == KindRecovery {
+			factor = f
+			break
+		}
+	}
+
+	codes, err := m.recovery.Generate(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if factor == nil {
+		if factor, err = m.create(ctx, user, KindRecovery, "", nil); err != nil {
+			return nil, nil, err
+		}
+		if factor, err = m.store.Update(ctx, user, factor.ID, func(f *Factor) error {
+			f.Verified = true
+			return nil
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return factor.public(), codes, nil
+}
+
+// List returns the factors of user, oldest first, without their secrets.
+func (m *Manager) List(ctx context.Context, user string) ([]*Factor, error) {
+	factors, err := m.store.List(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range factors {
+		factors[i] = f.public()
+	}
+	return factors, nil
+}
+
+// Remove removes a factor of user. Removing the recovery factor also
+// deletes the recovery codes.
+func (m *Manager) Remove(ctx context.Context, user, id string) error {
+	factor, err := m.store.Get(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	if factor.Kind == KindRecovery && m.recovery != nil {
+		if err := m.recovery.Erase(ctx, user); err != nil {
+			return err
+		}
+	}
+	return m.store.Delete(ctx, user, id)
+}
+
+// Challenge is a request for a response to a factor.
+type Challenge struct {
+	FactorID string
+	Kind     Kind
+	// OTP is the code sent for email and SMS factors. It is nil for TOTP and
+	// recovery factors, whose codes the user already has.
+	OTP *fastotp.OTP
+}
+
+// Challenge starts a challenge against a factor of user, sending a code to
+// email and SMS factors.
+func (m *Manager) Challenge(ctx context.Context, user, id string) (*Challenge, error) {
+	factor, err := m.store.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &Challenge{FactorID: factor.ID, Kind: factor.Kind}
+	switch factor.Kind {
+	case KindEmail, KindSMS:
+		if m.otp == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfigured, factor.Kind)
+		}
+		// the factor ID, rather than the user, identifies the code, so
+		// codes for different factors do not mix
+		challenge.OTP, err = m.otp.GenerateOTP(ctx, fastotp.GenerateOTPPayload{
+			Delivery:    fastotp.OTPDelivery{string(factor.Kind): factor.Target},
+			Identifier:  factor.ID,
+			Type:        m.otpType,
+			TokenLength: m.length,
+			Validity:    m.validity,
+		})
+		if err != nil {
+			return nil, err
+		}
+	case KindRecovery:
+		if m.recovery == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfigured, factor.Kind)
+		}
+	}
+	return challenge, nil
+}
+
+// Verify checks response against a factor of user, marking the factor
+// verified and recording when it was used. Wrong, expired and reused codes
+// fail with ErrInvalidResponse.
+func (m *Manager) Verify(ctx context.Context, user, id, response string) (*Factor, error) {
+	factor, err := m.store.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	var counter int64
+	switch factor.Kind {
+	case KindEmail, KindSMS:
+		if err := m.verifyOTP(ctx, factor, response); err != nil {
+			return nil, err
+		}
+	case KindTOTP:
+		var ok bool
+		if counter, ok = (TOTP{Secret: factor.Secret}).Verify(response, now, m.skew); !ok {
+			return nil, ErrInvalidResponse
+		}
+	case KindRecovery:
+		if m.recovery == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotConfigured, factor.Kind)
+		}
+		err := m.recovery.Verify(ctx, user, response)
+		if errors.Is(err, recovery.ErrInvalidCode) || errors.Is(err, recovery.ErrUsed) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, factor.Kind)
+	}
+
+	factor, err = m.store.Update(ctx, user, id, func(f *Factor) error {
+		if f.Kind == KindTOTP {
+			// checked here, where updates do not interleave, so that two
+			// requests cannot both use one code
+			if counter <= f.LastCounter {
+				return ErrInvalidResponse
+			}
+			f.LastCounter = counter
+		}
+		f.Verified = true
+		f.LastUsedAt = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return factor.public(), nil
+}
+
+func (m *Manager) verifyOTP(ctx context.Context, factor *Factor, response string) error {
+	if m.otp == nil {
+		return fmt.Errorf("%w: %s", ErrNotConfigured, factor.Kind)
+	}
+	otp, err := m.otp.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: factor.ID, Token: response})
+	if apiErr, ok := fastotp.AsAPIError(err); ok {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+			return fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if otp.Status != fastotp.OTPStatusValidated {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// Erase removes every factor and the recovery codes of user. It implements
+// fastotp.Eraser.
+func (m *Manager) Erase(ctx context.Context, user string) error {
+	if m.recovery != nil {
+		if err := m.recovery.Erase(ctx, user); err != nil {
+			return err
+		}
+	}
+	return m.store.DeleteAll(ctx, user)
+}
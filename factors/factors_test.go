@@ -0,0 +1,239 @@
+package factors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/local"
+	"github.com/CeoFred/fast-otp/recovery"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ OTPService     = (*fastotp.FastOTP)(nil)
+	_ OTPService     = (*local.Provider)(nil)
+	_ fastotp.Eraser = (*Manager)(nil)
+)
+
+// inbox records the codes a local.Provider sends.
+type inbox struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (i *inbox) Deliver(ctx context.Context, otp *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, target := range delivery {
+		i.tokens[target] = token
+	}
+	return nil
+}
+
+func (i *inbox) last(target string) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.tokens[target]
+}
+
+func newManager(t *testing.T) (*Manager, *inbox) {
+	t.Helper()
+	box := &inbox{tokens: map[string]string{}}
+	codes, err := recovery.New(recovery.NewMemoryStore())
+	require.NoError(t, err)
+	m := New(NewMemoryStore(),
+		WithOTP(local.New(box)),
+		WithRecovery(codes),
+		WithIssuer("Example"),
+	)
+	return m, box
+}
+
+func TestManager_EmailAndSMS(t *testing.T) {
+	ctx := context.Background()
+	m, box := newManager(t)
+
+	email, err := m.EnrollEmail(ctx, "user-1", "user@example.com")
+	require.NoError(t, err)
+	assert.False(t, email.Verified)
+	sms, err := m.EnrollSMS(ctx, "user-1", "+2348012345678")
+	require.NoError(t, err)
+
+	challenge, err := m.Challenge(ctx, "user-1", email.ID)
+	require.NoError(t, err)
+	require.NotNil(t, challenge.OTP)
+	assert.Equal(t, KindEmail, challenge.Kind)
+	assert.Equal(t, email.ID, challenge.OTP.Identifier)
+
+	_, err = m.Verify(ctx, "user-1", email.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	// a code sent to one factor does not verify another
+	_, err = m.Challenge(ctx, "user-1", sms.ID)
+	require.NoError(t, err)
+	_, err = m.Verify(ctx, "user-1", email.ID, box.last("+2348012345678"))
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	m.now = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) }
+	verified, err := m.Verify(ctx, "user-1", sms.ID, box.last("+2348012345678"))
+	require.NoError(t, err)
+	assert.True(t, verified.Verified)
+	assert.Equal(t, m.now(), verified.LastUsedAt)
+
+	// codes are single use
+	_, err = m.Verify(ctx, "user-1", sms.ID, box.last("+2348012345678"))
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
+
+func TestManager_TOTP(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newManager(t)
+	now := time.Unix(1700000000, 0)
+	m.now = func() time.Time { return now }
+
+	factor, enrollment, err := m.EnrollTOTP(ctx, "user-1", "user@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, factor.Secret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Example:user@example.com?")
+
+	stored, err := m.store.Get(ctx, "user-1", factor.ID)
+	require.NoError(t, err)
+	totp := TOTP{Secret: stored.Secret}
+	assert.Equal(t, b32.EncodeToString(stored.Secret), enrollment.Secret)
+
+	challenge, err := m.Challenge(ctx, "user-1", factor.ID)
+	require.NoError(t, err)
+	assert.Nil(t, challenge.OTP)
+
+	code := totp.Code(totp.Counter(now))
+	verified, err := m.Verify(ctx, "user-1", factor.ID, code)
+	require.NoError(t, err)
+	assert.True(t, verified.Verified)
+	assert.Nil(t, verified.Secret)
+
+	// the same code, or an older one, is not accepted again
+	_, err = m.Verify(ctx, "user-1", factor.ID, code)
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	_, err = m.Verify(ctx, "user-1", factor.ID, totp.Code(totp.Counter(now)-1))
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	// the next one is
+	now = now.Add(30 * time.Second)
+	_, err = m.Verify(ctx, "user-1", factor.ID, totp.Code(totp.Counter(now)))
+	assert.NoError(t, err)
+}
+
+func TestManager_Recovery(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newManager(t)
+
+	factor, codes, err := m.EnrollRecovery(ctx, "user-1")
+	require.NoError(t, err)
+	assert.True(t, factor.Verified)
+	require.Len(t, codes, 10)
+
+	_, err = m.Verify(ctx, "user-1", factor.ID, codes[0])
+	require.NoError(t, err)
+	_, err = m.Verify(ctx, "user-1", factor.ID, codes[0])
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+	assert.ErrorIs(t, err, recovery.ErrUsed)
+
+	// enrolling again replaces the codes but keeps the factor
+	again, fresh, err := m.EnrollRecovery(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, factor.ID, again.ID)
+	_, err = m.Verify(ctx, "user-1", factor.ID, codes[1])
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	factors, err := m.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, factors, 1)
+
+	require.NoError(t, m.Remove(ctx, "user-1", factor.ID))
+	_, err = m.Verify(ctx, "user-1", factor.ID, fresh[0])
+	assert.ErrorIs(t, err, ErrUnknownFactor)
+}
+
+func TestManager_ListRemoveErase(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newManager(t)
+
+	email, err := m.EnrollEmail(ctx, "user-1", "user@example.com")
+	require.NoError(t, err)
+	_, _, err = m.EnrollTOTP(ctx, "user-1", "user@example.com")
+	require.NoError(t, err)
+	_, _, err = m.EnrollRecovery(ctx, "user-1")
+	require.NoError(t, err)
+	_, err = m.EnrollEmail(ctx, "user-2", "other@example.com")
+	require.NoError(t, err)
+
+	factors, err := m.List(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, factors, 3)
+	assert.Equal(t, []Kind{KindEmail, KindTOTP, KindRecovery}, []Kind{factors[0].Kind, factors[1].Kind, factors[2].Kind})
+	for _, f := range factors {
+		assert.Nil(t, f.Secret)
+	}
+
+	require.NoError(t, m.Remove(ctx, "user-1", email.ID))
+	assert.ErrorIs(t, m.Remove(ctx, "user-1", email.ID), ErrUnknownFactor)
+	_, err = m.Challenge(ctx, "user-2", factors[1].ID)
+	assert.ErrorIs(t, err, ErrUnknownFactor)
+
+	require.NoError(t, m.Erase(ctx, "user-1"))
+	factors, err = m.List(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Empty(t, factors)
+	factors, err = m.List(ctx, "user-2")
+	require.NoError(t, err)
+	assert.Len(t, factors, 1)
+}
+
+func TestManager_NotConfigured(t *testing.T) {
+	ctx := context.Background()
+	m := New(NewMemoryStore())
+
+	_, err := m.EnrollEmail(ctx, "user-1", "user@example.com")
+	assert.ErrorIs(t, err, ErrNotConfigured)
+	_, _, err = m.EnrollRecovery(ctx, "user-1")
+	assert.ErrorIs(t, err, ErrNotConfigured)
+	_, _, err = m.EnrollTOTP(ctx, "user-1", "user@example.com")
+	assert.NoError(t, err)
+}
+
+func TestManager_OTPServiceErrors(t *testing.T) {
+	ctx := context.Background()
+	service := &failingService{err: &fastotp.APIError{StatusCode: http.StatusUnauthorized, Message: "Unauthenticated."}}
+	m := New(NewMemoryStore(), WithOTP(service))
+	factor, err := m.EnrollEmail(ctx, "user-1", "user@example.com")
+	require.NoError(t, err)
+
+	// a refused API key is not the user's fault
+	_, err = m.Verify(ctx, "user-1", factor.ID, "123456")
+	assert.NotErrorIs(t, err, ErrInvalidResponse)
+	var apiErr *fastotp.APIError
+	assert.True(t, errors.As(err, &apiErr))
+
+	service.err = &fastotp.APIError{StatusCode: http.StatusBadRequest, Message: "Invalid or expired token."}
+	_, err = m.Verify(ctx, "user-1", factor.ID, "123456")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
+
+type failingService struct {
+	err error
+}
+
+func (s *failingService) GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error) {
+	return nil, s.err
+}
+
+func (s *failingService) ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error) {
+	return nil, s.err
+}
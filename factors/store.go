@@ -0,0 +1,119 @@
+package factors
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Store keeps the factors of users. Implementations are safe for
+// concurrent use, and return copies that callers may modify.
+type Store interface {
+	// Create stores a new factor.
+	Create(ctx context.Context, factor *Factor) error
+	// Get returns the factor of user with id, or ErrUnknownFactor.
+	Get(ctx context.Context, user, id string) (*Factor, error)
+	// List returns the factors of user, oldest first.
+	List(ctx context.Context, user string) ([]*Factor, error)
+	// Update applies fn to the factor of user with id and stores the
+	// result, unless fn fails. Updates of a factor do not interleave.
+	Update(ctx context.Context, user, id string, fn func(*Factor) error) (*Factor, error)
+	// Delete removes the factor of user with id.
+	Delete(ctx context.Context, user, id string) error
+	// DeleteAll removes every factor of user.
+	DeleteAll(ctx context.Context, user string) error
+}
+
+// MemoryStore is a Store keeping factors in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	factors map[string][]*Factor
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{factors: make(map[string][]*Factor)}
+}
+
+// Create implements Store.
+func (m *MemoryStore) Create(_ context.Context, factor *Factor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.factors[factor.User] = append(m.factors[factor.User], factor.clone())
+	return nil
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(_ context.Context, user, id string) (*Factor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(user, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.factors[user][i].clone(), nil
+}
+
+// List implements Store.
+func (m *MemoryStore) List(_ context.Context, user string) ([]*Factor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	factors := make([]*Factor, len(m.factors[user]))
+	for i, f := range m.factors[user] {
+		factors[i] = f.clone()
+	}
+	return factors, nil
+}
+
+// Update implements Store.
+func (m *MemoryStore) Update(_ context.Context, user, id string, fn func(*Factor) error) (*Factor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(user, id)
+	if err != nil {
+		return nil, err
+	}
+	factor := m.factors[user][i].clone()
+	if err := fn(factor); err != nil {
+		return nil, err
+	}
+	m.factors[user][i] = factor.clone()
+	return factor, nil
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(_ context.Context, user, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(user, id)
+	if err != nil {
+		return err
+	}
+	factors := m.factors[user]
+	m.factors[user] = append(factors[:i:i], factors[i+1:]...)
+	if len(m.factors[user]) == 0 {
+		delete(m.factors, user)
+	}
+	return nil
+}
+
+// DeleteAll implements Store.
+func (m *MemoryStore) DeleteAll(_ context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.factors, user)
+	return nil
+}
+
+func (m *MemoryStore) find(user, id string) (int, error) {
+	for i, f := range m.factors[user] {
+		if f.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownFactor, id)
+}
@@ -0,0 +1,117 @@
+package factors
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDigits = 6
+	defaultPeriod = 30 * time.Second
+	secretSize    = 20
+)
+
+// b32 is the unpadded base32 encoding authenticator apps expect.
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP computes time-based one-time passwords as specified by RFC 6238,
+// with HMAC-SHA1, which every authenticator app supports.
+type TOTP struct {
+	Secret []byte
+	// Digits is the length of the codes. Defaults to 6.
+	Digits int
+	// Period is how long each code is valid. Defaults to 30 seconds.
+	Period time.Duration
+}
+
+// NewTOTPSecret returns a random 160 bit secret, as RFC 4226 recommends.
+func NewTOTPSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (t TOTP) digits() int {
+	if t.Digits == 0 {
+		return defaultDigits
+	}
+	return t.Digits
+}
+
+func (t TOTP) period() time.Duration {
+	if t.Period == 0 {
+		return defaultPeriod
+	}
+	return t.Period
+}
+
+// Counter returns the time step at.
+func (t TOTP) Counter(at time.Time) int64 {
+	return at.Unix() / int64(t.period()/time.Second)
+}
+
+// Code returns the code for the time step counter.
+func (t TOTP) Code(counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, t.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < t.digits(); i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.digits(), value%mod)
+}
+
+// Verify returns the time step of code if it is valid at at, allowing for
+// skew steps of clock drift either way.
+func (t TOTP) Verify(code string, at time.Time, skew int) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != t.digits() {
+		return 0, false
+	}
+	now := t.Counter(at)
+	var (
+		match int64
+		ok    bool
+	)
+	// check every step in the window, so timing does not reveal which one
+	// matched
+	for counter := now - int64(skew); counter <= now+int64(skew); counter++ {
+		if hmac.Equal([]byte(t.Code(counter)), []byte(code)) && !ok {
+			match, ok = counter, true
+		}
+	}
+	return match, ok
+}
+
+// URI returns the otpauth:// URI authenticator apps read from QR codes.
+func (t TOTP) URI(issuer, account string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	query := url.Values{}
+	query.Set("secret", b32.EncodeToString(t.Secret))
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(t.digits()))
+	query.Set("period", fmt.Sprint(int(t.period()/time.Second)))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
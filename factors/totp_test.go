@@ -0,0 +1,62 @@
+package factors
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTP_RFC6238(t *testing.T) {
+	totp := TOTP{Secret: []byte("12345678901234567890"), Digits: 8}
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		assert.Equal(t, tt.code, totp.Code(totp.Counter(at)), tt.unix)
+
+		counter, ok := totp.Verify(tt.code, at, 0)
+		assert.True(t, ok)
+		assert.Equal(t, totp.Counter(at), counter)
+	}
+}
+
+func TestTOTP_Verify(t *testing.T) {
+	totp := TOTP{Secret: []byte("12345678901234567890")}
+	at := time.Unix(1111111111, 0)
+	code := totp.Code(totp.Counter(at))
+	assert.Len(t, code, 6)
+
+	_, ok := totp.Verify(code, at.Add(30*time.Second), 1)
+	assert.True(t, ok)
+	_, ok = totp.Verify(code, at.Add(90*time.Second), 1)
+	assert.False(t, ok)
+	_, ok = totp.Verify(code[:3]+" "+code[3:], at, 0)
+	assert.True(t, ok)
+	_, ok = totp.Verify("12345", at, 1)
+	assert.False(t, ok)
+}
+
+func TestTOTP_URI(t *testing.T) {
+	totp := TOTP{Secret: []byte("12345678901234567890")}
+	u, err := url.Parse(totp.URI("Example Co", "alice@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Example Co:alice@example.com", u.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", u.Query().Get("secret"))
+	assert.Equal(t, "Example Co", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+	assert.Equal(t, "30", u.Query().Get("period"))
+}
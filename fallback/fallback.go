@@ -0,0 +1,449 @@
+// Package fallback delivers a code over an ordered list of channels, moving
+// on to the next channel when delivery on the current one fails, for
+// example sending an SMS when an email bounces.
+//
+// Failures are learnt from a webhook, through ReportFailure or Handler, or
+// by polling GetOtp for the delivery status of the current channel, which
+// local providers report in DeliveryDetails.Statuses.
+//
+// A code is generated once and sent again on each next channel by services
+// that implement Resender, such as local.Provider with a resend key. The
+// FastOTP API cannot resend a code on another channel, so with other
+// services each step generates a new code, valid only for what is left of
+// the first code's validity.
+package fallback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+var (
+	// ErrNoChannels is returned by Start for a payload without channels.
+	ErrNoChannels = errors.New("no delivery channels")
+	// ErrUnknownOTP is returned by ReportFailure for an OTP no run is
+	// waiting on.
+	ErrUnknownOTP = errors.New("no run for otp")
+)
+
+const defaultPollInterval = 5 * time.Second
+
+// Service is the part of fastotp.FastOTP a Fallback uses. local.Provider
+// implements it too.
+type Service interface {
+	GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error)
+	GetOtp(ctx context.Context, id string) (*fastotp.OTP, error)
+}
+
+// Resender is implemented by services that can deliver the code of a
+// pending OTP again, to other targets, such as local.Provider. A Fallback
+// whose Service implements it sends the first code on every channel. It
+// only generates a new code when ResendOTP fails with
+// fastotp.ErrCannotResend.
+type Resender interface {
+	ResendOTP(ctx context.Context, id string, delivery fastotp.OTPDelivery) (*fastotp.OTP, error)
+}
+
+// Canceller is implemented by services that can cancel a pending OTP, such
+// as fastotp.FastOTP. A Fallback whose Service implements it cancels each
+// code once a later step has replaced it with a new one. fastotp.FastOTP
+// cannot cancel codes at the API: a replaced code is only rejected by the
+// FastOTP instances sharing its CancelStore.
+type Canceller interface {
+	CancelOTP(ctx context.Context, id string) (*fastotp.OTP, error)
+}
+
+// Channel is a delivery channel and the recipient's address on it.
+type Channel struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+}
+
+// Payload is a GenerateOTPPayload whose channels are tried in order.
+type Payload struct {
+	Channels    []Channel
+	Identifier  string
+	Type        fastotp.OTPType
+	TokenLength int
+	// Validity, in seconds, covers all the steps together.
+	Validity int
+}
+
+// Event is what happened in a step.
+type Event string
+
+const (
+	// EventSent is recorded when a code was sent on a channel.
+	EventSent Event = "sent"
+	// EventFailed is recorded when delivery on a channel failed.
+	EventFailed Event = "failed"
+	// EventError is recorded when a code could not be sent on a channel.
+	EventError Event = "error"
+	// EventValidated is recorded when the code was validated.
+	EventValidated Event = "validated"
+	// EventExpired is recorded when the validity window ended.
+	EventExpired Event = "expired"
+	// EventExhausted is recorded when every channel failed.
+	EventExhausted Event = "exhausted"
+	// EventCancelled is recorded when the run was cancelled.
+	EventCancelled Event = "cancelled"
+)
+
+// Step is an entry of a run's audit trail.
+type Step struct {
+	Time    time.Time `json:"time"`
+	Event   Event     `json:"event"`
+	Channel string    `json:"channel,omitempty"`
+	OTPID   string    `json:"otp_id,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Fallback runs channel fallbacks.
+//
+// Unless the Service is a Resender, every step of a run calls GenerateOTP
+// for a new code, so a run over three channels may generate three codes,
+// each valid for what is left of the run's window. Unless the Service is
+// also a Canceller, earlier codes keep validating until that window ends.
+type Fallback struct {
+	service      Service
+	pollInterval time.Duration
+	onStep       func(run *Run, step Step)
+	now          func() time.Time
+
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+// Option configures a Fallback.
+type Option func(*Fallback)
+
+// WithPollInterval sets how often GetOtp is polled for the delivery status.
+// Defaults to 5s; 0 disables polling, leaving failures to the webhook and
+// the run to end when its validity window does.
+func WithPollInterval(d time.Duration) Option {
+	return func(f *Fallback) {
+		f.pollInterval = d
+	}
+}
+
+// WithOnStep calls fn with every step as it is recorded, for example to
+// write it to an audit log.
+func WithOnStep(fn func(run *Run, step Step)) Option {
+	return func(f *Fallback) {
+		f.onStep = fn
+	}
+}
+
+// New creates a new Fallback generating codes with service.
+func New(service Service, opts ...Option) *Fallback {
+	f := &Fallback{
+		service:      service,
+		pollInterval: defaultPollInterval,
+		now:          time.Now,
+		runs:         make(map[string]*Run),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+type failure struct {
+	otpID, channel, reason string
+}
+
+// Run is the delivery of one code over its channels.
+type Run struct {
+	fallback *Fallback
+	payload  Payload
+	deadline time.Time
+	failures chan failure
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu    sync.Mutex
+	otp   *fastotp.OTP
+	step  int
+	trail []Step
+}
+
+// Start generates a code for the first channel that accepts one, and keeps
+// watching it in the background until it is validated, its window ends or
+// every channel failed. The run is not tied to ctx, so it outlives the
+// request that started it; use Cancel to stop it.
+func (f *Fallback) Start(ctx context.Context, payload Payload) (*Run, error) {
+	if len(payload.Channels) == 0 {
+		return nil, ErrNoChannels
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	r := &Run{
+		fallback: f,
+		payload:  payload,
+		deadline: f.now().Add(time.Duration(payload.Validity) * time.Second),
+		failures: make(chan failure, len(payload.Channels)),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	if err := r.advance(ctx, 0); err != nil {
+		cancel()
+		close(r.done)
+		return r, err
+	}
+	go r.watch(runCtx)
+	return r, nil
+}
+
+// ReportFailure tells the run waiting on otpID that delivery on channel
+// failed, moving it on to its next channel. An empty channel stands for the
+// run's current channel.
+func (f *Fallback) ReportFailure(otpID, channel, reason string) error {
+	f.mu.Lock()
+	r, ok := f.runs[otpID]
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownOTP, otpID)
+	}
+
+	select {
+	case r.failures <- failure{otpID: otpID, channel: channel, reason: reason}:
+	default:
+		// a failure for this run is already waiting
+	}
+	return nil
+}
+
+// webhookPayload is the body Handler accepts.
+type webhookPayload struct {
+	OTPID   string `json:"otp_id"`
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+}
+
+// Handler returns a webhook endpoint for delivery reports, accepting JSON
+// bodies like {"otp_id": "...", "channel": "email", "status": "failed",
+// "reason": "bounced"}. Reports with another status are acknowledged and
+// ignored. Put it behind whatever authentication the sender supports.
+func (f *Fallback) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var report webhookPayload
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&report); err != nil || report.OTPID == "" {
+			http.Error(w, "invalid delivery report", http.StatusBadRequest)
+			return
+		}
+		if report.Status != string(fastotp.DeliveryStateFailed) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := f.ReportFailure(report.OTPID, report.Channel, report.Reason); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// OTP returns the OTP of the current step.
+func (r *Run) OTP() *fastotp.OTP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.otp == nil {
+		return nil
+	}
+	otp := *r.otp
+	return &otp
+}
+
+// Trail returns the steps recorded so far.
+func (r *Run) Trail() []Step {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Step(nil), r.trail...)
+}
+
+// Done is closed when the run has ended.
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+// Cancel stops the run. Codes already sent stay valid.
+func (r *Run) Cancel() {
+	r.cancel()
+}
+
+func (r *Run) record(step Step) {
+	step.Time = r.fallback.now().UTC()
+	r.mu.Lock()
+	r.trail = append(r.trail, step)
+	r.mu.Unlock()
+
+	if r.fallback.onStep != nil {
+		r.fallback.onStep(r, step)
+	}
+}
+
+// advance sends the code on the first channel from index on that takes it,
+// and makes it the current step.
+func (r *Run) advance(ctx context.Context, index int) error {
+	var lastErr error
+	for ; index < len(r.payload.Channels); index++ {
+		channel := r.payload.Channels[index]
+
+		left := r.deadline.Sub(r.fallback.now())
+		if left <= 0 {
+			r.record(Step{Event: EventExpired, Channel: channel.Name})
+			return nil
+		}
+
+		r.mu.Lock()
+		previous := r.otp
+		r.mu.Unlock()
+
+		otp, err := r.send(ctx, previous, channel, left)
+		if err != nil {
+			lastErr = err
+			r.record(Step{Event: EventError, Channel: channel.Name, Detail: err.Error()})
+			continue
+		}
+
+		r.mu.Lock()
+		r.otp = otp
+		r.step = index
+		r.mu.Unlock()
+
+		r.fallback.mu.Lock()
+		if previous != nil {
+			delete(r.fallback.runs, previous.ID)
+		}
+		r.fallback.runs[otp.ID] = r
+		r.fallback.mu.Unlock()
+
+		r.record(Step{Event: EventSent, Channel: channel.Name, OTPID: otp.ID})
+		if canceller, ok := r.fallback.service.(Canceller); ok && previous != nil && previous.ID != otp.ID {
+			// best effort: the superseded code expires with the window anyway
+			_, _ = canceller.CancelOTP(ctx, previous.ID)
+		}
+		return nil
+	}
+
+	r.record(Step{Event: EventExhausted})
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("%w: every channel failed", fastotp.ErrNoDeliveryChannel)
+}
+
+// send resends previous on channel if the Service can, and otherwise
+// generates a new code valid for left.
+func (r *Run) send(ctx context.Context, previous *fastotp.OTP, channel Channel, left time.Duration) (*fastotp.OTP, error) {
+	delivery := fastotp.OTPDelivery{channel.Name: channel.Target}
+	if resender, ok := r.fallback.service.(Resender); ok && previous != nil {
+		otp, err := resender.ResendOTP(ctx, previous.ID, delivery)
+		if !errors.Is(err, fastotp.ErrCannotResend) {
+			return otp, err
+		}
+	}
+
+	return r.fallback.service.GenerateOTP(ctx, fastotp.GenerateOTPPayload{
+		Delivery:    delivery,
+		Identifier:  r.payload.Identifier,
+		Type:        r.payload.Type,
+		TokenLength: r.payload.TokenLength,
+		Validity:    int(math.Ceil(left.Seconds())),
+	})
+}
+
+// current returns the OTP and channel of the current step, or nil when the
+// run has no more steps.
+func (r *Run) current() (*fastotp.OTP, Channel, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.otp, r.payload.Channels[r.step], r.step
+}
+
+func (r *Run) ended() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.trail) == 0 {
+		return false
+	}
+	switch r.trail[len(r.trail)-1].Event {
+	case EventExpired, EventExhausted:
+		return true
+	}
+	return false
+}
+
+// watch waits for the current step to fail, be validated or expire.
+func (r *Run) watch(ctx context.Context) {
+	defer func() {
+		r.fallback.mu.Lock()
+		if otp := r.OTP(); otp != nil {
+			delete(r.fallback.runs, otp.ID)
+		}
+		r.fallback.mu.Unlock()
+		close(r.done)
+	}()
+
+	var poll <-chan time.Time
+	if r.fallback.pollInterval > 0 {
+		ticker := time.NewTicker(r.fallback.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for !r.ended() {
+		otp, channel, index := r.current()
+		expiry := time.NewTimer(r.deadline.Sub(r.fallback.now()))
+
+		var failed *failure
+		select {
+		case <-ctx.Done():
+			expiry.Stop()
+			r.record(Step{Event: EventCancelled, Channel: channel.Name, OTPID: otp.ID})
+			return
+		case <-expiry.C:
+			r.record(Step{Event: EventExpired, Channel: channel.Name, OTPID: otp.ID})
+			return
+		case f := <-r.failures:
+			if f.otpID == otp.ID && (f.channel == "" || f.channel == channel.Name) {
+				failed = &f
+			}
+		case <-poll:
+			latest, err := r.fallback.service.GetOtp(ctx, otp.ID)
+			if err != nil {
+				break
+			}
+			if latest.Status == fastotp.OTPStatusValidated {
+				expiry.Stop()
+				r.record(Step{Event: EventValidated, Channel: channel.Name, OTPID: otp.ID})
+				return
+			}
+			if status, ok := latest.DeliveryDetails.Statuses[channel.Name]; ok && status.State == fastotp.DeliveryStateFailed {
+				failed = &failure{otpID: otp.ID, channel: channel.Name, reason: status.Error}
+			}
+		}
+		expiry.Stop()
+
+		if failed != nil {
+			r.record(Step{Event: EventFailed, Channel: channel.Name, OTPID: otp.ID, Detail: failed.reason})
+			if err := r.advance(ctx, index+1); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/local"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeService issues OTPs in memory. Channels listed in reject fail to
+// generate; the test changes OTPs through update.
+type fakeService struct {
+	mu       sync.Mutex
+	otps     map[string]*fastotp.OTP
+	payloads []fastotp.GenerateOTPPayload
+	reject   map[string]bool
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{otps: map[string]*fastotp.OTP{}, reject: map[string]bool{}}
+}
+
+func (s *fakeService) GenerateOTP(_ context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payloads = append(s.payloads, payload)
+	for channel := range payload.Delivery {
+		if s.reject[channel] {
+			return nil, errors.New("gateway down")
+		}
+	}
+	otp := &fastotp.OTP{ID: fmt.Sprintf("otp-%d", len(s.payloads)), Identifier: payload.Identifier, Status: fastotp.OTPStatusPending}
+	s.otps[otp.ID] = otp
+	copied := *otp
+	return &copied, nil
+}
+
+func (s *fakeService) GetOtp(_ context.Context, id string) (*fastotp.OTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	otp, ok := s.otps[id]
+	if !ok {
+		return nil, &fastotp.APIError{StatusCode: http.StatusNotFound}
+	}
+	copied := *otp
+	return &copied, nil
+}
+
+func (s *fakeService) update(id string, fn func(otp *fastotp.OTP)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.otps[id])
+}
+
+func (s *fakeService) sent() []fastotp.GenerateOTPPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fastotp.GenerateOTPPayload(nil), s.payloads...)
+}
+
+// cancellingService is a fakeService that can cancel OTPs.
+type cancellingService struct {
+	*fakeService
+}
+
+func (s cancellingService) CancelOTP(_ context.Context, id string) (*fastotp.OTP, error) {
+	var copied fastotp.OTP
+	s.update(id, func(otp *fastotp.OTP) {
+		otp.Status = fastotp.OTPStatusCancelled
+		copied = *otp
+	})
+	return &copied, nil
+}
+
+var (
+	_ Canceller = cancellingService{}
+	_ Canceller = (*fastotp.FastOTP)(nil)
+	_ Resender  = (*local.Provider)(nil)
+)
+
+var payload = Payload{
+	Channels:    []Channel{{Name: "email", Target: "user@example.com"}, {Name: "sms", Target: "+1"}, {Name: "whatsapp", Target: "+1"}},
+	Identifier:  "user",
+	Type:        fastotp.OTPTypeNumeric,
+	TokenLength: 6,
+	Validity:    300,
+}
+
+func events(trail []Step) []string {
+	var out []string
+	for _, step := range trail {
+		out = append(out, string(step.Event)+":"+step.Channel)
+	}
+	return out
+}
+
+func waitDone(t *testing.T, run *Run) {
+	t.Helper()
+	select {
+	case <-run.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not end")
+	}
+}
+
+func TestFallback_WebhookFailure(t *testing.T) {
+	service := newFakeService()
+	var mu sync.Mutex
+	var observed []Step
+	f := New(service, WithPollInterval(0), WithOnStep(func(run *Run, step Step) {
+		mu.Lock()
+		observed = append(observed, step)
+		mu.Unlock()
+	}))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	first := run.OTP()
+	assert.Equal(t, "otp-1", first.ID)
+
+	// a report for another channel is ignored
+	require.NoError(t, f.ReportFailure(first.ID, "sms", "bounced"))
+	require.NoError(t, f.ReportFailure(first.ID, "email", "bounced"))
+	assert.Eventually(t, func() bool { return run.OTP().ID == "otp-2" }, time.Second, time.Millisecond)
+
+	// reports about the replaced OTP are rejected
+	assert.ErrorIs(t, f.ReportFailure(first.ID, "", "late"), ErrUnknownOTP)
+
+	run.Cancel()
+	waitDone(t, run)
+
+	assert.Equal(t, []string{"sent:email", "failed:email", "sent:sms", "cancelled:sms"}, events(run.Trail()))
+	assert.Equal(t, "bounced", run.Trail()[1].Detail)
+	mu.Lock()
+	assert.Equal(t, run.Trail(), observed)
+	mu.Unlock()
+
+	sent := service.sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, fastotp.OTPDelivery{"sms": "+1"}, sent[1].Delivery)
+	assert.LessOrEqual(t, sent[1].Validity, 300)
+}
+
+func TestFallback_CancelsSupersededCodes(t *testing.T) {
+	service := newFakeService()
+	f := New(cancellingService{service}, WithPollInterval(0))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	defer run.Cancel()
+
+	require.NoError(t, f.ReportFailure("otp-1", "", "bounced"))
+	assert.Eventually(t, func() bool {
+		otp, err := service.GetOtp(context.Background(), "otp-1")
+		return err == nil && otp.Status == fastotp.OTPStatusCancelled
+	}, time.Second, time.Millisecond)
+
+	current, err := service.GetOtp(context.Background(), run.OTP().ID)
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusPending, current.Status)
+}
+
+// deliveries records the codes a local.Provider delivers, by channel.
+type deliveries struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func (d *deliveries) Deliver(_ context.Context, _ *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for channel := range delivery {
+		d.codes[channel] = token
+	}
+	return nil
+}
+
+func (d *deliveries) code(channel string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.codes[channel]
+}
+
+func TestFallback_ResendsTheSameCode(t *testing.T) {
+	box := &deliveries{codes: map[string]string{}}
+	f := New(local.New(box, local.WithResendKey([]byte("resend-key"))), WithPollInterval(0))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	defer run.Cancel()
+	first := run.OTP()
+
+	require.NoError(t, f.ReportFailure(first.ID, "email", "bounced"))
+	assert.Eventually(t, func() bool { return len(run.Trail()) == 3 }, time.Second, time.Millisecond)
+
+	assert.Equal(t, []string{"sent:email", "failed:email", "sent:sms"}, events(run.Trail()))
+	assert.Equal(t, box.code("email"), box.code("sms"))
+	assert.Equal(t, first.ID, run.Trail()[2].OTPID)
+}
+
+func TestFallback_GeneratesWhenResendIsUnavailable(t *testing.T) {
+	box := &deliveries{codes: map[string]string{}}
+	f := New(local.New(box), WithPollInterval(0))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	defer run.Cancel()
+	first := run.OTP()
+
+	require.NoError(t, f.ReportFailure(first.ID, "email", "bounced"))
+	assert.Eventually(t, func() bool { return run.OTP().ID != first.ID }, time.Second, time.Millisecond)
+}
+
+func TestFallback_ValidityWindowIsShared(t *testing.T) {
+	service := newFakeService()
+	f := New(service, WithPollInterval(0))
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+
+	now = now.Add(100 * time.Second)
+	require.NoError(t, f.ReportFailure(run.OTP().ID, "", "bounced"))
+	assert.Eventually(t, func() bool { return len(service.sent()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 200, service.sent()[1].Validity)
+	run.Cancel()
+	waitDone(t, run)
+}
+
+func TestFallback_PollingFailureAndValidation(t *testing.T) {
+	service := newFakeService()
+	f := New(service, WithPollInterval(time.Millisecond))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+
+	service.update("otp-1", func(otp *fastotp.OTP) {
+		otp.DeliveryDetails.Statuses = map[string]fastotp.DeliveryStatus{
+			"email": {State: fastotp.DeliveryStateFailed, Error: "mailbox full"},
+		}
+	})
+	assert.Eventually(t, func() bool { return run.OTP().ID == "otp-2" }, time.Second, time.Millisecond)
+
+	service.update("otp-2", func(otp *fastotp.OTP) { otp.Status = fastotp.OTPStatusValidated })
+	waitDone(t, run)
+
+	assert.Equal(t, []string{"sent:email", "failed:email", "sent:sms", "validated:sms"}, events(run.Trail()))
+	assert.Equal(t, "mailbox full", run.Trail()[1].Detail)
+}
+
+func TestFallback_GenerateErrorsMoveOn(t *testing.T) {
+	service := newFakeService()
+	service.reject["email"] = true
+	f := New(service, WithPollInterval(0))
+
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error:email", "sent:sms"}, events(run.Trail()))
+
+	require.NoError(t, f.ReportFailure(run.OTP().ID, "", "undeliverable"))
+	assert.Eventually(t, func() bool { return run.OTP().ID == "otp-3" }, time.Second, time.Millisecond)
+	require.NoError(t, f.ReportFailure(run.OTP().ID, "", "undeliverable"))
+	waitDone(t, run)
+
+	assert.Equal(t, []string{"error:email", "sent:sms", "failed:sms", "sent:whatsapp", "failed:whatsapp", "exhausted:"}, events(run.Trail()))
+}
+
+func TestFallback_AllChannelsFailToGenerate(t *testing.T) {
+	service := newFakeService()
+	service.reject["email"], service.reject["sms"], service.reject["whatsapp"] = true, true, true
+
+	run, err := New(service).Start(context.Background(), payload)
+	assert.Error(t, err)
+	waitDone(t, run)
+	assert.Equal(t, "exhausted:", events(run.Trail())[3])
+
+	_, err = New(service).Start(context.Background(), Payload{})
+	assert.ErrorIs(t, err, ErrNoChannels)
+}
+
+func TestFallback_Expiry(t *testing.T) {
+	service := newFakeService()
+	p := payload
+	p.Validity = 1
+
+	run, err := New(service, WithPollInterval(0)).Start(context.Background(), p)
+	require.NoError(t, err)
+	waitDone(t, run)
+	assert.Equal(t, []string{"sent:email", "expired:email"}, events(run.Trail()))
+}
+
+func TestFallback_Handler(t *testing.T) {
+	service := newFakeService()
+	f := New(service, WithPollInterval(0))
+	run, err := f.Start(context.Background(), payload)
+	require.NoError(t, err)
+	defer run.Cancel()
+
+	post := func(body string) int {
+		w := httptest.NewRecorder()
+		f.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{`))
+	assert.Equal(t, http.StatusNoContent, post(`{"otp_id":"otp-1","channel":"email","status":"delivered"}`))
+	assert.Equal(t, http.StatusNotFound, post(`{"otp_id":"otp-9","status":"failed"}`))
+	assert.Equal(t, http.StatusNoContent, post(`{"otp_id":"otp-1","channel":"email","status":"failed","reason":"bounced"}`))
+	assert.Eventually(t, func() bool { return run.OTP().ID == "otp-2" }, time.Second, time.Millisecond)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	httpclient "github.com/CeoFred/fast-otp/lib"
@@ -14,11 +15,36 @@ const (
 	baseURL = "https://api.fastotp.co"
 )
 
+// ErrCircuitOpen is returned when a request is rejected because the API
+// endpoint's circuit breaker is open. See WithCircuitBreaker.
+var ErrCircuitOpen = httpclient.ErrCircuitOpen
+
 // FastOTP is the main struct for the FastOtp package.
 type FastOTP struct {
-	apiKey  string
-	baseURL string
-	client  HttpClient
+	apiKey     string
+	baseURL    string
+	client     HttpClient
+	clientOpts []httpclient.Option
+
+	cache       Cache
+	cacheTTL    time.Duration
+	cacheHits   uint64
+	cacheMisses uint64
+	flight      flightGroup
+
+	policiesMu sync.RWMutex
+	policies   map[string]Policy
+	tracker    policyTracker
+
+	auditSinks []AuditSink
+	auditKey   []byte
+
+	pseudonymizer *Pseudonymizer
+	subjects      subjectIndex
+	cancelled     cancelledSet
+	cancelStore   CancelStore
+
+	validators []PayloadValidator
 }
 
 // ErrorResponse is the error struct for the FastOtp package.
@@ -48,6 +74,28 @@ type OTPResponse struct {
 // DeliveryDetails is the struct for the DeliveryDetails object.
 type DeliveryDetails struct {
 	Email string `json:"email"`
+	// Statuses reports how delivery went on each channel, for codes that
+	// are delivered locally rather than by the API.
+	Statuses map[string]DeliveryStatus `json:"statuses,omitempty"`
+}
+
+// DeliveryStatus is the outcome of delivering a code on one channel.
+type DeliveryStatus struct {
+	State       DeliveryState `json:"state"`
+	Attempts    int           `json:"attempts"`
+	Error       string        `json:"error,omitempty"`
+	DeliveredAt time.Time     `json:"delivered_at"`
+}
+
+func (d DeliveryDetails) clone() DeliveryDetails {
+	if d.Statuses != nil {
+		statuses := make(map[string]DeliveryStatus, len(d.Statuses))
+		for channel, status := range d.Statuses {
+			statuses[channel] = status
+		}
+		d.Statuses = statuses
+	}
+	return d
 }
 
 // OTPDelivery is the struct for the OtpDelivery object.
@@ -69,89 +117,178 @@ type ValidateOTPPayload struct {
 }
 
 // NewFastOTP creates a new FastOtp instance.
-func NewFastOTP(apiKey string) *FastOTP {
-	return &FastOTP{
+func NewFastOTP(apiKey string, opts ...Option) *FastOTP {
+	f := &FastOTP{
 		apiKey:  apiKey,
 		baseURL: baseURL,
-		client:  httpclient.NewAPIClient(baseURL, apiKey),
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.client == nil {
+		f.client = httpclient.NewAPIClient(f.baseURL, apiKey, f.clientOpts...)
+	}
+	return f
+}
+
+// String describes the instance without revealing its API key.
+func (f *FastOTP) String() string {
+	return fmt.Sprintf("FastOTP{baseURL: %s, apiKey: [REDACTED]}", f.baseURL)
+}
+
+// GoString describes the instance without revealing its API key.
+func (f *FastOTP) GoString() string {
+	return f.String()
 }
 
 func (f *FastOTP) GenerateOTP(ctx context.Context, payload GenerateOTPPayload) (*OTP, error) {
-	resp, err := f.client.Post(ctx, "/generate", payload)
+	otp, err := f.generateOTP(ctx, payload)
+	f.audit(ctx, AuditGenerate, "", payload.Identifier, otpID(otp), err)
+	return otp, err
+}
+
+func (f *FastOTP) generateOTP(ctx context.Context, payload GenerateOTPPayload) (*OTP, error) {
+	if len(f.validators) > 0 && payload.Delivery != nil {
+		// validators may rewrite the caller's delivery targets
+		delivery := make(OTPDelivery, len(payload.Delivery))
+		for channel, target := range payload.Delivery {
+			delivery[channel] = target
+		}
+		payload.Delivery = delivery
+	}
+	for _, v := range f.validators {
+		if err := v.ValidatePayload(ctx, &payload); err != nil {
+			return nil, err
+		}
+	}
+
+	identifier := payload.Identifier
+	if f.pseudonymizer != nil {
+		payload.Identifier = f.pseudonymizer.Pseudonym(identifier)
+	}
+
+	otp, err := f.post(ctx, "/generate", payload)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	f.unpseudonymize(otp, identifier)
+	return otp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		var errorResponse ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-			return nil, err
-		}
+func (f *FastOTP) ValidateOTP(ctx context.Context, payload ValidateOTPPayload) (*OTP, error) {
+	otp, err := f.validateOTP(ctx, payload)
+	f.audit(ctx, AuditValidate, "", payload.Identifier, otpID(otp), err)
+	return otp, err
+}
 
-		if len(errorResponse.Errors) > 0 {
-			return nil, formatValidationError(errorResponse.Errors)
-		}
+func (f *FastOTP) validateOTP(ctx context.Context, payload ValidateOTPPayload) (*OTP, error) {
+	identifier := payload.Identifier
+	identifiers := []string{identifier}
+	if f.pseudonymizer != nil {
+		identifiers = f.pseudonymizer.pseudonyms(identifier)
+	}
 
-		return nil, fmt.Errorf("API error: %s", errorResponse.Message)
+	var (
+		otp *OTP
+		err error
+	)
+	for i, sent := range identifiers {
+		payload.Identifier = sent
+		otp, err = f.post(ctx, "/validate", payload)
+		// the code may have been issued under a previous key
+		if i < len(identifiers)-1 && isRejected(err) {
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	var otpResponse OTPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&otpResponse); err != nil {
+	f.unpseudonymize(otp, identifier)
+	cancelled, err := f.cancellations().Cancelled(ctx, otp.ID)
+	if err != nil {
 		return nil, err
 	}
+	if cancelled {
+		return nil, ErrOTPCancelled
+	}
+	f.cacheOtp(ctx, otp)
 
-	return &otpResponse.OTP, nil
+	return otp, nil
 }
 
-func (f *FastOTP) ValidateOTP(ctx context.Context, payload ValidateOTPPayload) (*OTP, error) {
-	resp, err := f.client.Post(ctx, "/validate", payload)
+func (f *FastOTP) post(ctx context.Context, path string, payload interface{}) (*OTP, error) {
+	resp, err := f.client.Post(ctx, path, payload)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errorResponse ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-			return nil, err
-		}
-
-		if len(errorResponse.Errors) > 0 {
-			return nil, formatValidationError(errorResponse.Errors)
-		}
+	return decodeOTPResponse(resp)
+}
 
-		return nil, fmt.Errorf("API error: %s", errorResponse.Message)
+// GetOtp gets a new otp
+func (f *FastOTP) GetOtp(ctx context.Context, id string) (*OTP, error) {
+	var otp *OTP
+	var err error
+	if f.cache != nil {
+		otp, err = f.getCachedOtp(ctx, id)
+	} else {
+		otp, err = f.getOtp(ctx, id)
 	}
 
-	var otpResponse OTPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&otpResponse); err != nil {
-		return nil, err
+	if otp != nil {
+		var cancelled bool
+		if cancelled, err = f.cancellations().Cancelled(ctx, otp.ID); err != nil {
+			otp = nil
+		} else if cancelled {
+			otp.Status = OTPStatusCancelled
+		}
 	}
 
-	return &otpResponse.OTP, nil
+	identifier := ""
+	if otp != nil {
+		identifier = otp.Identifier
+	}
+	f.audit(ctx, AuditGet, "", identifier, id, err)
+	return otp, err
 }
 
-// GetOtp gets a new otp
-func (f *FastOTP) GetOtp(ctx context.Context, id string) (*OTP, error) {
+func (f *FastOTP) getOtp(ctx context.Context, id string) (*OTP, error) {
 	resp, err := f.client.Get(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	otp, err := decodeOTPResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if f.pseudonymizer != nil {
+		if identifier, ok := f.pseudonymizer.Identifier(otp.Identifier); ok {
+			otp.Identifier = identifier
+		}
+	}
+	return otp, nil
+}
+
+// decodeOTPResponse decodes the OTP from a successful response, or the
+// *APIError from a failed one.
+func decodeOTPResponse(resp *http.Response) (*OTP, error) {
 	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+
 		var errorResponse ErrorResponse
 		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-			return nil, err
-		}
-
-		if len(errorResponse.Errors) > 0 {
-			return nil, formatValidationError(errorResponse.Errors)
+			apiErr.Message = http.StatusText(resp.StatusCode)
+			return nil, apiErr
 		}
 
-		return nil, fmt.Errorf("API error: %s", errorResponse.Message)
+		apiErr.Message = errorResponse.Message
+		apiErr.Errors = errorResponse.Errors
+		return nil, apiErr
 	}
 
 	var otpResponse OTPResponse
@@ -161,13 +298,3 @@ func (f *FastOTP) GetOtp(ctx context.Context, id string) (*OTP, error) {
 
 	return &otpResponse.OTP, nil
 }
-
-func formatValidationError(errors map[string][]string) error {
-	var errorMessage string
-	for field, fieldErrors := range errors {
-		for _, err := range fieldErrors {
-			errorMessage += fmt.Sprintf("%s: %s\n", field, err)
-		}
-	}
-	return fmt.Errorf("validation errors:\n%s", errorMessage)
-}
@@ -119,6 +119,38 @@ func TestGenerateOTP(t *testing.T) {
 	assert.Equal(t, "9b202659-fee7-46ab-836b-cdd310c4f327", otp.ID)
 }
 
+func TestGenerateOTP_PayloadValidator(t *testing.T) {
+	var sent []GenerateOTPPayload
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPayloadValidator(PayloadValidatorFunc(func(ctx context.Context, payload *GenerateOTPPayload) error {
+			if payload.Delivery["sms"] == "" {
+				return &APIError{StatusCode: http.StatusUnprocessableEntity, Errors: map[string][]string{"delivery.sms": {"is required"}}}
+			}
+			payload.Delivery["sms"] = "+2348012345678"
+			return nil
+		})),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				sent = append(sent, payload.(GenerateOTPPayload))
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1"}})
+			},
+		}),
+	)
+
+	delivery := OTPDelivery{"sms": "08012345678"}
+	_, err := fastOtp.GenerateOTP(context.TODO(), GenerateOTPPayload{Delivery: delivery, Identifier: "user123"})
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "+2348012345678", sent[0].Delivery["sms"])
+	assert.Equal(t, "08012345678", delivery["sms"], "the caller's delivery is left alone")
+
+	_, err = fastOtp.GenerateOTP(context.TODO(), GenerateOTPPayload{Delivery: OTPDelivery{"email": "user@example.com"}, Identifier: "user123"})
+	apiErr, ok := AsAPIError(err)
+	require.True(t, ok)
+	assert.Contains(t, apiErr.Errors, "delivery.sms")
+	assert.Len(t, sent, 1)
+}
+
 func TestGenerateOTP_500Response(t *testing.T) {
 	reset := mockErrorHttpRequest(500, http.MethodPost, "/generate", "")
 	defer reset()
@@ -471,3 +503,11 @@ func mockErrorHttpRequest(code int, method, path, response string) func() {
 	})
 	return httpmock.DeactivateAndReset
 }
+
+func TestFastOtp_StringHidesAPIKey(t *testing.T) {
+	fastOtp := NewFastOTP("super-secret-key")
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		assert.NotContains(t, fmt.Sprintf(format, fastOtp), "super-secret-key", format)
+	}
+}
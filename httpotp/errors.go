@@ -0,0 +1,134 @@
+package httpotp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// Error codes used in JSON error bodies.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidCode      = "invalid_code"
+	CodeRejected         = "rejected"
+	CodeRateLimited      = "rate_limited"
+	CodeLockedOut        = "locked_out"
+	CodeForbidden        = "forbidden"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnavailable      = "unavailable"
+	CodeTimeout          = "timeout"
+	CodeUpstreamError    = "upstream_error"
+	CodeInternal         = "internal_error"
+)
+
+var errInvalidCode = errors.New("invalid or expired code")
+
+// Error is an error answered to the client. It is written as
+//
+//	{"error": {"code": "...", "message": "...", "fields": {...}}}
+type Error struct {
+	Status     int                 `json:"-"`
+	Code       string              `json:"code"`
+	Message    string              `json:"message"`
+	Fields     map[string][]string `json:"fields,omitempty"`
+	RetryAfter time.Duration       `json:"-"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// RateLimited returns the error answered when a client has to slow down.
+func RateLimited(retryAfter time.Duration) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "too many requests", RetryAfter: retryAfter}
+}
+
+// LockedOut returns the error answered while an identifier is locked out.
+func LockedOut(retryAfter time.Duration) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: CodeLockedOut, Message: "too many failed attempts", RetryAfter: retryAfter}
+}
+
+// ErrorFor maps err, typically returned by fastotp.FastOTP, to the error
+// answered to the client. Requests the client can fix are answered with
+// 400, errors in how the server is set up with 500, and other errors are
+// taken for upstream failures, which are not described in detail.
+func ErrorFor(err error) *Error {
+	var httpErr *Error
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	switch {
+	case errors.Is(err, fastotp.ErrCircuitOpen):
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "service temporarily unavailable"}
+	case errors.Is(err, fastotp.ErrResendCooldown), errors.Is(err, fastotp.ErrMaxResends):
+		return &Error{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Message: err.Error()}
+	case errors.Is(err, fastotp.ErrMaxAttempts):
+		return LockedOut(0)
+	case isWrongCode(err):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidCode, Message: errInvalidCode.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: http.StatusGatewayTimeout, Code: CodeTimeout, Message: "request timed out"}
+	case errors.Is(err, fastotp.ErrUnknownPolicy):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request",
+			Fields: map[string][]string{"purpose": {"is not a known purpose"}}}
+	case errors.Is(err, fastotp.ErrNoDeliveryChannel):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request",
+			Fields: map[string][]string{"delivery": {"has no channel allowed for this purpose"}}}
+	case errors.Is(err, fastotp.ErrInvalidTransaction):
+		return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, fastotp.ErrUnknownTenant):
+		return &Error{Status: http.StatusBadRequest, Code: CodeRejected, Message: "unknown tenant"}
+	case errors.Is(err, fastotp.ErrNoTenant), errors.Is(err, fastotp.ErrCannotResend):
+		// the server passed no tenant, or relies on resends its service
+		// cannot do
+		return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error"}
+	}
+
+	if apiErr, ok := fastotp.AsAPIError(err); ok {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return RateLimited(0)
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			// our own API key was refused, which the client cannot fix
+		case len(apiErr.Errors) > 0:
+			return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request", Fields: apiErr.Errors}
+		case apiErr.IsClientError():
+			return &Error{Status: http.StatusBadRequest, Code: CodeRejected, Message: apiErr.Message}
+		}
+	}
+
+	return &Error{Status: http.StatusBadGateway, Code: CodeUpstreamError, Message: "could not reach the OTP service"}
+}
+
+// isWrongCode reports whether err means the code submitted for validation
+// was not accepted, which counts towards a lockout.
+func isWrongCode(err error) bool {
+	if errors.Is(err, errInvalidCode) ||
+		errors.Is(err, fastotp.ErrPurposeMismatch) ||
+		errors.Is(err, fastotp.ErrOTPCancelled) ||
+		errors.Is(err, fastotp.ErrTransactionMismatch) {
+		return true
+	}
+
+	apiErr, ok := fastotp.AsAPIError(err)
+	return ok && apiErr.IsClientError() && len(apiErr.Errors) == 0 &&
+		apiErr.StatusCode != http.StatusUnauthorized &&
+		apiErr.StatusCode != http.StatusForbidden &&
+		apiErr.StatusCode != http.StatusTooManyRequests
+}
+
+// WriteError writes the JSON error body for err.
+func WriteError(w http.ResponseWriter, err error) {
+	httpErr := ErrorFor(err)
+	if httpErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(httpErr.RetryAfter.Seconds()))))
+	}
+	writeJSON(w, httpErr.Status, map[string]*Error{"error": httpErr})
+}
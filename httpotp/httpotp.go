@@ -0,0 +1,322 @@
+// Package httpotp provides drop-in net/http handlers for the two endpoints
+// every OTP login flow needs: one that sends a code and one that checks it.
+//
+// The handlers are plain http.Handlers and Middleware is a plain
+// func(http.Handler) http.Handler, so they mount directly on net/http and
+// chi, and on gin and echo through gin.WrapH and echo.WrapHandler or
+// echo.WrapMiddleware.
+package httpotp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+const maxBodySize = 1 << 20
+
+// Service is the part of fastotp.FastOTP the handlers use.
+type Service interface {
+	GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error)
+	ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error)
+}
+
+// Values holds the fields of an incoming JSON or form request.
+type Values map[string]string
+
+// Get returns the value of field, or "" when it is missing.
+func (v Values) Get(field string) string {
+	return v[field]
+}
+
+// Config configures the handlers.
+type Config struct {
+	Service Service
+
+	// Defaults provides the Type, TokenLength and Validity used by the
+	// default GeneratePayload.
+	Defaults fastotp.GenerateOTPPayload
+	// Channels lists the request fields copied into the delivery of the
+	// default GeneratePayload. Defaults to "email".
+	Channels []string
+
+	// GeneratePayload maps a request to the payload sent to GenerateOTP.
+	// The default reads "identifier" and the fields named by Channels.
+	GeneratePayload func(r *http.Request, values Values) (fastotp.GenerateOTPPayload, error)
+	// ValidatePayload maps a request to the payload sent to ValidateOTP.
+	// The default reads "identifier" and "token".
+	ValidatePayload func(r *http.Request, values Values) (fastotp.ValidateOTPPayload, error)
+
+	// RateLimiter, if set, is consulted before a code is sent or checked.
+	RateLimiter RateLimiter
+	// Lockout, if set, blocks identifiers after repeated wrong codes.
+	Lockout Lockout
+	// CheckCSRF, if set, is called for form submissions before anything
+	// else, so a CSRF token can be checked.
+	CheckCSRF func(r *http.Request) error
+
+	// OnGenerated, if set, writes the response after a code was sent. The
+	// default answers 202 Accepted with the OTP's ID and expiry.
+	OnGenerated func(w http.ResponseWriter, r *http.Request, otp *fastotp.OTP)
+	// OnValidated, if set, writes the response after a code was accepted,
+	// for example with a session token. The default answers 200 OK with the
+	// OTP's ID and status.
+	OnValidated func(w http.ResponseWriter, r *http.Request, otp *fastotp.OTP)
+}
+
+func (c *Config) channels() []string {
+	if len(c.Channels) == 0 {
+		return []string{"email"}
+	}
+	return c.Channels
+}
+
+func (c *Config) generatePayload(r *http.Request, values Values) (fastotp.GenerateOTPPayload, error) {
+	if c.GeneratePayload != nil {
+		return c.GeneratePayload(r, values)
+	}
+
+	payload := c.Defaults
+	payload.Identifier = values.Get("identifier")
+	payload.Delivery = fastotp.OTPDelivery{}
+	for _, channel := range c.channels() {
+		if target := values.Get(channel); target != "" {
+			payload.Delivery[channel] = target
+		}
+	}
+
+	fields := map[string][]string{}
+	if payload.Identifier == "" {
+		fields["identifier"] = []string{"is required"}
+	}
+	if len(payload.Delivery) == 0 {
+		fields[strings.Join(c.channels(), "|")] = []string{"is required"}
+	}
+	if len(fields) > 0 {
+		return payload, &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request", Fields: fields}
+	}
+	return payload, nil
+}
+
+func (c *Config) validatePayload(r *http.Request, values Values) (fastotp.ValidateOTPPayload, error) {
+	if c.ValidatePayload != nil {
+		return c.ValidatePayload(r, values)
+	}
+
+	payload := fastotp.ValidateOTPPayload{
+		Identifier: values.Get("identifier"),
+		Token:      values.Get("token"),
+	}
+
+	fields := map[string][]string{}
+	if payload.Identifier == "" {
+		fields["identifier"] = []string{"is required"}
+	}
+	if payload.Token == "" {
+		fields["token"] = []string{"is required"}
+	}
+	if len(fields) > 0 {
+		return payload, &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request", Fields: fields}
+	}
+	return payload, nil
+}
+
+// RequestCodeHandler returns the handler that sends a code.
+func RequestCodeHandler(config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withClientIP(r)
+		values, err := readRequest(r, &config)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		payload, err := config.generatePayload(r, values)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		if err := config.checkLimits(r, payload.Identifier); err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		otp, err := config.Service.GenerateOTP(r.Context(), payload)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		if config.OnGenerated != nil {
+			config.OnGenerated(w, r, otp)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"id":         otp.ID,
+			"expires_at": otp.ExpiresAt,
+		})
+	})
+}
+
+// VerifyCodeHandler returns the handler that checks a code.
+func VerifyCodeHandler(config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withClientIP(r)
+		values, err := readRequest(r, &config)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		payload, err := config.validatePayload(r, values)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		if config.RateLimiter != nil {
+			if err := config.RateLimiter.Allow(r, payload.Identifier); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+		// the attempt counts as a wrong code until it is known not to be
+		undo := func() {}
+		if config.Lockout != nil {
+			if undo, err = config.Lockout.Attempt(r.Context(), payload.Identifier); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+
+		otp, err := config.Service.ValidateOTP(r.Context(), payload)
+		if err == nil && otp.Status != fastotp.OTPStatusValidated {
+			err = errInvalidCode
+		}
+		if err != nil {
+			if !isWrongCode(err) {
+				undo()
+			}
+			WriteError(w, err)
+			return
+		}
+		if config.Lockout != nil {
+			config.Lockout.Success(r.Context(), payload.Identifier)
+		}
+
+		if config.OnValidated != nil {
+			config.OnValidated(w, r, otp)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":     otp.ID,
+			"status": otp.Status,
+		})
+	})
+}
+
+// withClientIP records the client's address for audit records, unless a
+// middleware that knows better, for example behind a proxy, already did.
+func withClientIP(r *http.Request) *http.Request {
+	if fastotp.ClientIPFromContext(r.Context()) != "" {
+		return r
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return r.WithContext(fastotp.WithClientIP(r.Context(), host))
+}
+
+func (c *Config) checkLimits(r *http.Request, identifier string) error {
+	if c.RateLimiter != nil {
+		if err := c.RateLimiter.Allow(r, identifier); err != nil {
+			return err
+		}
+	}
+	if c.Lockout != nil {
+		if err := c.Lockout.Check(r.Context(), identifier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRequest reads the fields of a JSON body or of a submitted form.
+func readRequest(r *http.Request, config *Config) (Values, error) {
+	if r.Method != http.MethodPost {
+		return nil, &Error{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "method not allowed"}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var raw map[string]interface{}
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize)).Decode(&raw); err != nil {
+			return nil, &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid JSON body"}
+		}
+		values := make(Values, len(raw))
+		for field, value := range raw {
+			switch v := value.(type) {
+			case string:
+				values[field] = v
+			case float64, bool:
+				values[field] = fmt.Sprint(v)
+			}
+		}
+		return values, nil
+
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if config.CheckCSRF != nil {
+			if err := config.CheckCSRF(r); err != nil {
+				return nil, &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: err.Error()}
+			}
+		}
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+		if err := r.ParseMultipartForm(maxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return nil, &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid form body"}
+		}
+		values := make(Values, len(r.PostForm))
+		for field := range r.PostForm {
+			values[field] = r.PostForm.Get(field)
+		}
+		return values, nil
+	}
+
+	return nil, &Error{Status: http.StatusUnsupportedMediaType, Code: CodeInvalidRequest, Message: "unsupported content type"}
+}
+
+// Middleware serves the request code and verify code endpoints at
+// prefix+"/request" and prefix+"/verify", and passes every other request on.
+func Middleware(prefix string, config Config) func(http.Handler) http.Handler {
+	request := RequestCodeHandler(config)
+	verify := VerifyCodeHandler(config)
+	prefix = strings.TrimRight(prefix, "/")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case prefix + "/request":
+				request.ServeHTTP(w, r)
+			case prefix + "/verify":
+				verify.ServeHTTP(w, r)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,292 @@
+package httpotp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeService struct {
+	generated []fastotp.GenerateOTPPayload
+	clientIPs []string
+	err       error
+}
+
+func (s *fakeService) GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.generated = append(s.generated, payload)
+	s.clientIPs = append(s.clientIPs, fastotp.ClientIPFromContext(ctx))
+	return &fastotp.OTP{ID: "otp-1", Identifier: payload.Identifier, Status: fastotp.OTPStatusPending}, nil
+}
+
+func (s *fakeService) ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if payload.Token != "123456" {
+		return nil, &fastotp.APIError{StatusCode: http.StatusBadRequest, Message: "invalid token"}
+	}
+	return &fastotp.OTP{ID: "otp-1", Identifier: payload.Identifier, Status: fastotp.OTPStatusValidated}, nil
+}
+
+func serve(h http.Handler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) *Error {
+	t.Helper()
+	var body struct {
+		Error *Error `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.NotNil(t, body.Error)
+	return body.Error
+}
+
+func TestRequestCodeHandler(t *testing.T) {
+	service := &fakeService{}
+	handler := RequestCodeHandler(Config{
+		Service:  service,
+		Defaults: fastotp.GenerateOTPPayload{Type: fastotp.OTPTypeNumeric, TokenLength: 6, Validity: 120},
+		Channels: []string{"email", "sms"},
+	})
+
+	rec := serve(handler, "application/json", `{"identifier": "user123", "email": "test@example.com"}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	require.Len(t, service.generated, 1)
+	assert.Equal(t, fastotp.GenerateOTPPayload{
+		Delivery:    fastotp.OTPDelivery{"email": "test@example.com"},
+		Identifier:  "user123",
+		Type:        fastotp.OTPTypeNumeric,
+		TokenLength: 6,
+		Validity:    120,
+	}, service.generated[0])
+
+	rec = serve(handler, "application/x-www-form-urlencoded", url.Values{"identifier": {"user123"}, "sms": {"+2348000000000"}}.Encode())
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, fastotp.OTPDelivery{"sms": "+2348000000000"}, service.generated[1].Delivery)
+
+	rec = serve(handler, "application/json", `{"email": "test@example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	httpErr := decodeError(t, rec)
+	assert.Equal(t, CodeInvalidRequest, httpErr.Code)
+	assert.Contains(t, httpErr.Fields, "identifier")
+
+	rec = serve(handler, "text/plain", `identifier=user123`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestVerifyCodeHandler_Lockout(t *testing.T) {
+	lockout := NewMemoryLockout(2, time.Minute)
+	handler := VerifyCodeHandler(Config{
+		Service: &fakeService{},
+		Lockout: lockout,
+		OnValidated: func(w http.ResponseWriter, r *http.Request, otp *fastotp.OTP) {
+			writeJSON(w, http.StatusOK, map[string]string{"session": "token-for-" + otp.Identifier})
+		},
+	})
+
+	rec := serve(handler, "application/json", `{"identifier": "user123", "token": "000000"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, CodeInvalidCode, decodeError(t, rec).Code)
+
+	rec = serve(handler, "application/json", `{"identifier": "user123", "token": "123456"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"session": "token-for-user123"}`, rec.Body.String())
+
+	// a success resets the count, so two more failures are needed
+	for i := 0; i < 2; i++ {
+		rec = serve(handler, "application/json", `{"identifier": "user123", "token": "000000"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+	rec = serve(handler, "application/json", `{"identifier": "user123", "token": "123456"}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, CodeLockedOut, decodeError(t, rec).Code)
+}
+
+func TestHandlers_RateLimitAndCSRF(t *testing.T) {
+	handler := RequestCodeHandler(Config{
+		Service: &fakeService{},
+		RateLimiter: RateLimiterFunc(func(r *http.Request, identifier string) error {
+			if identifier == "noisy" {
+				return RateLimited(30 * time.Second)
+			}
+			return nil
+		}),
+		CheckCSRF: func(r *http.Request) error {
+			if r.FormValue("csrf_token") != "valid" {
+				return errors.New("invalid CSRF token")
+			}
+			return nil
+		},
+	})
+
+	rec := serve(handler, "application/json", `{"identifier": "noisy", "email": "test@example.com"}`)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	rec = serve(handler, "application/x-www-form-urlencoded", "identifier=user123&email=test%40example.com&csrf_token=forged")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(handler, "application/x-www-form-urlencoded", "identifier=user123&email=test%40example.com&csrf_token=valid")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+}
+
+func TestErrorFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"circuit open", fastotp.ErrCircuitOpen, http.StatusServiceUnavailable, CodeUnavailable},
+		{"cooldown", fastotp.ErrResendCooldown, http.StatusTooManyRequests, CodeRateLimited},
+		{"max attempts", fastotp.ErrMaxAttempts, http.StatusTooManyRequests, CodeLockedOut},
+		{"wrong purpose", fastotp.ErrPurposeMismatch, http.StatusBadRequest, CodeInvalidCode},
+		{"cancelled", fastotp.ErrOTPCancelled, http.StatusBadRequest, CodeInvalidCode},
+		{"api key refused", &fastotp.APIError{StatusCode: http.StatusUnauthorized}, http.StatusBadGateway, CodeUpstreamError},
+		{"api validation", &fastotp.APIError{StatusCode: http.StatusUnprocessableEntity, Errors: map[string][]string{"identifier": {"is required"}}}, http.StatusBadRequest, CodeInvalidRequest},
+		{"api down", &fastotp.APIError{StatusCode: http.StatusInternalServerError}, http.StatusBadGateway, CodeUpstreamError},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+		{"unknown purpose", fmt.Errorf("%w: signup", fastotp.ErrUnknownPolicy), http.StatusBadRequest, CodeInvalidRequest},
+		{"channel not allowed", fastotp.ErrNoDeliveryChannel, http.StatusBadRequest, CodeInvalidRequest},
+		{"invalid transaction", fmt.Errorf("%w: missing payee", fastotp.ErrInvalidTransaction), http.StatusBadRequest, CodeInvalidRequest},
+		{"unknown tenant", fmt.Errorf("%w: acme", fastotp.ErrUnknownTenant), http.StatusBadRequest, CodeRejected},
+		{"no tenant", fastotp.ErrNoTenant, http.StatusInternalServerError, CodeInternal},
+		{"unknown", errors.New("dial tcp: connection refused"), http.StatusBadGateway, CodeUpstreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpErr := ErrorFor(tt.err)
+			assert.Equal(t, tt.status, httpErr.Status)
+			assert.Equal(t, tt.code, httpErr.Code)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Middleware("/auth/otp/", Config{Service: &fakeService{}})(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/otp/verify", strings.NewReader(`{"identifier": "user123", "token": "123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/otp/verify", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/elsewhere", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
+
+func TestHandlers_ClientIP(t *testing.T) {
+	service := &fakeService{}
+	h := RequestCodeHandler(Config{Service: service})
+	body := `{"identifier":"user","email":"user@example.com"}`
+
+	rec := serve(h, "application/json", body)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	// an address set by an earlier middleware wins
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(fastotp.WithClientIP(req.Context(), "198.51.100.7"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []string{"192.0.2.1", "198.51.100.7"}, service.clientIPs)
+}
+
+func TestMemoryLockout_Erase(t *testing.T) {
+	ctx := context.Background()
+	lockout := NewMemoryLockout(1, time.Minute)
+	lockout.Failure(ctx, "user123")
+	require.Error(t, lockout.Check(ctx, "user123"))
+
+	require.NoError(t, lockout.Erase(ctx, "user123"))
+	assert.NoError(t, lockout.Check(ctx, "user123"))
+}
+
+func TestMemoryLockout_Attempt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	lockout := NewMemoryLockout(2, time.Minute)
+	lockout.now = func() time.Time { return now }
+
+	// the second attempt locks out any concurrent third one while in flight
+	_, err := lockout.Attempt(ctx, "user123")
+	require.NoError(t, err)
+	undo, err := lockout.Attempt(ctx, "user123")
+	require.NoError(t, err)
+	_, err = lockout.Attempt(ctx, "user123")
+	assert.Equal(t, CodeLockedOut, ErrorFor(err).Code)
+
+	// until it turns out the code could not be checked
+	undo()
+	require.NoError(t, lockout.Check(ctx, "user123"))
+
+	// failures are forgotten once the duration has passed
+	now = now.Add(time.Minute)
+	_, err = lockout.Attempt(ctx, "user123")
+	require.NoError(t, err)
+	assert.NoError(t, lockout.Check(ctx, "user123"))
+}
+
+func TestMemoryLockout_SweepsExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	lockout := NewMemoryLockout(5, time.Minute)
+	lockout.now = func() time.Time { return now }
+
+	for i := 0; i < 1000; i++ {
+		lockout.Failure(ctx, fmt.Sprintf("user%d", i))
+	}
+	now = now.Add(time.Minute)
+	for i := 0; i < 1000; i++ {
+		lockout.Failure(ctx, fmt.Sprintf("latest%d", i))
+	}
+	assert.Equal(t, 1000, lockout.failures.Len())
+}
+
+func TestVerifyCodeHandler_LockoutIgnoresServerErrors(t *testing.T) {
+	service := &fakeService{err: &fastotp.APIError{StatusCode: http.StatusInternalServerError, Message: "Server Error"}}
+	handler := VerifyCodeHandler(Config{
+		Service: service,
+		Lockout: NewMemoryLockout(2, time.Minute),
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := serve(handler, "application/json", `{"identifier": "user123", "token": "123456"}`)
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+	}
+
+	service.err = nil
+	rec := serve(handler, "application/json", `{"identifier": "user123", "token": "123456"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
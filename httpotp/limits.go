@@ -0,0 +1,161 @@
+package httpotp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/ttlmap"
+)
+
+// RateLimiter decides whether a request may proceed. Returning an error,
+// usually from RateLimited, rejects it.
+type RateLimiter interface {
+	Allow(r *http.Request, identifier string) error
+}
+
+// RateLimiterFunc adapts a function to a RateLimiter.
+type RateLimiterFunc func(r *http.Request, identifier string) error
+
+// Allow calls f(r, identifier).
+func (f RateLimiterFunc) Allow(r *http.Request, identifier string) error {
+	return f(r, identifier)
+}
+
+// Lockout blocks identifiers after repeated wrong codes.
+type Lockout interface {
+	// Check returns an error, usually from LockedOut, while identifier is
+	// locked out.
+	Check(ctx context.Context, identifier string) error
+	// Attempt checks identifier like Check and, when it is not locked out,
+	// records a wrong code for it in the same step, so that concurrent
+	// attempts cannot get past the limit. Success clears it, and the
+	// returned function takes it back when the code could not be checked.
+	Attempt(ctx context.Context, identifier string) (func(), error)
+	// Failure records a wrong code for identifier.
+	Failure(ctx context.Context, identifier string)
+	// Success records an accepted code for identifier.
+	Success(ctx context.Context, identifier string)
+}
+
+// MemoryLockout is an in-memory Lockout for a single process.
+type MemoryLockout struct {
+	maxFailures int
+	duration    time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	failures ttlmap.Map[string, *lockoutEntry]
+}
+
+type lockoutEntry struct {
+	count  int
+	locked bool
+	// expiresAt is when the lockout ends or, before that, when the
+	// failures are forgotten.
+	expiresAt time.Time
+}
+
+// NewMemoryLockout creates a new MemoryLockout that locks an identifier out
+// for duration after maxFailures wrong codes in a row. Wrong codes are
+// forgotten once duration has passed since the last one.
+func NewMemoryLockout(maxFailures int, duration time.Duration) *MemoryLockout {
+	return &MemoryLockout{
+		maxFailures: maxFailures,
+		duration:    duration,
+		now:         time.Now,
+	}
+}
+
+// lookup returns the live entry for identifier.
+func (l *MemoryLockout) lookup(identifier string, now time.Time) *lockoutEntry {
+	entry, _ := l.failures.Get(identifier, now)
+	return entry
+}
+
+// check returns a LockedOut error while entry is locked out.
+func (l *MemoryLockout) check(entry *lockoutEntry, now time.Time) error {
+	if entry == nil || !entry.locked {
+		return nil
+	}
+	return LockedOut(entry.expiresAt.Sub(now))
+}
+
+// fail records a wrong code for identifier and returns its entry.
+func (l *MemoryLockout) fail(identifier string, now time.Time) *lockoutEntry {
+	entry := l.lookup(identifier, now)
+	if entry == nil {
+		entry = &lockoutEntry{}
+	}
+	entry.count++
+	if !entry.locked {
+		entry.locked = entry.count >= l.maxFailures
+		entry.expiresAt = now.Add(l.duration)
+	}
+	l.failures.Set(identifier, entry, entry.expiresAt, now)
+	return entry
+}
+
+// Check returns a LockedOut error while identifier is locked out.
+func (l *MemoryLockout) Check(_ context.Context, identifier string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	return l.check(l.lookup(identifier, now), now)
+}
+
+// Attempt returns a LockedOut error while identifier is locked out, and
+// otherwise records a wrong code for it until Success clears it or the
+// returned function takes it back.
+func (l *MemoryLockout) Attempt(_ context.Context, identifier string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if err := l.check(l.lookup(identifier, now), now); err != nil {
+		return nil, err
+	}
+	entry := l.fail(identifier, now)
+	return func() { l.undo(identifier, entry) }, nil
+}
+
+// undo takes back a wrong code recorded by Attempt, leaving alone an entry
+// that has been cleared or replaced since.
+func (l *MemoryLockout) undo(identifier string, entry *lockoutEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lookup(identifier, l.now()) != entry {
+		return
+	}
+	entry.count--
+	if entry.count <= 0 {
+		l.failures.Delete(identifier)
+		return
+	}
+	if entry.count < l.maxFailures {
+		entry.locked = false
+	}
+}
+
+// Failure records a wrong code for identifier.
+func (l *MemoryLockout) Failure(_ context.Context, identifier string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fail(identifier, l.now())
+}
+
+// Success clears the failures recorded for identifier.
+func (l *MemoryLockout) Success(_ context.Context, identifier string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures.Delete(identifier)
+}
+
+// Erase forgets identifier, lifting any lockout.
+func (l *MemoryLockout) Erase(ctx context.Context, identifier string) error {
+	l.Success(ctx, identifier)
+	return nil
+}
@@ -10,3 +10,18 @@ type HttpClient interface {
 	Get(ctx context.Context, id string) (*http.Response, error)
 	Post(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error)
 }
+
+// PayloadValidator checks a payload before an OTP is generated for it. It
+// may normalise the payload in place, for example to rewrite phone numbers,
+// and reports invalid fields as an *APIError with status 422.
+type PayloadValidator interface {
+	ValidatePayload(ctx context.Context, payload *GenerateOTPPayload) error
+}
+
+// PayloadValidatorFunc adapts a function to a PayloadValidator.
+type PayloadValidatorFunc func(ctx context.Context, payload *GenerateOTPPayload) error
+
+// ValidatePayload calls f(ctx, payload).
+func (f PayloadValidatorFunc) ValidatePayload(ctx context.Context, payload *GenerateOTPPayload) error {
+	return f(ctx, payload)
+}
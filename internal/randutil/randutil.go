@@ -0,0 +1,36 @@
+// Package randutil draws the random codes and IDs of the packages that
+// issue OTPs and recovery codes.
+package randutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+)
+
+// String draws length characters from alphabet. rand.Int samples uniformly,
+// so no character is more likely than another.
+func String(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	s := make([]byte, length)
+	for i := range s {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		s[i] = alphabet[n.Int64()]
+	}
+	return string(s), nil
+}
+
+// UUID returns a random version 4 UUID.
+func UUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
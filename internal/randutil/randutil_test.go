@@ -0,0 +1,32 @@
+package randutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString_Uniform(t *testing.T) {
+	const draws = 20000
+	counts := map[rune]int{}
+	for i := 0; i < draws/10; i++ {
+		s, err := String("0123456789", 10)
+		require.NoError(t, err)
+		for _, c := range s {
+			counts[c]++
+		}
+	}
+
+	require.Len(t, counts, 10)
+	for c, n := range counts {
+		// expected 2000 per digit; 5 standard deviations is about 212
+		assert.InDelta(t, draws/10, n, 250, "digit %q", c)
+	}
+}
+
+func TestUUID(t *testing.T) {
+	id, err := UUID()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+}
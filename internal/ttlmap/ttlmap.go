@@ -0,0 +1,74 @@
+// Package ttlmap keeps the in-memory state that only matters until an OTP or
+// a lockout expires.
+package ttlmap
+
+import "time"
+
+// minSweep is the number of writes between two sweeps of a small map.
+const minSweep = 64
+
+// Map maps keys to values until they expire. Expired entries are never
+// returned, and are swept once the writes since the last sweep outnumber
+// the entries it kept, so a write costs amortised constant time however
+// many entries are live. The zero Map is empty and ready to use. A Map is
+// not safe for concurrent use.
+type Map[K comparable, V any] struct {
+	entries map[K]entry[V]
+	// writes counts the writes since the last sweep, and kept the entries
+	// that sweep left.
+	writes int
+	kept   int
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// Get returns the value of key, dropping it once it has expired at now.
+func (m *Map[K, V]) Get(key K, now time.Time) (V, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !now.Before(e.expiresAt) {
+		delete(m.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores value under key until expiresAt, sweeping the entries that
+// have expired at now when it is due.
+func (m *Map[K, V]) Set(key K, value V, expiresAt, now time.Time) {
+	if m.entries == nil {
+		m.entries = make(map[K]entry[V])
+	}
+	m.writes++
+	if m.writes >= max(minSweep, m.kept) {
+		m.sweep(now)
+	}
+	m.entries[key] = entry[V]{value: value, expiresAt: expiresAt}
+}
+
+func (m *Map[K, V]) sweep(now time.Time) {
+	for key, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.writes = 0
+	m.kept = len(m.entries)
+}
+
+// Delete removes key.
+func (m *Map[K, V]) Delete(key K) {
+	delete(m.entries, key)
+}
+
+// Len returns the number of entries, counting expired ones not swept yet.
+func (m *Map[K, V]) Len() int {
+	return len(m.entries)
+}
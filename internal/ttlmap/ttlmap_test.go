@@ -0,0 +1,62 @@
+package ttlmap
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMap_Expiry(t *testing.T) {
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	var m Map[string, int]
+
+	m.Set("a", 1, now.Add(time.Minute), now)
+	v, ok := m.Get("a", now)
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	_, ok = m.Get("a", now.Add(time.Minute))
+	require.False(t, ok)
+	require.Zero(t, m.Len())
+}
+
+func TestMap_Delete(t *testing.T) {
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	var m Map[string, int]
+
+	m.Set("a", 1, now.Add(time.Minute), now)
+	m.Delete("a")
+	_, ok := m.Get("a", now)
+	require.False(t, ok)
+}
+
+func TestMap_SweepsExpired(t *testing.T) {
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	var m Map[string, int]
+
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), i, now.Add(time.Minute), now)
+	}
+	now = now.Add(time.Minute)
+	for i := 1000; i < 2000; i++ {
+		m.Set(strconv.Itoa(i), i, now.Add(time.Minute), now)
+	}
+	require.Equal(t, 1000, m.Len())
+}
+
+func TestMap_SweepsAreAmortised(t *testing.T) {
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	var m Map[string, int]
+
+	sweeps := 0
+	for i := 0; i < 10000; i++ {
+		m.Set(strconv.Itoa(i), i, now.Add(time.Hour), now)
+		if m.writes == 0 {
+			sweeps++
+		}
+	}
+	// live entries double the gap between sweeps
+	require.Less(t, sweeps, 10)
+}
@@ -0,0 +1,274 @@
+package httpclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is rejected because the circuit
+// breaker guarding its endpoint is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// StateClosed lets every request through and counts failures.
+	StateClosed BreakerState = iota
+	// StateOpen rejects every request until the cool-down has elapsed.
+	StateOpen
+	// StateHalfOpen lets a limited number of trial requests through.
+	StateHalfOpen
+)
+
+// String returns the string value of BreakerState
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is the result of a request, as reported to a CircuitBreaker.
+type Outcome int
+
+const (
+	// Success counts towards closing the breaker.
+	Success Outcome = iota
+	// Failure counts towards opening the breaker.
+	Failure
+	// Neutral is reported for requests that say nothing about the
+	// endpoint's health, such as those cancelled by the caller. It frees
+	// the request's half-open slot without counting either way.
+	Neutral
+)
+
+// BreakerSettings configures a CircuitBreaker. Zero values fall back to the
+// defaults documented on each field.
+type BreakerSettings struct {
+	// ConsecutiveFailures trips the breaker after this many failures in a
+	// row. Defaults to 5; a negative value disables the check.
+	ConsecutiveFailures int
+	// FailureRate trips the breaker once the ratio of failed requests in the
+	// current window reaches it. Zero disables the check.
+	FailureRate float64
+	// MinRequests is the number of requests the window must hold before
+	// FailureRate is considered. Defaults to 10.
+	MinRequests int
+	// Window is how long failure counts are kept while closed. Defaults to 60s.
+	Window time.Duration
+	// CoolDown is how long the breaker stays open before allowing trial
+	// requests. Defaults to 30s.
+	CoolDown time.Duration
+	// HalfOpenRequests is the number of trial requests allowed while half-open,
+	// all of which must succeed to close the breaker. Defaults to 1.
+	HalfOpenRequests int
+	// OnStateChange, if set, is called after every state transition.
+	OnStateChange func(name string, from, to BreakerState)
+}
+
+func (s BreakerSettings) withDefaults() BreakerSettings {
+	if s.ConsecutiveFailures == 0 {
+		s.ConsecutiveFailures = 5
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = 10
+	}
+	if s.Window <= 0 {
+		s.Window = 60 * time.Second
+	}
+	if s.CoolDown <= 0 {
+		s.CoolDown = 30 * time.Second
+	}
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = 1
+	}
+	return s
+}
+
+// CircuitBreaker fails requests fast once an endpoint looks unhealthy.
+type CircuitBreaker struct {
+	name     string
+	settings BreakerSettings
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64
+	windowStart time.Time
+	openedAt    time.Time
+	total       int
+	failures    int
+	consecutive int
+	inFlight    int
+	successes   int
+	pending     []transition
+}
+
+type transition struct {
+	from, to BreakerState
+}
+
+// NewCircuitBreaker creates a new closed CircuitBreaker.
+func NewCircuitBreaker(name string, settings BreakerSettings) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		name:     name,
+		settings: settings.withDefaults(),
+		now:      time.Now,
+	}
+	cb.windowStart = cb.now()
+	return cb
+}
+
+// Name returns the name the breaker was created with.
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.refresh(cb.now())
+	return cb.state
+}
+
+// Allow reports whether a request may proceed. When it may, the returned
+// function must be called exactly once with the outcome of the request.
+func (cb *CircuitBreaker) Allow() (func(Outcome), error) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.refresh(cb.now())
+
+	switch cb.state {
+	case StateOpen:
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if cb.inFlight+cb.successes >= cb.settings.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+		cb.inFlight++
+	}
+
+	generation := cb.generation
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { cb.report(generation, outcome) })
+	}, nil
+}
+
+func (cb *CircuitBreaker) report(generation uint64, outcome Outcome) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	now := cb.now()
+	cb.refresh(now)
+	// the breaker has moved on since this request started
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case StateClosed:
+		if outcome == Neutral {
+			return
+		}
+		cb.total++
+		if outcome == Success {
+			cb.consecutive = 0
+			return
+		}
+		cb.failures++
+		cb.consecutive++
+		if cb.shouldTrip() {
+			cb.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		cb.inFlight--
+		switch outcome {
+		case Neutral:
+			return
+		case Failure:
+			cb.setState(StateOpen, now)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.settings.HalfOpenRequests {
+			cb.setState(StateClosed, now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) shouldTrip() bool {
+	s := cb.settings
+	if s.ConsecutiveFailures > 0 && cb.consecutive >= s.ConsecutiveFailures {
+		return true
+	}
+	if s.FailureRate > 0 && cb.total >= s.MinRequests &&
+		float64(cb.failures)/float64(cb.total) >= s.FailureRate {
+		return true
+	}
+	return false
+}
+
+// refresh applies the time based transitions: the closed window rolling over
+// and the open state cooling down into half-open.
+func (cb *CircuitBreaker) refresh(now time.Time) {
+	switch cb.state {
+	case StateClosed:
+		if now.Sub(cb.windowStart) >= cb.settings.Window {
+			cb.resetCounts(now)
+		}
+	case StateOpen:
+		if now.Sub(cb.openedAt) >= cb.settings.CoolDown {
+			cb.setState(StateHalfOpen, now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	cb.resetCounts(now)
+	if state == StateOpen {
+		cb.openedAt = now
+	}
+
+	if cb.settings.OnStateChange != nil {
+		cb.pending = append(cb.pending, transition{from: from, to: state})
+	}
+}
+
+// unlock releases the lock and then runs the state change callbacks queued
+// while it was held, so callbacks are free to inspect the breaker.
+func (cb *CircuitBreaker) unlock() {
+	pending := cb.pending
+	cb.pending = nil
+	cb.mu.Unlock()
+
+	for _, t := range pending {
+		cb.settings.OnStateChange(cb.name, t.from, t.to)
+	}
+}
+
+func (cb *CircuitBreaker) resetCounts(now time.Time) {
+	cb.windowStart = now
+	cb.total = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.inFlight = 0
+	cb.successes = 0
+}
@@ -0,0 +1,171 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(settings BreakerSettings) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker("test", settings)
+	cb.now = clock.Now
+	cb.windowStart = clock.now
+	return cb, clock
+}
+
+func record(t *testing.T, cb *CircuitBreaker, outcome Outcome) {
+	t.Helper()
+	done, err := cb.Allow()
+	require.NoError(t, err)
+	done(outcome)
+}
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	var changes []string
+	cb, clock := newTestBreaker(BreakerSettings{
+		ConsecutiveFailures: 3,
+		CoolDown:            time.Second,
+		OnStateChange: func(name string, from, to BreakerState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	})
+
+	record(t, cb, Failure)
+	record(t, cb, Failure)
+	record(t, cb, Success)
+	record(t, cb, Failure)
+	record(t, cb, Failure)
+	assert.Equal(t, StateClosed, cb.State())
+
+	record(t, cb, Failure)
+	assert.Equal(t, StateOpen, cb.State())
+
+	_, err := cb.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	done, err := cb.Allow()
+	require.NoError(t, err)
+	_, err = cb.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "only one trial request while half-open")
+
+	done(Success)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, []string{"closed->open", "open->half-open", "half-open->closed"}, changes)
+}
+
+func TestCircuitBreaker_HalfOpenFailureReopens(t *testing.T) {
+	cb, clock := newTestBreaker(BreakerSettings{ConsecutiveFailures: 1, CoolDown: time.Second})
+
+	record(t, cb, Failure)
+	clock.Advance(time.Second)
+	record(t, cb, Failure)
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, StateOpen, cb.State(), "cool-down restarts when re-opened")
+}
+
+func TestCircuitBreaker_NeutralOutcome(t *testing.T) {
+	cb, clock := newTestBreaker(BreakerSettings{ConsecutiveFailures: 2, CoolDown: time.Second})
+
+	// a cancelled request does not reset the consecutive failures
+	record(t, cb, Failure)
+	record(t, cb, Neutral)
+	record(t, cb, Failure)
+	require.Equal(t, StateOpen, cb.State())
+
+	// nor does it close a half-open breaker, but it frees the trial slot
+	clock.Advance(time.Second)
+	record(t, cb, Neutral)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	record(t, cb, Success)
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	cb, clock := newTestBreaker(BreakerSettings{
+		ConsecutiveFailures: -1,
+		FailureRate:         0.5,
+		MinRequests:         4,
+		Window:              time.Minute,
+	})
+
+	record(t, cb, Failure)
+	record(t, cb, Success)
+	record(t, cb, Failure)
+	assert.Equal(t, StateClosed, cb.State(), "not enough requests yet")
+
+	// a new window forgets earlier failures
+	clock.Advance(time.Minute)
+	record(t, cb, Success)
+	record(t, cb, Success)
+	record(t, cb, Failure)
+	assert.Equal(t, StateClosed, cb.State())
+
+	record(t, cb, Failure)
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestCircuitBreaker_StaleReportsIgnored(t *testing.T) {
+	cb, _ := newTestBreaker(BreakerSettings{ConsecutiveFailures: 1})
+
+	slow, err := cb.Allow()
+	require.NoError(t, err)
+	record(t, cb, Failure)
+	require.Equal(t, StateOpen, cb.State())
+
+	slow(Success)
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestAPIClient_CircuitBreakerPerEndpoint(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/generate" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewAPIClient(server.URL, "test_api_key", WithCircuitBreaker(BreakerSettings{ConsecutiveFailures: 2}))
+	client.client = server.Client()
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(context.TODO(), "/generate", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	_, err := client.Post(context.TODO(), "/generate", nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	resp, err := client.Post(context.TODO(), "/validate", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, StateClosed, client.Breaker(server.URL, "/validate").State())
+}
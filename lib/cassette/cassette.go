@@ -0,0 +1,360 @@
+// Package cassette records the HTTP interactions of lib.APIClient to a JSON
+// cassette file and replays them, so tests can use realistic FastOTP
+// payloads without reaching the API.
+//
+//	rec := cassette.Use(t, "testdata/generate.json", cassette.ModeAuto)
+//	client := fastotp.NewFastOTP(apiKey, fastotp.WithAPIClientOptions(
+//		httpclient.WithHTTPClient(rec.Client()),
+//	))
+//
+// API keys and tokens are redacted before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Redacted replaces secrets in recorded interactions.
+const Redacted = "REDACTED"
+
+var (
+	// ErrNoMatch is returned by RoundTrip in replay mode when no unused
+	// interaction matches the request.
+	ErrNoMatch = errors.New("no matching interaction in cassette")
+	// ErrUnused is returned by Stop in replay mode when interactions of the
+	// cassette were never requested.
+	ErrUnused = errors.New("cassette has unused interactions")
+)
+
+// Mode is what a Recorder does with requests.
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette and never touches the
+	// network.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the network and saves the interactions.
+	ModeRecord
+	// ModeAuto replays when the cassette file exists and records otherwise.
+	ModeAuto
+)
+
+// Request is a recorded request.
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper recording to or replaying from a cassette.
+type Recorder struct {
+	path          string
+	mode          Mode
+	transport     http.RoundTripper
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+
+	mu        sync.Mutex
+	cassette  Cassette
+	used      []bool
+	unmatched []string
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to reach the network when recording.
+// Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithRedactedHeaders adds headers whose values are redacted. x-api-key and
+// Authorization are always redacted.
+func WithRedactedHeaders(headers ...string) Option {
+	return func(r *Recorder) {
+		for _, header := range headers {
+			r.redactHeaders[http.CanonicalHeaderKey(header)] = true
+		}
+	}
+}
+
+// WithRedactedFields adds JSON body fields whose values are redacted, at any
+// depth. "token" is always redacted.
+func WithRedactedFields(fields ...string) Option {
+	return func(r *Recorder) {
+		for _, field := range fields {
+			r.redactFields[field] = true
+		}
+	}
+}
+
+// New creates a new Recorder for the cassette at path. In replay mode the
+// cassette is loaded straight away.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		redactHeaders: map[string]bool{
+			"X-Api-Key":     true,
+			"Authorization": true,
+		},
+		redactFields: map[string]bool{"token": true},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+
+	if r.mode == ModeReplay {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &r.cassette); err != nil {
+			return nil, fmt.Errorf("parsing cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Use creates a Recorder for a test and stops it when the test ends, failing
+// the test on unmatched requests or unused interactions.
+func Use(t testing.TB, path string, mode Mode, opts ...Option) *Recorder {
+	t.Helper()
+	r, err := New(path, mode, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := r.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+// Mode returns the mode the recorder is in, resolving ModeAuto.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an *http.Client using the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := Request{
+		Method:  req.Method,
+		Path:    req.URL.RequestURI(),
+		Headers: r.headers(req.Header),
+		Body:    r.redactBody(body),
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request: recorded,
+		Response: Response{
+			Status:  resp.StatusCode,
+			Headers: r.headers(resp.Header),
+			Body:    r.redactBody(respBody),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !matches(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+
+		header := make(http.Header, len(interaction.Response.Headers))
+		for name, value := range interaction.Response.Headers {
+			header.Set(name, value)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	description := recorded.Method + " " + recorded.Path
+	r.unmatched = append(r.unmatched, description)
+	return nil, fmt.Errorf("%w: %s", ErrNoMatch, description)
+}
+
+// matches compares method, path and body, ignoring JSON formatting.
+func matches(recorded, req Request) bool {
+	return recorded.Method == req.Method &&
+		recorded.Path == req.Path &&
+		canonicalJSON(recorded.Body) == canonicalJSON(req.Body)
+}
+
+func canonicalJSON(body string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return body
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+// Stop saves the cassette when recording. When replaying it reports requests
+// that matched nothing and interactions that were never used.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ModeRecord {
+		b, err := json.MarshalIndent(r.cassette, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(r.path, append(b, '\n'), 0o644)
+	}
+
+	if len(r.unmatched) > 0 {
+		return fmt.Errorf("%w: %s", ErrNoMatch, strings.Join(r.unmatched, ", "))
+	}
+	var unused []string
+	for i, used := range r.used {
+		if !used {
+			req := r.cassette.Interactions[i].Request
+			unused = append(unused, req.Method+" "+req.Path)
+		}
+	}
+	if len(unused) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnused, strings.Join(unused, ", "))
+	}
+	return nil
+}
+
+func (r *Recorder) headers(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for name := range h {
+		if r.redactHeaders[http.CanonicalHeaderKey(name)] {
+			headers[name] = Redacted
+			continue
+		}
+		headers[name] = h.Get(name)
+	}
+	return headers
+}
+
+// redactBody replaces the redacted fields of a JSON body. Other bodies are
+// kept as they are.
+func (r *Recorder) redactBody(body []byte) string {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+
+	b, err := json.Marshal(r.redact(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(b)
+}
+
+func (r *Recorder) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if r.redactFields[key] {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = r.redact(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.redact(value)
+		}
+	}
+	return v
+}
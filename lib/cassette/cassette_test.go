@@ -0,0 +1,122 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	httpclient "github.com/CeoFred/fast-otp/lib"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/generate":
+			_, _ = io.WriteString(w, `{"otp": {"id": "otp-1", "identifier": "user123", "status": "pending"}}`)
+		case "/validate":
+			_, _ = io.WriteString(w, `{"otp": {"id": "otp-1", "identifier": "user123", "status": "validated"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message": "not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "otp.json")
+	api := newAPI(t)
+
+	rec, err := New(path, ModeAuto)
+	require.NoError(t, err)
+	require.Equal(t, ModeRecord, rec.Mode())
+
+	client := httpclient.NewAPIClient(api.URL, "super-secret-key", httpclient.WithHTTPClient(rec.Client()))
+	resp, err := client.Post(context.TODO(), "/generate", map[string]string{"identifier": "user123"})
+	require.NoError(t, err)
+	generated := readAll(t, resp)
+	resp, err = client.Post(context.TODO(), "/validate", map[string]string{"identifier": "user123", "token": "123456"})
+	require.NoError(t, err)
+	readAll(t, resp)
+	require.NoError(t, rec.Stop())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "super-secret-key")
+	assert.NotContains(t, string(b), "123456")
+
+	var cassette Cassette
+	require.NoError(t, json.Unmarshal(b, &cassette))
+	require.Len(t, cassette.Interactions, 2)
+	assert.Equal(t, Redacted, cassette.Interactions[0].Request.Headers["X-Api-Key"])
+
+	// replay works with the API gone
+	api.Close()
+	replay := Use(t, path, ModeAuto)
+	require.Equal(t, ModeReplay, replay.Mode())
+	client = httpclient.NewAPIClient(api.URL, "another-key", httpclient.WithHTTPClient(replay.Client()))
+
+	resp, err = client.Post(context.TODO(), "/generate", map[string]string{"identifier": "user123"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, generated, readAll(t, resp))
+
+	resp, err = client.Post(context.TODO(), "/validate", map[string]string{"token": "654321", "identifier": "user123"})
+	require.NoError(t, err)
+	assert.Contains(t, readAll(t, resp), "validated")
+}
+
+func TestReplay_UnmatchedAndUnused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "otp.json")
+	cassette := Cassette{Interactions: []*Interaction{
+		{
+			Request:  Request{Method: http.MethodPost, Path: "/generate", Body: `{"identifier":"user123"}`},
+			Response: Response{Status: http.StatusOK, Body: `{"otp": {"id": "otp-1"}}`},
+		},
+		{
+			Request:  Request{Method: http.MethodGet, Path: "/otp-1"},
+			Response: Response{Status: http.StatusOK, Body: `{"otp": {"id": "otp-1"}}`},
+		},
+	}}
+	b, err := json.Marshal(cassette)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o644))
+
+	rec, err := New(path, ModeReplay)
+	require.NoError(t, err)
+	client := httpclient.NewAPIClient("https://api.fastotp.co", "key", httpclient.WithHTTPClient(rec.Client()))
+
+	_, err = client.Post(context.TODO(), "/generate", map[string]string{"identifier": "someone_else"})
+	assert.ErrorIs(t, err, ErrNoMatch)
+	assert.ErrorIs(t, rec.Stop(), ErrNoMatch)
+
+	rec, err = New(path, ModeReplay)
+	require.NoError(t, err)
+	client = httpclient.NewAPIClient("https://api.fastotp.co", "key", httpclient.WithHTTPClient(rec.Client()))
+
+	resp, err := client.Post(context.TODO(), "/generate", map[string]string{"identifier": "user123"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	err = rec.Stop()
+	assert.ErrorIs(t, err, ErrUnused)
+	assert.ErrorContains(t, err, "GET /otp-1")
+}
@@ -0,0 +1,286 @@
+// Package chaos provides an http.RoundTripper that injects failures into the
+// requests of lib.APIClient, to see how a login flow copes with a flaky
+// FastOTP API:
+//
+//	transport := chaos.New(42, nil,
+//		chaos.Fault{Kind: chaos.Latency, Probability: 0.5, Latency: 2 * time.Second},
+//		chaos.Fault{Kind: chaos.Status, Every: 3, Status: http.StatusBadGateway},
+//	)
+//	client := httpclient.NewAPIClient(url, apiKey,
+//		httpclient.WithHTTPClient(&http.Client{Transport: transport}))
+//
+// Decisions are drawn from a generator seeded by the caller, so a failing run
+// can be reproduced by reusing its seed.
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Kind is the kind of failure a Fault injects.
+type Kind int
+
+const (
+	// Latency delays the request by Fault.Latency, then lets it through.
+	Latency Kind = iota
+	// ConnectionReset fails the request as if the peer reset the connection.
+	ConnectionReset
+	// Timeout fails the request with a timeout error after Fault.Latency, or
+	// when the request's context ends first.
+	Timeout
+	// MalformedJSON replaces the response body with invalid JSON.
+	MalformedJSON
+	// TruncatedBody cuts the response body in half and fails reading it.
+	TruncatedBody
+	// Status answers with Fault.Status without sending the request.
+	Status
+)
+
+// String returns the string value of Kind
+func (k Kind) String() string {
+	switch k {
+	case Latency:
+		return "latency"
+	case ConnectionReset:
+		return "connection_reset"
+	case Timeout:
+		return "timeout"
+	case MalformedJSON:
+		return "malformed_json"
+	case TruncatedBody:
+		return "truncated_body"
+	case Status:
+		return "status"
+	default:
+		return "unknown"
+	}
+}
+
+// Fault describes a failure and when to inject it. A fault applies to a
+// request when its filters match and any of Probability, Every or Requests
+// selects it.
+type Fault struct {
+	Kind Kind
+
+	// Method and PathPrefix restrict the fault to matching requests.
+	Method     string
+	PathPrefix string
+
+	// Probability injects the fault into this fraction of matching requests.
+	Probability float64
+	// Every injects the fault into every Nth matching request.
+	Every int
+	// Requests injects the fault into the listed matching requests,
+	// counting from 1.
+	Requests []int
+
+	// Latency is the delay of Latency and Timeout faults.
+	Latency time.Duration
+	// Status is the status code of Status faults.
+	Status int
+}
+
+func (f *Fault) matches(req *http.Request) bool {
+	return (f.Method == "" || f.Method == req.Method) && strings.HasPrefix(req.URL.Path, f.PathPrefix)
+}
+
+// Injection records a fault injected into a request.
+type Injection struct {
+	Request int
+	Method  string
+	Path    string
+	Kind    Kind
+}
+
+// Transport is an http.RoundTripper injecting faults.
+type Transport struct {
+	base   http.RoundTripper
+	faults []Fault
+
+	mu         sync.Mutex
+	rand       *rand.Rand
+	requests   int
+	matched    []int
+	injections []Injection
+}
+
+// New creates a new Transport that sends requests through base, or
+// http.DefaultTransport when base is nil, and injects faults into them.
+func New(seed int64, base http.RoundTripper, faults ...Fault) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:    base,
+		faults:  faults,
+		rand:    rand.New(rand.NewSource(seed)),
+		matched: make([]int, len(faults)),
+	}
+}
+
+// Injections returns the faults injected so far, in order.
+func (t *Transport) Injections() []Injection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Injection(nil), t.injections...)
+}
+
+// decide returns the faults to inject into req.
+func (t *Transport) decide(req *http.Request) []Fault {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	var selected []Fault
+	for i := range t.faults {
+		f := &t.faults[i]
+		if !f.matches(req) {
+			continue
+		}
+		t.matched[i]++
+		n := t.matched[i]
+
+		// always draw, so one fault's schedule does not shift another's
+		roll := t.rand.Float64()
+		inject := roll < f.Probability || (f.Every > 0 && n%f.Every == 0)
+		for _, r := range f.Requests {
+			inject = inject || r == n
+		}
+		if inject {
+			selected = append(selected, *f)
+			t.injections = append(t.injections, Injection{
+				Request: t.requests,
+				Method:  req.Method,
+				Path:    req.URL.Path,
+				Kind:    f.Kind,
+			})
+		}
+	}
+	return selected
+}
+
+// RoundTrip implements http.RoundTripper. Latency faults add up; of the
+// other selected faults the first one listed wins.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var failure *Fault
+	for _, f := range t.decide(req) {
+		f := f
+		if f.Kind == Latency {
+			if err := sleep(req.Context(), f.Latency); err != nil {
+				closeBody(req)
+				return nil, err
+			}
+			continue
+		}
+		if failure == nil {
+			failure = &f
+		}
+	}
+	if failure == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	switch failure.Kind {
+	case ConnectionReset:
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	case Timeout:
+		closeBody(req)
+		if err := sleep(req.Context(), failure.Latency); err != nil {
+			return nil, err
+		}
+		return nil, timeoutError{}
+	case Status:
+		closeBody(req)
+		return response(req, failure.Status, io.NopCloser(strings.NewReader(`{"message":"chaos: injected status"}`))), nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if failure.Kind == MalformedJSON {
+		resp.Body = io.NopCloser(strings.NewReader(`{"otp": {"id": "chaos",`))
+	} else {
+		resp.Body = &truncatedBody{Reader: bytes.NewReader(body[:len(body)/2])}
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// closeBody closes the body of a request that is not passed on, as
+// http.RoundTripper requires even on errors.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func response(req *http.Request, status int, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          body,
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "chaos: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// truncatedBody fails with io.ErrUnexpectedEOF once its content is read.
+type truncatedBody struct {
+	*bytes.Reader
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	httpclient "github.com/CeoFred/fast-otp/lib"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otpBody = `{"otp":{"id":"otp-1","identifier":"user","status":"pending"}}`
+
+func newAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, otpBody)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClient(server *httptest.Server, transport *Transport) *httpclient.APIClient {
+	return httpclient.NewAPIClient(server.URL, "key",
+		httpclient.WithHTTPClient(&http.Client{Transport: transport}))
+}
+
+func TestTransport_Status(t *testing.T) {
+	server := newAPI(t)
+	client := newClient(server, New(1, nil, Fault{Kind: Status, Every: 2, Status: http.StatusBadGateway}))
+
+	var statuses []int
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(context.Background(), "otp-1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{200, 502, 200, 502}, statuses)
+}
+
+func TestTransport_ConnectionReset(t *testing.T) {
+	server := newAPI(t)
+	client := newClient(server, New(1, nil, Fault{Kind: ConnectionReset, Requests: []int{1}}))
+
+	_, err := client.Post(context.Background(), "/generate", map[string]string{})
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+
+	resp, err := client.Post(context.Background(), "/generate", map[string]string{})
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestTransport_Timeout(t *testing.T) {
+	server := newAPI(t)
+	client := newClient(server, New(1, nil, Fault{Kind: Timeout, Probability: 1, Latency: 10 * time.Millisecond}))
+
+	_, err := client.Get(context.Background(), "otp-1")
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
+func TestTransport_LatencyHonoursContext(t *testing.T) {
+	server := newAPI(t)
+	client := newClient(server, New(1, nil, Fault{Kind: Latency, Probability: 1, Latency: time.Minute}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.Get(ctx, "otp-1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTransport_Bodies(t *testing.T) {
+	server := newAPI(t)
+	client := newClient(server, New(1, nil,
+		Fault{Kind: MalformedJSON, Requests: []int{1}},
+		Fault{Kind: TruncatedBody, Requests: []int{2}},
+	))
+
+	resp, err := client.Get(context.Background(), "otp-1")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.NotEqual(t, otpBody, string(body))
+
+	resp, err = client.Get(context.Background(), "otp-1")
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, otpBody[:len(otpBody)/2], string(body))
+}
+
+func TestTransport_Filters(t *testing.T) {
+	server := newAPI(t)
+	transport := New(1, nil, Fault{Kind: Status, Method: http.MethodPost, PathPrefix: "/validate", Probability: 1, Status: 503})
+	client := newClient(server, transport)
+
+	resp, err := client.Post(context.Background(), "/generate", map[string]string{})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = client.Post(context.Background(), "/validate", map[string]string{})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	assert.Equal(t, []Injection{{Request: 2, Method: http.MethodPost, Path: "/validate", Kind: Status}}, transport.Injections())
+}
+
+func TestTransport_SeedReproduces(t *testing.T) {
+	server := newAPI(t)
+	run := func(seed int64) []Injection {
+		transport := New(seed, nil, Fault{Kind: Status, Probability: 0.3, Status: 500})
+		client := newClient(server, transport)
+		for i := 0; i < 50; i++ {
+			resp, err := client.Get(context.Background(), "otp-1")
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		return transport.Injections()
+	}
+
+	first := run(7)
+	assert.NotEmpty(t, first)
+	assert.Less(t, len(first), 50)
+	assert.Equal(t, first, run(7))
+}
+
+// closeRecorder records whether a request body was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestTransport_ClosesRequestBodyOnInjectedFaults(t *testing.T) {
+	server := newAPI(t)
+	for _, fault := range []Fault{
+		{Kind: Status, Probability: 1, Status: http.StatusBadGateway},
+		{Kind: ConnectionReset, Probability: 1},
+		{Kind: Timeout, Probability: 1, Latency: time.Millisecond},
+	} {
+		body := &closeRecorder{Reader: strings.NewReader("{}")}
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/generate", body)
+		require.NoError(t, err)
+
+		resp, _ := New(1, nil, fault).RoundTrip(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		assert.True(t, body.closed, fault.Kind)
+	}
+}
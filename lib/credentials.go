@@ -0,0 +1,195 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoAPIKey is returned when a CredentialsProvider has no API key to offer.
+var ErrNoAPIKey = errors.New("no API key available")
+
+const redacted = "[REDACTED]"
+
+// Credentials is the API key to send with a request. While a key is being
+// rotated, Previous holds the key it replaces, which is tried when the API
+// rejects APIKey with 401 Unauthorized. The providers in this package stop
+// offering Previous an hour after the key changed.
+type Credentials struct {
+	APIKey   string
+	Previous string
+}
+
+// String keeps the keys out of logs.
+func (c Credentials) String() string {
+	return "Credentials{APIKey: " + redacted + "}"
+}
+
+// GoString keeps the keys out of logs.
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// CredentialsProvider supplies the API key. It is consulted on every request
+// so that keys can be rotated without restarting.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to a CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials calls f(ctx).
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials is a CredentialsProvider that always returns the same key.
+type StaticCredentials string
+
+// Credentials returns the static key.
+func (s StaticCredentials) Credentials(context.Context) (Credentials, error) {
+	return Credentials{APIKey: string(s)}, nil
+}
+
+// String keeps the key out of logs.
+func (s StaticCredentials) String() string {
+	return redacted
+}
+
+// GoString keeps the key out of logs.
+func (s StaticCredentials) GoString() string {
+	return redacted
+}
+
+// previousKeyTTL is how long the key a rotation replaced is still offered as
+// the fallback, which gives the API time to start accepting the new key.
+const previousKeyTTL = time.Hour
+
+// rotation remembers the key a provider handed out last, so the one it
+// replaces can be offered as the fallback until previousKeyTTL has passed.
+type rotation struct {
+	mu       sync.Mutex
+	current  string
+	previous string
+	changed  time.Time
+	now      func() time.Time // for tests; time.Now if nil
+}
+
+func (r *rotation) update(key string) Credentials {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key != r.current {
+		r.previous = r.current
+		r.current = key
+		r.changed = r.clock()
+	}
+	return r.locked()
+}
+
+func (r *rotation) credentials() Credentials {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.locked()
+}
+
+func (r *rotation) locked() Credentials {
+	if r.previous != "" && r.clock().Sub(r.changed) >= previousKeyTTL {
+		r.previous = ""
+	}
+	return Credentials{APIKey: r.current, Previous: r.previous}
+}
+
+func (r *rotation) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// EnvCredentials is a CredentialsProvider reading the key from an environment
+// variable on every request.
+type EnvCredentials struct {
+	name     string
+	rotation rotation
+}
+
+// NewEnvCredentials creates a new EnvCredentials reading the variable name.
+func NewEnvCredentials(name string) *EnvCredentials {
+	return &EnvCredentials{name: name}
+}
+
+// Credentials returns the current value of the environment variable, and,
+// for an hour after it changed, the value it had before.
+func (e *EnvCredentials) Credentials(context.Context) (Credentials, error) {
+	key := strings.TrimSpace(os.Getenv(e.name))
+	if key == "" {
+		return Credentials{}, fmt.Errorf("%w: %s is not set", ErrNoAPIKey, e.name)
+	}
+	return e.rotation.update(key), nil
+}
+
+// FileCredentials is a CredentialsProvider reading the key from the first
+// non-empty line of a file, such as a mounted secret. The file is read again
+// whenever its size or modification time changes.
+type FileCredentials struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	loaded   bool
+	rotation rotation
+}
+
+// NewFileCredentials creates a new FileCredentials reading path.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// Credentials returns the key currently in the file, and, for an hour after
+// it changed, the key it held before.
+func (f *FileCredentials) Credentials(context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if !f.loaded || !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		key, err := readKeyFile(f.path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		f.rotation.update(key)
+		f.modTime = info.ModTime()
+		f.size = info.Size()
+		f.loaded = true
+	}
+
+	return f.rotation.credentials(), nil
+}
+
+func readKeyFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is empty", ErrNoAPIKey, path)
+}
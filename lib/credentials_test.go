@@ -0,0 +1,121 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("FASTOTP_TEST_KEY", "")
+	provider := NewEnvCredentials("FASTOTP_TEST_KEY")
+
+	_, err := provider.Credentials(context.TODO())
+	assert.ErrorIs(t, err, ErrNoAPIKey)
+
+	t.Setenv("FASTOTP_TEST_KEY", "first")
+	creds, err := provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "first"}, creds)
+
+	t.Setenv("FASTOTP_TEST_KEY", "second")
+	creds, err = provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "second", Previous: "first"}, creds)
+}
+
+func TestEnvCredentials_PreviousKeyExpires(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)}
+	provider := NewEnvCredentials("FASTOTP_TEST_KEY")
+	provider.rotation.now = clock.Now
+
+	t.Setenv("FASTOTP_TEST_KEY", "first")
+	_, err := provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	t.Setenv("FASTOTP_TEST_KEY", "second")
+	_, err = provider.Credentials(context.TODO())
+	require.NoError(t, err)
+
+	clock.Advance(previousKeyTTL - time.Second)
+	creds, err := provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "second", Previous: "first"}, creds)
+
+	clock.Advance(time.Second)
+	creds, err = provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "second"}, creds)
+}
+
+func TestFileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(path, []byte("\nfirst\n"), 0o600))
+	provider := NewFileCredentials(path)
+
+	creds, err := provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "first"}, creds)
+
+	require.NoError(t, os.WriteFile(path, []byte("second-key\n"), 0o600))
+	creds, err = provider.Credentials(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{APIKey: "second-key", Previous: "first"}, creds)
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	_, err = provider.Credentials(context.TODO())
+	assert.ErrorIs(t, err, ErrNoAPIKey)
+}
+
+func TestAPIClient_FallsBackToPreviousKeyOn401(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("x-api-key")
+		keys = append(keys, key)
+		if key != "old" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	creds := Credentials{APIKey: "new", Previous: "old"}
+	client := NewAPIClient(server.URL, "", WithCredentials(CredentialsFunc(func(context.Context) (Credentials, error) {
+		return creds, nil
+	})))
+
+	resp, err := client.Post(context.TODO(), "/generate", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"new", "old"}, keys)
+
+	// without a previous key the 401 is returned as is
+	keys = nil
+	creds = Credentials{APIKey: "new"}
+	resp, err = client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, []string{"new"}, keys)
+}
+
+func TestAPIClient_StringHidesAPIKey(t *testing.T) {
+	client := NewAPIClient("https://api.fastotp.co", "super-secret-key")
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, client)
+		assert.NotContains(t, out, "super-secret-key", format)
+		assert.Contains(t, out, "https://api.fastotp.co", format)
+	}
+	assert.NotContains(t, fmt.Sprintf("%#v", Credentials{APIKey: "super-secret-key"}), "super-secret-key")
+}
@@ -0,0 +1,286 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultHealthCooldown = 30 * time.Second
+
+// WithBaseURLs replaces the client's base URL with an ordered list of base
+// URLs, such as regional endpoints or proxies. Requests go to the first
+// healthy one and fail over to the next when it cannot be reached or its
+// circuit breaker is open. GET requests also fail over on any other error or
+// 5xx response; POST requests such as /generate and /validate do not, as the
+// server may already have acted on them.
+func WithBaseURLs(urls ...string) Option {
+	return func(c *APIClient) {
+		if len(urls) == 0 {
+			return
+		}
+		c.baseURL = urls[0]
+		c.endpoints = make([]*endpoint, len(urls))
+		for i, url := range urls {
+			c.endpoints[i] = &endpoint{baseURL: url}
+		}
+	}
+}
+
+// WithHealthCooldown sets how long a base URL is skipped after it failed.
+// Defaults to 30s.
+func WithHealthCooldown(d time.Duration) Option {
+	return func(c *APIClient) {
+		c.healthCooldown = d
+	}
+}
+
+// WithHedging makes Get send a second request to the next base URL when the
+// first has not answered within delay, and use whichever answers first.
+// It only has an effect when the client has more than one base URL.
+func WithHedging(delay time.Duration) Option {
+	return func(c *APIClient) {
+		c.hedgeDelay = delay
+	}
+}
+
+// endpoint tracks the health of one base URL.
+type endpoint struct {
+	baseURL string
+
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+}
+
+func (e *endpoint) healthy(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !now.Before(e.unhealthyUntil)
+}
+
+func (e *endpoint) markUnhealthy(until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.unhealthyUntil = until
+}
+
+// Healthy reports whether baseURL is currently considered healthy. Unknown
+// base URLs are reported as unhealthy.
+func (c *APIClient) Healthy(baseURL string) bool {
+	for _, e := range c.endpoints {
+		if e.baseURL == baseURL {
+			return e.healthy(time.Now())
+		}
+	}
+	return false
+}
+
+// candidates returns the endpoints in the order they should be tried: the
+// healthy ones first, then the unhealthy ones as a last resort.
+func (c *APIClient) candidates() []*endpoint {
+	now := time.Now()
+	healthy := make([]*endpoint, 0, len(c.endpoints))
+	var unhealthy []*endpoint
+	for _, e := range c.endpoints {
+		if e.healthy(now) {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+type result struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// failed reports whether r counts against the health of its endpoint.
+func failed(r result) bool {
+	return r.err != nil || r.resp.StatusCode >= http.StatusInternalServerError
+}
+
+// shouldFailover reports whether another base URL should be tried after r.
+// Only GET requests are safe to repeat after any failure; the others are
+// only repeated when they provably never reached the server, so that a code
+// is never sent twice or a validation attempt counted twice.
+func shouldFailover(method string, r result) bool {
+	if method == http.MethodGet {
+		return failed(r)
+	}
+	return notSent(r.err)
+}
+
+// notSent reports whether err shows the request was never sent: it was
+// rejected by a circuit breaker or no connection could be made.
+func notSent(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// observe records the outcome of a request on e.
+func (c *APIClient) observe(ctx context.Context, e *endpoint, r result) {
+	if ctx.Err() != nil || errors.Is(r.err, ErrCircuitOpen) || !failed(r) {
+		return
+	}
+	e.markUnhealthy(time.Now().Add(c.healthCooldown))
+}
+
+// attempt sends the request to e, retrying once with the previous API key
+// when the current one is rejected during a key rotation.
+func (c *APIClient) attempt(ctx context.Context, e *endpoint, creds Credentials, method, path, breakerEndpoint string, body []byte) (*http.Response, error) {
+	resp, err := c.attemptWithKey(ctx, e, creds.APIKey, method, path, breakerEndpoint, body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized ||
+		creds.Previous == "" || creds.Previous == creds.APIKey {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	return c.attemptWithKey(ctx, e, creds.Previous, method, path, breakerEndpoint, body)
+}
+
+func (c *APIClient) attemptWithKey(ctx context.Context, e *endpoint, apiKey, method, path, breakerEndpoint string, body []byte) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, e.baseURL+path, apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req, e.baseURL, breakerEndpoint)
+}
+
+// send performs the request against the base URLs in turn until one of them
+// gives a usable answer. The last outcome is returned when none does.
+func (c *APIClient) send(ctx context.Context, method, path, breakerEndpoint string, body []byte) (*http.Response, error) {
+	creds, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := c.candidates()
+	if method == http.MethodGet && c.hedgeDelay > 0 && len(candidates) > 1 {
+		return c.sendHedged(ctx, candidates, creds, method, path, breakerEndpoint, body)
+	}
+
+	var last result
+	for i, e := range candidates {
+		resp, err := c.attempt(ctx, e, creds, method, path, breakerEndpoint, body)
+		r := result{index: i, resp: resp, err: err}
+		c.observe(ctx, e, r)
+
+		if last.resp != nil {
+			last.resp.Body.Close()
+		}
+		last = r
+
+		if !shouldFailover(method, r) || ctx.Err() != nil {
+			break
+		}
+	}
+	return last.resp, last.err
+}
+
+// sendHedged starts with the first candidate and adds the next one each time
+// hedgeDelay passes without an answer, or straight away when an attempt
+// fails, even while others are still pending. The first usable answer wins and the other attempts are cancelled.
+func (c *APIClient) sendHedged(ctx context.Context, candidates []*endpoint, creds Credentials, method, path, breakerEndpoint string, body []byte) (*http.Response, error) {
+	results := make(chan result, len(candidates))
+	cancels := make([]context.CancelFunc, 0, len(candidates))
+
+	launch := func() {
+		i := len(cancels)
+		e := candidates[i]
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := c.attempt(attemptCtx, e, creds, method, path, breakerEndpoint, body)
+			r := result{index: i, resp: resp, err: err}
+			c.observe(attemptCtx, e, r)
+			results <- r
+		}()
+	}
+
+	// finish cancels every attempt but the one that produced r, whose
+	// context lives until its body is closed, and discards late answers.
+	// Cancelled attempts report a neutral outcome to their breaker, since
+	// losing the race says nothing about the endpoint's health.
+	finish := func(r result, pending int) (*http.Response, error) {
+		for i, cancel := range cancels {
+			if i != r.index {
+				cancel()
+			}
+		}
+		go func() {
+			for ; pending > 0; pending-- {
+				if late := <-results; late.resp != nil {
+					late.resp.Body.Close()
+				}
+			}
+		}()
+
+		if r.resp == nil {
+			cancels[r.index]()
+			return nil, r.err
+		}
+		r.resp.Body = &cancelOnClose{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+		return r.resp, nil
+	}
+
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+
+	launch()
+	pending := 1
+	var last result
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) < len(candidates) {
+				launch()
+				pending++
+				timer.Reset(c.hedgeDelay)
+			}
+		case r := <-results:
+			pending--
+			if !shouldFailover(method, r) || ctx.Err() != nil {
+				if last.resp != nil {
+					last.resp.Body.Close()
+				}
+				return finish(r, pending)
+			}
+
+			if last.resp != nil {
+				last.resp.Body.Close()
+			}
+			last = r
+
+			if len(cancels) < len(candidates) {
+				launch()
+				pending++
+				timer.Reset(c.hedgeDelay)
+			} else if pending == 0 {
+				return finish(last, pending)
+			}
+		}
+	}
+}
+
+// cancelOnClose releases the context of a request once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,254 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(status int, delay time.Duration, body string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestAPIClient_FailoverOn5xx(t *testing.T) {
+	var primaryCalls, secondaryCalls int32
+	primary := newTestServer(http.StatusBadGateway, 0, "primary", &primaryCalls)
+	defer primary.Close()
+	secondary := newTestServer(http.StatusOK, 0, "secondary", &secondaryCalls)
+	defer secondary.Close()
+
+	client := NewAPIClient("", "test_api_key", WithBaseURLs(primary.URL, secondary.URL))
+
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "secondary", readBody(t, resp))
+	assert.False(t, client.Healthy(primary.URL))
+	assert.True(t, client.Healthy(secondary.URL))
+
+	// the unhealthy primary is skipped until its cool-down expires
+	resp, err = client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", readBody(t, resp))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&secondaryCalls))
+}
+
+func TestAPIClient_FailoverOnConnectionError(t *testing.T) {
+	var calls int32
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := newTestServer(http.StatusOK, 0, "up", &calls)
+	defer up.Close()
+
+	client := NewAPIClient("", "test_api_key", WithBaseURLs(down.URL, up.URL))
+
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "up", readBody(t, resp))
+	assert.False(t, client.Healthy(down.URL))
+
+	// a refused connection never reached the server, so POSTs fail over too
+	client = NewAPIClient("", "test_api_key", WithBaseURLs(down.URL, up.URL))
+	resp, err = client.Post(context.TODO(), "/generate", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "up", readBody(t, resp))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestAPIClient_NoPostFailoverOnceSent(t *testing.T) {
+	var primaryCalls, secondaryCalls int32
+	broken := newTestServer(http.StatusBadGateway, 0, "broken", &primaryCalls)
+	defer broken.Close()
+	slow := newTestServer(http.StatusOK, time.Second, "slow", &primaryCalls)
+	defer slow.Close()
+	secondary := newTestServer(http.StatusOK, 0, "secondary", &secondaryCalls)
+	defer secondary.Close()
+
+	client := NewAPIClient("", "test_api_key", WithBaseURLs(broken.URL, secondary.URL))
+	resp, err := client.Post(context.TODO(), "/generate", nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "broken", readBody(t, resp))
+	assert.False(t, client.Healthy(broken.URL))
+
+	// a timeout may come after the server acted on the request
+	client = NewAPIClient("", "test_api_key",
+		WithBaseURLs(slow.URL, secondary.URL),
+		WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond}),
+	)
+	_, err = client.Post(context.TODO(), "/validate", nil)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&primaryCalls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&secondaryCalls))
+}
+
+func TestAPIClient_AllEndpointsFailing(t *testing.T) {
+	var calls int32
+	first := newTestServer(http.StatusServiceUnavailable, 0, "first", &calls)
+	defer first.Close()
+	second := newTestServer(http.StatusInternalServerError, 0, "second", &calls)
+	defer second.Close()
+
+	client := NewAPIClient("", "test_api_key", WithBaseURLs(first.URL, second.URL))
+
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "second", readBody(t, resp))
+}
+
+func TestAPIClient_FailoverOnOpenBreaker(t *testing.T) {
+	var primaryCalls, secondaryCalls int32
+	primary := newTestServer(http.StatusOK, 0, "primary", &primaryCalls)
+	defer primary.Close()
+	secondary := newTestServer(http.StatusOK, 0, "secondary", &secondaryCalls)
+	defer secondary.Close()
+
+	client := NewAPIClient("", "test_api_key",
+		WithBaseURLs(primary.URL, secondary.URL),
+		WithCircuitBreaker(BreakerSettings{ConsecutiveFailures: 1}),
+	)
+	done, err := client.Breaker(primary.URL, "/generate").Allow()
+	require.NoError(t, err)
+	done(Failure)
+
+	resp, err := client.Post(context.TODO(), "/generate", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", readBody(t, resp))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&primaryCalls))
+}
+
+func TestAPIClient_HedgedGet(t *testing.T) {
+	var slowCalls, fastCalls int32
+	slow := newTestServer(http.StatusOK, time.Second, "slow", &slowCalls)
+	defer slow.Close()
+	fast := newTestServer(http.StatusOK, 0, "fast", &fastCalls)
+	defer fast.Close()
+
+	client := NewAPIClient("", "test_api_key",
+		WithBaseURLs(slow.URL, fast.URL),
+		WithHedging(20*time.Millisecond),
+	)
+
+	start := time.Now()
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "fast", readBody(t, resp))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fastCalls))
+
+	// POST requests are never hedged
+	resp, err = client.Post(context.TODO(), "/generate", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "slow", readBody(t, resp))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fastCalls))
+}
+
+func TestAPIClient_HedgedLosersAreNeutral(t *testing.T) {
+	var slowCalls, fastCalls int32
+	slow := newTestServer(http.StatusOK, time.Second, "slow", &slowCalls)
+	defer slow.Close()
+	fast := newTestServer(http.StatusOK, 0, "fast", &fastCalls)
+	defer fast.Close()
+
+	client := NewAPIClient("", "test_api_key",
+		WithBaseURLs(slow.URL, fast.URL),
+		WithHedging(20*time.Millisecond),
+		WithCircuitBreaker(BreakerSettings{ConsecutiveFailures: 1, CoolDown: 50 * time.Millisecond}),
+	)
+
+	cb := client.Breaker(slow.URL, getEndpoint)
+	done, err := cb.Allow()
+	require.NoError(t, err)
+	done(Failure)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, StateHalfOpen, cb.State())
+
+	// the slow endpoint takes the half-open trial slot and loses the race
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "fast", readBody(t, resp))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowCalls))
+
+	// once the cancelled attempt has reported, the slot is free again but the
+	// breaker has not been closed by it
+	require.Eventually(t, func() bool {
+		done, err := cb.Allow()
+		if err != nil {
+			return false
+		}
+		done(Neutral)
+		return true
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, StateHalfOpen, cb.State())
+}
+
+func TestAPIClient_HedgedGetFailsOverImmediately(t *testing.T) {
+	var calls int32
+	broken := newTestServer(http.StatusBadGateway, 0, "broken", &calls)
+	defer broken.Close()
+	ok := newTestServer(http.StatusOK, 0, "ok", &calls)
+	defer ok.Close()
+
+	client := NewAPIClient("", "test_api_key",
+		WithBaseURLs(broken.URL, ok.URL),
+		WithHedging(time.Minute),
+	)
+
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+}
+
+func TestAPIClient_HedgedGetFailsOverWhileAnotherIsSlow(t *testing.T) {
+	var calls int32
+	slow := newTestServer(http.StatusOK, 5*time.Second, "slow", &calls)
+	defer slow.Close()
+	broken := newTestServer(http.StatusBadGateway, 0, "broken", &calls)
+	defer broken.Close()
+	ok := newTestServer(http.StatusOK, 0, "ok", &calls)
+	defer ok.Close()
+
+	client := NewAPIClient("", "test_api_key",
+		WithBaseURLs(slow.URL, broken.URL, ok.URL),
+		WithHedging(300*time.Millisecond),
+	)
+
+	// the broken endpoint fails while the slow one is pending, and the next
+	// one is tried without waiting out a second hedge delay
+	start := time.Now()
+	resp, err := client.Get(context.TODO(), "some-id")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+	assert.Less(t, time.Since(start), 550*time.Millisecond)
+}
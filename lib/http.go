@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// getEndpoint names the endpoint used by Get for circuit breaking, as every
+// lookup shares it regardless of the id.
+const getEndpoint = "/{id}"
+
 var (
 	// FastOTPClient is the default HTTP client for the FastOtp package.
 	FastOTPClient = &http.Client{
@@ -23,51 +30,158 @@ var (
 
 // APIClient is a wrapper for making HTTP requests to the fastotp API.
 type APIClient struct {
-	baseURL string
-	apiKey  string
-	client  *http.Client
+	baseURL     string
+	credentials CredentialsProvider
+	client      *http.Client
+
+	endpoints      []*endpoint
+	healthCooldown time.Duration
+	hedgeDelay     time.Duration
+
+	breakerSettings *BreakerSettings
+	breakersMu      sync.Mutex
+	breakers        map[string]*CircuitBreaker
+}
+
+// Option configures an APIClient.
+type Option func(*APIClient)
+
+// WithCircuitBreaker guards every endpoint of the client with its own
+// circuit breaker built from settings. When the client has several base
+// URLs each of them gets its own breakers.
+func WithCircuitBreaker(settings BreakerSettings) Option {
+	return func(c *APIClient) {
+		c.breakerSettings = &settings
+	}
+}
+
+// WithCredentials makes the client ask provider for the API key on every
+// request instead of using the fixed key given to NewAPIClient.
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(c *APIClient) {
+		c.credentials = provider
+	}
+}
+
+// WithHTTPClient makes the client send requests with client instead of
+// FastOTPClient. An *http.Client is safe to share between APIClients.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *APIClient) {
+		c.client = client
+	}
 }
 
 // NewAPIClient creates a new instance of APIClient.
-func NewAPIClient(baseURL, apiKey string) *APIClient {
-	return &APIClient{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		client:  FastOTPClient,
+func NewAPIClient(baseURL, apiKey string, opts ...Option) *APIClient {
+	c := &APIClient{
+		baseURL:        baseURL,
+		credentials:    StaticCredentials(apiKey),
+		client:         FastOTPClient,
+		healthCooldown: defaultHealthCooldown,
+		breakers:       make(map[string]*CircuitBreaker),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	if len(c.endpoints) == 0 {
+		c.endpoints = []*endpoint{{baseURL: c.baseURL}}
+	}
+	return c
+}
+
+// String describes the client without revealing its API key.
+func (c *APIClient) String() string {
+	urls := make([]string, len(c.endpoints))
+	for i, e := range c.endpoints {
+		urls[i] = e.baseURL
+	}
+	return fmt.Sprintf("APIClient{baseURLs: %v, apiKey: %s}", urls, redacted)
+}
+
+// GoString describes the client without revealing its API key.
+func (c *APIClient) GoString() string {
+	return c.String()
+}
+
+// Breaker returns the circuit breaker guarding endpoint on baseURL, or nil
+// when the client was created without WithCircuitBreaker.
+func (c *APIClient) Breaker(baseURL, endpoint string) *CircuitBreaker {
+	if c.breakerSettings == nil {
+		return nil
+	}
+
+	name := baseURL + endpoint
+
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	cb, ok := c.breakers[name]
+	if !ok {
+		cb = NewCircuitBreaker(name, *c.breakerSettings)
+		c.breakers[name] = cb
+	}
+	return cb
 }
 
 // Post sends a POST request to the specified endpoint with the given payload.
 func (c *APIClient) Post(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
-	url := c.baseURL + endpoint
-
 	// Convert payload to JSON
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(payloadBytes))
+	return c.send(ctx, http.MethodPost, endpoint, endpoint, payloadBytes)
+}
+
+// Get sends a GET request to the specified endpoint, appending id as a path parameter
+func (c *APIClient) Get(ctx context.Context, id string) (*http.Response, error) {
+	return c.send(ctx, http.MethodGet, fmt.Sprintf("/%s", id), getEndpoint, nil)
+}
+
+func (c *APIClient) newRequest(ctx context.Context, method, url, apiKey string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("x-api-key", apiKey)
 
-	return c.client.Do(req)
+	return req, nil
 }
 
-// Get sends a GET request to the specified endpoint, appending id as a path parameter
-func (c *APIClient) Get(ctx context.Context, id string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s", c.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// do sends req through the circuit breaker guarding endpoint on baseURL, if any.
+func (c *APIClient) do(req *http.Request, baseURL, endpoint string) (*http.Response, error) {
+	cb := c.Breaker(baseURL, endpoint)
+	if cb == nil {
+		return c.client.Do(req)
+	}
+
+	done, err := cb.Allow()
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
+	resp, err := c.client.Do(req)
+	done(outcome(req.Context(), resp, err))
+	return resp, err
+}
 
-	return c.client.Do(req)
+// outcome sorts a request outcome for the endpoint's breaker. Requests
+// abandoned by the caller are neutral.
+func outcome(ctx context.Context, resp *http.Response, err error) Outcome {
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.Canceled):
+		return Neutral
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		return Failure
+	default:
+		return Success
+	}
 }
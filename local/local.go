@@ -0,0 +1,412 @@
+// Package local issues and checks OTPs in-process, for when the FastOTP API
+// is unavailable or not wanted, such as in internal tools.
+//
+// A Provider answers like the API does: it takes the same payloads, returns
+// the same *fastotp.OTP and fails with the same *fastotp.APIError, so it can
+// stand in for a *fastotp.FastOTP, for example behind httpotp. Codes are
+// handed to a Deliverer and only a salted hash of them is stored, unless
+// WithResendKey asks for an encrypted copy so that they can be resent.
+package local
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/internal/randutil"
+	"github.com/CeoFred/fast-otp/store"
+)
+
+const (
+	minTokenLength     = 4
+	maxTokenLength     = 12
+	saltSize           = 16
+	defaultMaxAttempts = 5
+)
+
+var alphabets = map[fastotp.OTPType]string{
+	fastotp.OTPTypeNumeric:      "0123456789",
+	fastotp.OTPTypeAlpha:        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	fastotp.OTPTypeAlphaNumeric: "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+}
+
+// Deliverer sends a freshly generated code to the targets in delivery.
+type Deliverer interface {
+	Deliver(ctx context.Context, otp *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error
+}
+
+// DeliverFunc adapts a function to a Deliverer.
+type DeliverFunc func(ctx context.Context, otp *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error
+
+// Deliver calls f.
+func (f DeliverFunc) Deliver(ctx context.Context, otp *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error {
+	return f(ctx, otp, token, delivery)
+}
+
+// Provider generates and validates OTPs in-process.
+type Provider struct {
+	deliverer   Deliverer
+	store       store.OTPStore
+	pepper      []byte
+	maxAttempts int
+	validators  []fastotp.PayloadValidator
+	resendKey   []byte
+	now         func() time.Time
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithStore keeps the OTPs in s. Defaults to a store.MemoryStore, which
+// loses them on restart and is not shared between instances.
+func WithStore(s store.OTPStore) Option {
+	return func(p *Provider) {
+		p.store = s
+	}
+}
+
+// WithPepper mixes key into every hash, so that the short codes cannot be
+// recovered from a leaked store by trying them all. Keep key out of the
+// store, and keep it stable: changing it invalidates pending codes.
+func WithPepper(key []byte) Option {
+	return func(p *Provider) {
+		p.pepper = key
+	}
+}
+
+// WithResendKey keeps each code encrypted under key next to its hash, so
+// that ResendOTP can deliver it again, for example on another channel. Use
+// a random key of at least 32 bytes, kept out of the store.
+func WithResendKey(key []byte) Option {
+	return func(p *Provider) {
+		digest := sha256.Sum256(key)
+		p.resendKey = digest[:]
+	}
+}
+
+// WithMaxAttempts sets how many wrong codes an OTP tolerates before it can no
+// longer be validated. Defaults to 5; 0 disables the limit.
+func WithMaxAttempts(n int) Option {
+	return func(p *Provider) {
+		p.maxAttempts = n
+	}
+}
+
+// WithPayloadValidator runs v on every payload that passes the built-in
+// checks, as fastotp.WithPayloadValidator does.
+func WithPayloadValidator(v fastotp.PayloadValidator) Option {
+	return func(p *Provider) {
+		p.validators = append(p.validators, v)
+	}
+}
+
+// New creates a new Provider handing codes to deliverer.
+func New(deliverer Deliverer, opts ...Option) *Provider {
+	p := &Provider{
+		deliverer:   deliverer,
+		maxAttempts: defaultMaxAttempts,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.store == nil {
+		p.store = store.NewMemoryStore()
+	}
+	return p
+}
+
+// GenerateOTP creates an OTP, stores the hash of its code and delivers the
+// code. If delivery fails the OTP is expired straight away. Delivery details
+// set by the Deliverer are stored with the OTP.
+func (p *Provider) GenerateOTP(ctx context.Context, payload fastotp.GenerateOTPPayload) (*fastotp.OTP, error) {
+	if err := checkPayload(payload); err != nil {
+		return nil, err
+	}
+	if len(p.validators) > 0 {
+		delivery := make(fastotp.OTPDelivery, len(payload.Delivery))
+		for channel, target := range payload.Delivery {
+			delivery[channel] = target
+		}
+		payload.Delivery = delivery
+	}
+	for _, v := range p.validators {
+		if err := v.ValidatePayload(ctx, &payload); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := randutil.String(alphabets[payload.Type], payload.TokenLength)
+	if err != nil {
+		return nil, err
+	}
+	id, err := randutil.UUID()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	now := p.now().UTC()
+	record := &store.Record{
+		OTP: fastotp.OTP{
+			ID:              id,
+			Identifier:      payload.Identifier,
+			Status:          fastotp.OTPStatusPending,
+			Type:            payload.Type,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			ExpiresAt:       now.Add(time.Duration(payload.Validity) * time.Second),
+			DeliveryDetails: fastotp.DeliveryDetails{Email: payload.Delivery["email"]},
+		},
+		Secret: append(salt, p.hash(salt, token)...),
+	}
+	if p.resendKey != nil {
+		sealed, err := p.seal(id, token)
+		if err != nil {
+			return nil, err
+		}
+		record.Secret = append(record.Secret, sealed...)
+	}
+	for channel := range payload.Delivery {
+		record.OTP.DeliveryMethods = append(record.OTP.DeliveryMethods, channel)
+	}
+
+	if err := p.store.Put(ctx, record); err != nil {
+		return nil, err
+	}
+
+	// the deliverer may report its progress in the delivery details
+	otp := record.OTP
+	deliverErr := p.deliverer.Deliver(ctx, &otp, token, payload.Delivery)
+	record.OTP.DeliveryDetails = otp.DeliveryDetails
+	if deliverErr != nil {
+		record.OTP.ExpiresAt = now
+	}
+	if err := p.store.CompareAndSwap(ctx, record); err != nil {
+		return nil, errors.Join(deliverErr, err)
+	}
+	if deliverErr != nil {
+		return nil, deliverErr
+	}
+	return &otp, nil
+}
+
+// ValidateOTP checks token against the newest OTP of the identifier, which
+// must still be pending and unexpired. An accepted OTP is marked validated
+// and cannot be used again.
+func (p *Provider) ValidateOTP(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error) {
+	// a swap that conflicts with a concurrent request is retried on a fresh
+	// read, so that every wrong code is counted and the limit checked again
+	for {
+		otp, err := p.validate(ctx, payload)
+		if !errors.Is(err, store.ErrConflict) {
+			return otp, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Provider) validate(ctx context.Context, payload fastotp.ValidateOTPPayload) (*fastotp.OTP, error) {
+	record, err := p.store.GetByIdentifier(ctx, payload.Identifier)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errInvalidToken()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := p.now().UTC()
+	if record.OTP.Status != fastotp.OTPStatusPending || !now.Before(record.OTP.ExpiresAt) ||
+		(p.maxAttempts > 0 && record.Attempts >= p.maxAttempts) || len(record.Secret) < saltSize+sha256.Size {
+		return nil, errInvalidToken()
+	}
+
+	salt, hash := record.Secret[:saltSize], record.Secret[saltSize:saltSize+sha256.Size]
+	if !hmac.Equal(hash, p.hash(salt, payload.Token)) {
+		record.Attempts++
+		if err := p.store.CompareAndSwap(ctx, record); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidToken()
+	}
+
+	// if a concurrent request used the code first, the retry finds it
+	// validated
+	record.OTP.Status = fastotp.OTPStatusValidated
+	record.OTP.UpdatedAt = now
+	if err := p.store.CompareAndSwap(ctx, record); err != nil {
+		return nil, err
+	}
+
+	otp := record.OTP
+	return &otp, nil
+}
+
+// ResendOTP delivers the code of the pending OTP with id again, to the
+// targets in delivery, which may be on other channels than before. The
+// channels are added to the OTP's delivery methods. It fails with
+// fastotp.ErrCannotResend without WithResendKey, or for OTPs generated
+// before the key was set.
+func (p *Provider) ResendOTP(ctx context.Context, id string, delivery fastotp.OTPDelivery) (*fastotp.OTP, error) {
+	if p.resendKey == nil {
+		return nil, fastotp.ErrCannotResend
+	}
+
+	record, err := p.store.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, &fastotp.APIError{StatusCode: http.StatusNotFound, Message: "OTP not found."}
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := p.now().UTC()
+	if record.OTP.Status != fastotp.OTPStatusPending || !now.Before(record.OTP.ExpiresAt) {
+		return nil, errInvalidToken()
+	}
+
+	payload := fastotp.GenerateOTPPayload{Identifier: record.OTP.Identifier, Delivery: make(fastotp.OTPDelivery, len(delivery))}
+	for channel, target := range delivery {
+		payload.Delivery[channel] = target
+	}
+	if len(payload.Delivery) == 0 {
+		return nil, &fastotp.APIError{StatusCode: http.StatusUnprocessableEntity, Message: "The given data was invalid.",
+			Errors: map[string][]string{"delivery": {"The delivery field is required."}}}
+	}
+	for _, v := range p.validators {
+		if err := v.ValidatePayload(ctx, &payload); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := p.open(record)
+	if err != nil {
+		return nil, err
+	}
+
+	otp := record.OTP
+	deliverErr := p.deliverer.Deliver(ctx, &otp, token, payload.Delivery)
+	record.OTP.DeliveryDetails = otp.DeliveryDetails
+	record.OTP.UpdatedAt = now
+	for channel := range payload.Delivery {
+		if !slices.Contains(record.OTP.DeliveryMethods, channel) {
+			record.OTP.DeliveryMethods = append(record.OTP.DeliveryMethods, channel)
+		}
+	}
+	if err := p.store.CompareAndSwap(ctx, record); err != nil {
+		return nil, errors.Join(deliverErr, err)
+	}
+	if deliverErr != nil {
+		return nil, deliverErr
+	}
+	otp = record.OTP
+	return &otp, nil
+}
+
+// GetOtp returns the OTP with the given ID.
+func (p *Provider) GetOtp(ctx context.Context, id string) (*fastotp.OTP, error) {
+	record, err := p.store.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, &fastotp.APIError{StatusCode: http.StatusNotFound, Message: "OTP not found."}
+	}
+	if err != nil {
+		return nil, err
+	}
+	otp := record.OTP
+	return &otp, nil
+}
+
+// Erase removes the OTPs of identifier. It fails if the store does not
+// implement fastotp.Eraser.
+func (p *Provider) Erase(ctx context.Context, identifier string) error {
+	eraser, ok := p.store.(fastotp.Eraser)
+	if !ok {
+		return fmt.Errorf("store %T cannot erase records", p.store)
+	}
+	return eraser.Erase(ctx, identifier)
+}
+
+func (p *Provider) hash(salt []byte, token string) []byte {
+	mac := hmac.New(sha256.New, p.pepper)
+	mac.Write(salt)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
+
+// seal encrypts token under the resend key, bound to the OTP's ID.
+func (p *Provider) seal(id, token string) ([]byte, error) {
+	aead, err := p.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(token), []byte(id)), nil
+}
+
+// open decrypts the code sealed in record.
+func (p *Provider) open(record *store.Record) (string, error) {
+	aead, err := p.aead()
+	if err != nil {
+		return "", err
+	}
+	sealed := record.Secret[min(len(record.Secret), saltSize+sha256.Size):]
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: no code kept for %s", fastotp.ErrCannotResend, record.OTP.ID)
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(record.OTP.ID))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", fastotp.ErrCannotResend, err)
+	}
+	return string(token), nil
+}
+
+func (p *Provider) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(p.resendKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func checkPayload(payload fastotp.GenerateOTPPayload) error {
+	errs := map[string][]string{}
+	if payload.Identifier == "" {
+		errs["identifier"] = []string{"The identifier field is required."}
+	}
+	if len(payload.Delivery) == 0 {
+		errs["delivery"] = []string{"The delivery field is required."}
+	}
+	if _, ok := alphabets[payload.Type]; !ok {
+		errs["type"] = []string{"The selected type is invalid."}
+	}
+	if payload.TokenLength < minTokenLength || payload.TokenLength > maxTokenLength {
+		errs["token_length"] = []string{fmt.Sprintf("The token length must be between %d and %d.", minTokenLength, maxTokenLength)}
+	}
+	if payload.Validity <= 0 {
+		errs["validity"] = []string{"The validity must be at least 1."}
+	}
+	if len(errs) > 0 {
+		return &fastotp.APIError{StatusCode: http.StatusUnprocessableEntity, Message: "The given data was invalid.", Errors: errs}
+	}
+	return nil
+}
+
+func errInvalidToken() error {
+	return &fastotp.APIError{StatusCode: http.StatusBadRequest, Message: "Invalid or expired token."}
+}
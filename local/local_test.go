@@ -0,0 +1,318 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/httpotp"
+	"github.com/CeoFred/fast-otp/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ httpotp.Service = (*Provider)(nil)
+
+// outbox remembers the last code delivered to each identifier.
+type outbox struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func (o *outbox) Deliver(_ context.Context, otp *fastotp.OTP, token string, _ fastotp.OTPDelivery) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.codes == nil {
+		o.codes = map[string]string{}
+	}
+	o.codes[otp.Identifier] = token
+	return nil
+}
+
+func (o *outbox) code(identifier string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.codes[identifier]
+}
+
+func generatePayload(otpType fastotp.OTPType, length int) fastotp.GenerateOTPPayload {
+	return fastotp.GenerateOTPPayload{
+		Delivery:    fastotp.OTPDelivery{"email": "user@example.com"},
+		Identifier:  "user",
+		Type:        otpType,
+		TokenLength: length,
+		Validity:    60,
+	}
+}
+
+func assertStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	apiErr, ok := fastotp.AsAPIError(err)
+	require.True(t, ok, "expected *fastotp.APIError, got %v", err)
+	assert.Equal(t, status, apiErr.StatusCode)
+}
+
+func TestProvider_GenerateAndValidate(t *testing.T) {
+	ctx := context.Background()
+	box := &outbox{}
+	s := store.NewMemoryStore()
+	p := New(box, WithStore(s), WithPepper([]byte("pepper")))
+
+	otp, err := p.GenerateOTP(ctx, generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusPending, otp.Status)
+	assert.Equal(t, "user@example.com", otp.DeliveryDetails.Email)
+	assert.Equal(t, []string{"email"}, otp.DeliveryMethods)
+	assert.WithinDuration(t, otp.CreatedAt.Add(time.Minute), otp.ExpiresAt, 0)
+
+	code := box.code("user")
+	assert.Len(t, code, 6)
+
+	// only a salted hash is stored
+	record, err := s.Get(ctx, otp.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, string(record.Secret), code)
+
+	validated, err := p.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: "user", Token: code})
+	require.NoError(t, err)
+	assert.Equal(t, otp.ID, validated.ID)
+	assert.Equal(t, fastotp.OTPStatusValidated, validated.Status)
+
+	got, err := p.GetOtp(ctx, otp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusValidated, got.Status)
+
+	// single use
+	_, err = p.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: "user", Token: code})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestProvider_TokenAlphabets(t *testing.T) {
+	box := &outbox{}
+	p := New(box)
+
+	for otpType, alphabet := range alphabets {
+		for i := 0; i < 20; i++ {
+			_, err := p.GenerateOTP(context.Background(), generatePayload(otpType, 12))
+			require.NoError(t, err)
+			code := box.code("user")
+			require.Len(t, code, 12)
+			for _, c := range code {
+				assert.True(t, strings.ContainsRune(alphabet, c), "%q not in %s alphabet", c, otpType)
+			}
+		}
+	}
+}
+
+func TestProvider_InvalidPayload(t *testing.T) {
+	p := New(&outbox{})
+	payload := generatePayload("hex", 3)
+	payload.Validity = 0
+
+	_, err := p.GenerateOTP(context.Background(), payload)
+	assertStatus(t, err, http.StatusUnprocessableEntity)
+	apiErr, _ := fastotp.AsAPIError(err)
+	assert.Contains(t, apiErr.Errors, "type")
+	assert.Contains(t, apiErr.Errors, "token_length")
+	assert.Contains(t, apiErr.Errors, "validity")
+}
+
+func TestProvider_Expiry(t *testing.T) {
+	box := &outbox{}
+	p := New(box)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	_, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: box.code("user")})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestProvider_MaxAttempts(t *testing.T) {
+	box := &outbox{}
+	p := New(box, WithMaxAttempts(2))
+
+	_, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeAlpha, 6))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: "0000"})
+		assertStatus(t, err, http.StatusBadRequest)
+	}
+	_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: box.code("user")})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestProvider_OnlyNewestCodeValidates(t *testing.T) {
+	box := &outbox{}
+	p := New(box)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	_, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	first := box.code("user")
+
+	now = now.Add(time.Second)
+	_, err = p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	second := box.code("user")
+
+	if first != second {
+		_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: first})
+		assertStatus(t, err, http.StatusBadRequest)
+	}
+	_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: second})
+	assert.NoError(t, err)
+}
+
+func TestProvider_ConcurrentValidationSucceedsOnce(t *testing.T) {
+	box := &outbox{}
+	p := New(box)
+
+	_, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	code := box.code("user")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: code}); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, accepted)
+}
+
+// slowStore pauses after reads, so that concurrent requests read the same
+// version of a record.
+type slowStore struct {
+	store.OTPStore
+}
+
+func (s slowStore) GetByIdentifier(ctx context.Context, identifier string) (*store.Record, error) {
+	record, err := s.OTPStore.GetByIdentifier(ctx, identifier)
+	time.Sleep(5 * time.Millisecond)
+	return record, err
+}
+
+func TestProvider_ConcurrentWrongCodesAreAllCounted(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		maxAttempts int
+		want        int
+	}{
+		{"unlimited", 0, 20},
+		{"limited", 5, 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			p := New(&outbox{}, WithStore(slowStore{s}), WithMaxAttempts(tt.maxAttempts))
+			otp, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+			require.NoError(t, err)
+
+			errs := make([]error, 20)
+			var wg sync.WaitGroup
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: "0000"})
+				}(i)
+			}
+			wg.Wait()
+			for _, err := range errs {
+				assertStatus(t, err, http.StatusBadRequest)
+			}
+
+			record, err := s.Get(context.Background(), otp.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, record.Attempts)
+		})
+	}
+}
+
+func TestProvider_DeliveryFailureExpiresOTP(t *testing.T) {
+	errDown := errors.New("smtp down")
+	var token string
+	s := store.NewMemoryStore()
+	p := New(DeliverFunc(func(_ context.Context, _ *fastotp.OTP, code string, _ fastotp.OTPDelivery) error {
+		token = code
+		return errDown
+	}), WithStore(s))
+
+	_, err := p.GenerateOTP(context.Background(), generatePayload(fastotp.OTPTypeNumeric, 6))
+	assert.ErrorIs(t, err, errDown)
+
+	_, err = p.ValidateOTP(context.Background(), fastotp.ValidateOTPPayload{Identifier: "user", Token: token})
+	assertStatus(t, err, http.StatusBadRequest)
+}
+
+func TestProvider_GetOtpNotFound(t *testing.T) {
+	_, err := New(&outbox{}).GetOtp(context.Background(), "missing")
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestProvider_ResendOTP(t *testing.T) {
+	ctx := context.Background()
+	box := &outbox{}
+	p := New(box, WithResendKey([]byte("resend-key")))
+
+	otp, err := p.GenerateOTP(ctx, generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	code := box.code("user")
+
+	box.codes = nil
+	resent, err := p.ResendOTP(ctx, otp.ID, fastotp.OTPDelivery{"sms": "+2348012345678"})
+	require.NoError(t, err)
+	assert.Equal(t, otp.ID, resent.ID)
+	assert.ElementsMatch(t, []string{"email", "sms"}, resent.DeliveryMethods)
+	assert.Equal(t, code, box.code("user"), "the same code is delivered")
+
+	_, err = p.ValidateOTP(ctx, fastotp.ValidateOTPPayload{Identifier: "user", Token: code})
+	require.NoError(t, err)
+
+	// a validated OTP is not sent again
+	_, err = p.ResendOTP(ctx, otp.ID, fastotp.OTPDelivery{"sms": "+2348012345678"})
+	assertStatus(t, err, http.StatusBadRequest)
+	_, err = p.ResendOTP(ctx, "missing", fastotp.OTPDelivery{"sms": "+2348012345678"})
+	assertStatus(t, err, http.StatusNotFound)
+}
+
+func TestProvider_ResendOTPNeedsKey(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	otp, err := New(&outbox{}, WithStore(s)).GenerateOTP(ctx, generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+
+	_, err = New(&outbox{}, WithStore(s)).ResendOTP(ctx, otp.ID, fastotp.OTPDelivery{"sms": "+2348012345678"})
+	assert.ErrorIs(t, err, fastotp.ErrCannotResend)
+
+	// the code was not kept when the OTP was generated
+	_, err = New(&outbox{}, WithStore(s), WithResendKey([]byte("resend-key"))).ResendOTP(ctx, otp.ID, fastotp.OTPDelivery{"sms": "+2348012345678"})
+	assert.ErrorIs(t, err, fastotp.ErrCannotResend)
+
+	// nor can another key recover it
+	withKey := New(&outbox{}, WithStore(s), WithResendKey([]byte("resend-key")))
+	otp, err = withKey.GenerateOTP(ctx, generatePayload(fastotp.OTPTypeNumeric, 6))
+	require.NoError(t, err)
+	_, err = New(&outbox{}, WithStore(s), WithResendKey([]byte("other-key"))).ResendOTP(ctx, otp.ID, fastotp.OTPDelivery{"sms": "+2348012345678"})
+	assert.ErrorIs(t, err, fastotp.ErrCannotResend)
+}
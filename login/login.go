@@ -0,0 +1,328 @@
+// Package login issues signed session tokens once an OTP has been validated,
+// so that services share one passwordless login flow. Tokens are compact JWTs
+// signed with HS256 or EdDSA, built with the standard library only.
+package login
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+const defaultTTL = time.Hour
+
+var (
+	// ErrNotValidated is returned when minting a token for an OTP that has
+	// not been validated.
+	ErrNotValidated = errors.New("otp has not been validated")
+	// ErrMalformedToken is returned when a token cannot be parsed.
+	ErrMalformedToken = errors.New("malformed token")
+	// ErrUnknownKey is returned when a token was signed with a key the
+	// issuer does not know.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrInvalidSignature is returned when a token's signature does not match.
+	ErrInvalidSignature = errors.New("invalid token signature")
+	// ErrExpired is returned when a token has expired.
+	ErrExpired = errors.New("token has expired")
+	// ErrInvalidAudience is returned when a token was not issued for the
+	// expected audience.
+	ErrInvalidAudience = errors.New("invalid token audience")
+	// ErrInvalidIssuer is returned when a token was issued by someone else.
+	ErrInvalidIssuer = errors.New("invalid token issuer")
+	// ErrInvalidKey is returned when creating a key from material of the
+	// wrong size.
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// Algorithm is a JWS signing algorithm.
+type Algorithm string
+
+const (
+	// HS256 is HMAC with SHA-256.
+	HS256 Algorithm = "HS256"
+	// EdDSA is Ed25519.
+	EdDSA Algorithm = "EdDSA"
+)
+
+// Key is a signing or verification key, identified in tokens by its ID.
+type Key struct {
+	ID        string
+	Algorithm Algorithm
+
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewHS256Key creates a new HS256 key from secret, which should be at least
+// 32 random bytes.
+func NewHS256Key(id string, secret []byte) Key {
+	return Key{ID: id, Algorithm: HS256, secret: append([]byte(nil), secret...)}
+}
+
+// NewEdDSAKey creates a new EdDSA key able to sign and verify tokens.
+func NewEdDSAKey(id string, privateKey ed25519.PrivateKey) (Key, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return Key{}, fmt.Errorf("%w: ed25519 private key is %d bytes, want %d", ErrInvalidKey, len(privateKey), ed25519.PrivateKeySize)
+	}
+	return Key{
+		ID:         id,
+		Algorithm:  EdDSA,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// NewEdDSAVerificationKey creates a new EdDSA key that can only verify tokens.
+func NewEdDSAVerificationKey(id string, publicKey ed25519.PublicKey) (Key, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return Key{}, fmt.Errorf("%w: ed25519 public key is %d bytes, want %d", ErrInvalidKey, len(publicKey), ed25519.PublicKeySize)
+	}
+	return Key{ID: id, Algorithm: EdDSA, publicKey: publicKey}, nil
+}
+
+func (k Key) canSign() bool {
+	switch k.Algorithm {
+	case HS256:
+		return len(k.secret) > 0
+	case EdDSA:
+		return len(k.privateKey) == ed25519.PrivateKeySize
+	}
+	return false
+}
+
+func (k Key) sign(input []byte) []byte {
+	if k.Algorithm == EdDSA {
+		return ed25519.Sign(k.privateKey, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		return len(k.secret) > 0 && hmac.Equal(k.sign(input), signature)
+	case EdDSA:
+		return len(k.publicKey) == ed25519.PublicKeySize && ed25519.Verify(k.publicKey, input, signature)
+	}
+	return false
+}
+
+// Claims are the contents of a session token.
+type Claims struct {
+	ID       string   `json:"jti"`
+	Issuer   string   `json:"iss,omitempty"`
+	Subject  string   `json:"sub"`
+	Audience []string `json:"aud,omitempty"`
+	IssuedAt int64    `json:"iat"`
+	Expiry   int64    `json:"exp"`
+	AuthTime int64    `json:"auth_time"`
+	OTPID    string   `json:"otp_id"`
+}
+
+// HasAudience reports whether the token was issued for audience.
+func (c *Claims) HasAudience(audience string) bool {
+	for _, a := range c.Audience {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ"`
+	KeyID     string    `json:"kid"`
+}
+
+// Config configures an Issuer.
+type Config struct {
+	// Issuer is written to and required in the iss claim.
+	Issuer string
+	// Audience is written to the aud claim of minted tokens.
+	Audience []string
+	// TTL is how long tokens are valid. Defaults to one hour.
+	TTL time.Duration
+	// Leeway tolerates clock skew when checking expiry.
+	Leeway time.Duration
+}
+
+// Issuer mints and verifies session tokens. Keys can be rotated at runtime:
+// tokens are always signed with the current key and verified with any
+// known key.
+type Issuer struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	signing Key
+	keys    map[string]Key
+}
+
+// NewIssuer creates a new Issuer signing with signing and also accepting
+// tokens signed with any of verification.
+func NewIssuer(config Config, signing Key, verification ...Key) (*Issuer, error) {
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+
+	i := &Issuer{
+		config: config,
+		now:    time.Now,
+		keys:   make(map[string]Key),
+	}
+	for _, key := range verification {
+		i.keys[key.ID] = key
+	}
+	if err := i.Rotate(signing); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Rotate makes key the signing key. The previous signing key is still
+// accepted for verification until it is removed with RemoveKey.
+func (i *Issuer) Rotate(key Key) error {
+	if key.ID == "" || !key.canSign() {
+		return fmt.Errorf("key %q cannot sign tokens", key.ID)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.signing = key
+	i.keys[key.ID] = key
+	return nil
+}
+
+// RemoveKey stops accepting tokens signed with the key id. The current
+// signing key cannot be removed.
+func (i *Issuer) RemoveKey(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if id != i.signing.ID {
+		delete(i.keys, id)
+	}
+}
+
+// Mint issues a session token for a validated OTP.
+func (i *Issuer) Mint(otp *fastotp.OTP) (string, error) {
+	if otp == nil || otp.Status != fastotp.OTPStatusValidated {
+		return "", ErrNotValidated
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := i.now()
+	authTime := otp.UpdatedAt
+	if authTime.IsZero() {
+		authTime = now
+	}
+
+	i.mu.RLock()
+	key := i.signing
+	i.mu.RUnlock()
+
+	return encode(key, Claims{
+		ID:       hex.EncodeToString(jti),
+		Issuer:   i.config.Issuer,
+		Subject:  otp.Identifier,
+		Audience: i.config.Audience,
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(i.config.TTL).Unix(),
+		AuthTime: authTime.Unix(),
+		OTPID:    otp.ID,
+	})
+}
+
+func encode(key Key, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return input + "." + base64.RawURLEncoding.EncodeToString(key.sign([]byte(input))), nil
+}
+
+// Verify checks the token's signature, issuer, expiry and audience. A token
+// minted with an audience is only accepted when audience is one of them; an
+// empty audience only accepts tokens minted without one.
+func (i *Issuer) Verify(token, audience string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	key, ok := i.keys[h.KeyID]
+	i.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, h.KeyID)
+	}
+	// the key decides the algorithm, never the token
+	if h.Algorithm != key.Algorithm {
+		return nil, ErrInvalidSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if i.now().Add(-i.config.Leeway).Unix() >= claims.Expiry {
+		return nil, ErrExpired
+	}
+	if claims.Issuer != i.config.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if (audience == "" && len(claims.Audience) > 0) || (audience != "" && !claims.HasAudience(audience)) {
+		return nil, ErrInvalidAudience
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrMalformedToken
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package login
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var validatedOTP = &fastotp.OTP{
+	ID:         "9b202659-fee7-46ab-836b-cdd310c4f327",
+	Identifier: "test_identifier",
+	Status:     fastotp.OTPStatusValidated,
+	UpdatedAt:  time.Date(2024, 1, 19, 0, 24, 6, 0, time.UTC),
+}
+
+func newTestIssuer(t *testing.T, signing Key, verification ...Key) (*Issuer, *time.Time) {
+	t.Helper()
+	issuer, err := NewIssuer(Config{
+		Issuer:   "https://auth.example.com",
+		Audience: []string{"web", "mobile"},
+		TTL:      time.Hour,
+	}, signing, verification...)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 19, 0, 25, 0, 0, time.UTC)
+	issuer.now = func() time.Time { return now }
+	return issuer, &now
+}
+
+func TestIssuer_HS256(t *testing.T) {
+	issuer, now := newTestIssuer(t, NewHS256Key("k1", []byte("0123456789abcdef0123456789abcdef")))
+
+	token, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+
+	claims, err := issuer.Verify(token, "web")
+	require.NoError(t, err)
+	assert.Equal(t, "test_identifier", claims.Subject)
+	assert.Equal(t, validatedOTP.ID, claims.OTPID)
+	assert.Equal(t, validatedOTP.UpdatedAt.Unix(), claims.AuthTime)
+	assert.Equal(t, now.Add(time.Hour).Unix(), claims.Expiry)
+	assert.NotEmpty(t, claims.ID)
+
+	_, err = issuer.Verify(token, "admin")
+	assert.ErrorIs(t, err, ErrInvalidAudience)
+	_, err = issuer.Verify(token, "")
+	assert.ErrorIs(t, err, ErrInvalidAudience, "an audience is required for tokens minted with one")
+
+	*now = now.Add(time.Hour)
+	_, err = issuer.Verify(token, "web")
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestIssuer_NoAudience(t *testing.T) {
+	issuer, err := NewIssuer(Config{Issuer: "https://auth.example.com"}, NewHS256Key("k1", []byte("secret")))
+	require.NoError(t, err)
+	token, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+
+	_, err = issuer.Verify(token, "")
+	assert.NoError(t, err)
+	_, err = issuer.Verify(token, "web")
+	assert.ErrorIs(t, err, ErrInvalidAudience)
+}
+
+func TestIssuer_EdDSA(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewEdDSAKey("ed1", privateKey)
+	require.NoError(t, err)
+	issuer, _ := newTestIssuer(t, key)
+
+	token, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+
+	// a service holding only the public key can verify the token
+	publicKey, err := NewEdDSAVerificationKey("ed1", privateKey.Public().(ed25519.PublicKey))
+	require.NoError(t, err)
+	verifier, _ := newTestIssuer(t, NewHS256Key("unused", []byte("secret")), publicKey)
+	claims, err := verifier.Verify(token, "mobile")
+	require.NoError(t, err)
+	assert.Equal(t, "test_identifier", claims.Subject)
+
+	_, err = NewEdDSAKey("short", privateKey[:32])
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = NewEdDSAVerificationKey("short", ed25519.PublicKey(privateKey))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestIssuer_MintRequiresValidatedOTP(t *testing.T) {
+	issuer, _ := newTestIssuer(t, NewHS256Key("k1", []byte("secret")))
+
+	pending := *validatedOTP
+	pending.Status = fastotp.OTPStatusPending
+	_, err := issuer.Mint(&pending)
+	assert.ErrorIs(t, err, ErrNotValidated)
+
+	_, err = issuer.Mint(nil)
+	assert.ErrorIs(t, err, ErrNotValidated)
+}
+
+func TestIssuer_KeyRotation(t *testing.T) {
+	issuer, _ := newTestIssuer(t, NewHS256Key("k1", []byte("first secret")))
+	oldToken, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+
+	require.NoError(t, issuer.Rotate(NewHS256Key("k2", []byte("second secret"))))
+	newToken, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+
+	_, err = issuer.Verify(oldToken, "web")
+	require.NoError(t, err)
+	_, err = issuer.Verify(newToken, "web")
+	require.NoError(t, err)
+
+	issuer.RemoveKey("k1")
+	_, err = issuer.Verify(oldToken, "web")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	issuer.RemoveKey("k2")
+	_, err = issuer.Verify(newToken, "web")
+	assert.NoError(t, err, "the signing key cannot be removed")
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := NewEdDSAVerificationKey("ed1", privateKey.Public().(ed25519.PublicKey))
+	require.NoError(t, err)
+	assert.Error(t, issuer.Rotate(publicKey))
+}
+
+func TestIssuer_RejectsTampering(t *testing.T) {
+	issuer, _ := newTestIssuer(t, NewHS256Key("k1", []byte("secret")))
+	token, err := issuer.Mint(validatedOTP)
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	claims, err := issuer.Verify(token, "web")
+	require.NoError(t, err)
+	claims.Subject = "someone_else"
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	_, err = issuer.Verify(parts[0]+"."+base64.RawURLEncoding.EncodeToString(payload)+"."+parts[2], "web")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"k1"}`))
+	_, err = issuer.Verify(none+"."+parts[1]+".", "web")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = issuer.Verify("not-a-token", "web")
+	assert.ErrorIs(t, err, ErrMalformedToken)
+
+	other, _ := newTestIssuer(t, NewHS256Key("k1", []byte("secret")))
+	other.config.Issuer = "https://evil.example.com"
+	_, err = other.Verify(token, "web")
+	assert.ErrorIs(t, err, ErrInvalidIssuer)
+}
@@ -0,0 +1,94 @@
+package fastotp
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// MaskEmail hides most of the local part of an email address, keeping its
+// first character and the domain: "alice@example.com" becomes
+// "a****@example.com".
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return maskTail(email, 0)
+	}
+	return maskTail(local, 1) + "@" + domain
+}
+
+// MaskPhone hides all but the last four digits of a phone number, keeping a
+// leading "+": "+2348012345678" becomes "+*********5678".
+func MaskPhone(phone string) string {
+	if rest, ok := strings.CutPrefix(phone, "+"); ok {
+		return "+" + maskHead(rest, 4)
+	}
+	return maskHead(phone, 4)
+}
+
+// Mask hides target, a delivery address on channel.
+func Mask(channel, target string) string {
+	switch {
+	case channel == "email" || strings.Contains(target, "@"):
+		return MaskEmail(target)
+	case channel == "sms" || channel == "whatsapp" || channel == "voice":
+		return MaskPhone(target)
+	default:
+		return maskTail(target, 1)
+	}
+}
+
+// maskTail replaces all but the first keep characters of s with '*'.
+func maskTail(s string, keep int) string {
+	runes := []rune(s)
+	if len(runes) <= keep {
+		keep = 0
+	}
+	for i := keep; i < len(runes); i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// maskHead replaces all but the last keep characters of s with '*'.
+func maskHead(s string, keep int) string {
+	runes := []rune(s)
+	if len(runes) <= keep {
+		keep = 0
+	}
+	for i := 0; i < len(runes)-keep; i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// Masked returns a copy of d with every target masked.
+func (d OTPDelivery) Masked() OTPDelivery {
+	if d == nil {
+		return nil
+	}
+	masked := make(OTPDelivery, len(d))
+	for channel, target := range d {
+		masked[channel] = Mask(channel, target)
+	}
+	return masked
+}
+
+// LogValue logs d with its targets masked.
+func (d OTPDelivery) LogValue() slog.Value {
+	return slog.AnyValue(map[string]string(d.Masked()))
+}
+
+// Masked returns a copy of d with the email address masked.
+func (d DeliveryDetails) Masked() DeliveryDetails {
+	d = d.clone()
+	if d.Email != "" {
+		d.Email = MaskEmail(d.Email)
+	}
+	return d
+}
+
+// LogValue logs d with the email address masked.
+func (d DeliveryDetails) LogValue() slog.Value {
+	type plain DeliveryDetails
+	return slog.AnyValue(plain(d.Masked()))
+}
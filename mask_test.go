@@ -0,0 +1,44 @@
+package fastotp
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		channel, target, want string
+	}{
+		{"email", "alice@example.com", "a****@example.com"},
+		{"email", "a@example.com", "*@example.com"},
+		{"email", "not-an-email", "************"},
+		{"sms", "+2348012345678", "+*********5678"},
+		{"sms", "08012345678", "*******5678"},
+		{"sms", "123", "***"},
+		{"push", "device-token", "d***********"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Mask(tt.channel, tt.target), tt.target)
+	}
+}
+
+func TestMasked_Logs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	delivery := OTPDelivery{"email": "alice@example.com", "sms": "+2348012345678"}
+	details := DeliveryDetails{Email: "alice@example.com"}
+	logger.Info("sent", "delivery", delivery, "details", details)
+
+	assert.NotContains(t, buf.String(), "alice")
+	assert.NotContains(t, buf.String(), "012345")
+	assert.Contains(t, buf.String(), `"email":"a****@example.com"`)
+	assert.Contains(t, buf.String(), `"sms":"+*********5678"`)
+
+	// the originals are left alone
+	assert.Equal(t, "alice@example.com", delivery["email"])
+	assert.Equal(t, "alice@example.com", details.Email)
+}
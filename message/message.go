@@ -0,0 +1,444 @@
+// Package message writes the messages that deliver codes, from templates
+// chosen by purpose, locale and channel.
+//
+// Templates are kept in a Catalog. Each message has a plain text body, a
+// subject for channels that use one, and for email an optional HTML body.
+// Text and subjects are text/template templates; HTML bodies are
+// html/template templates, so values are escaped. Templates see a Data.
+//
+// A Catalog starts with English default templates and can load more with
+// LoadFS from files named
+//
+//	<purpose>.<channel>.<locale>.<part>.tmpl
+//
+// where part is "subject", "txt" or "html", and purpose and channel may be
+// "default" to apply to any purpose or channel, for example
+// "login.sms.pt-BR.txt.tmpl" or "default.email.fr.html.tmpl".
+package message
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/sender"
+)
+
+// Default is the purpose and channel name of templates that apply to any
+// purpose or channel.
+const Default = "default"
+
+const defaultLocale = "en"
+
+var (
+	// ErrNoTemplate is returned when no template matches a message.
+	ErrNoTemplate = errors.New("no message template")
+	// ErrTooLong is returned when an SMS needs more segments than allowed.
+	ErrTooLong = errors.New("message too long")
+)
+
+//go:embed templates/*.tmpl
+var defaults embed.FS
+
+// Template is the source of the templates of one message.
+type Template struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Data is what templates are executed with.
+type Data struct {
+	Token      string
+	Identifier string
+	Purpose    string
+	Locale     string
+	Channel    string
+
+	ExpiresAt        time.Time
+	ExpiresIn        time.Duration
+	ExpiresInMinutes int
+
+	// Vars holds application values, such as a product name.
+	Vars map[string]interface{}
+}
+
+// Message is a rendered message.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	// Encoding and Segments describe Text as an SMS.
+	Encoding Encoding
+	Segments int
+}
+
+type key struct {
+	purpose, channel, locale string
+}
+
+type compiled struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+// Catalog holds message templates. It is safe for concurrent use.
+type Catalog struct {
+	mu        sync.RWMutex
+	templates map[key]*compiled
+	fallbacks map[string][]string
+
+	defaultLocale string
+	smsChannels   map[string]bool
+	maxSegments   int
+	vars          map[string]interface{}
+}
+
+// Option configures a Catalog.
+type Option func(*Catalog)
+
+// WithDefaultLocale sets the locale every fallback chain ends with.
+// Defaults to "en", the locale of the built-in templates.
+func WithDefaultLocale(locale string) Option {
+	return func(c *Catalog) {
+		c.defaultLocale = normalizeLocale(locale)
+	}
+}
+
+// WithFallback makes locale fall back to fallbacks, in order, before its
+// parent locales and the default locale.
+func WithFallback(locale string, fallbacks ...string) Option {
+	return func(c *Catalog) {
+		normalized := make([]string, len(fallbacks))
+		for i, f := range fallbacks {
+			normalized[i] = normalizeLocale(f)
+		}
+		c.fallbacks[normalizeLocale(locale)] = normalized
+	}
+}
+
+// WithSMSChannels names the channels whose messages are sent as SMS, which
+// are measured in segments and limited by WithMaxSegments. Defaults to "sms".
+func WithSMSChannels(channels ...string) Option {
+	return func(c *Catalog) {
+		c.smsChannels = make(map[string]bool, len(channels))
+		for _, ch := range channels {
+			c.smsChannels[ch] = true
+		}
+	}
+}
+
+// WithMaxSegments makes Render fail with ErrTooLong when an SMS would need
+// more than n segments. Defaults to no limit.
+func WithMaxSegments(n int) Option {
+	return func(c *Catalog) {
+		c.maxSegments = n
+	}
+}
+
+// WithVars sets the Vars every message is rendered with.
+func WithVars(vars map[string]interface{}) Option {
+	return func(c *Catalog) {
+		c.vars = vars
+	}
+}
+
+// NewCatalog creates a new Catalog holding the built-in templates.
+func NewCatalog(opts ...Option) *Catalog {
+	c := &Catalog{
+		templates:     make(map[key]*compiled),
+		fallbacks:     make(map[string][]string),
+		defaultLocale: defaultLocale,
+		smsChannels:   map[string]bool{"sms": true},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.LoadFS(defaults, "templates"); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Add compiles t and stores it for purpose, channel and locale, replacing the
+// parts of any template stored for them before. Empty parts are left alone.
+func (c *Catalog) Add(purpose, channel, locale string, t Template) error {
+	k := key{purpose: purpose, channel: channel, locale: normalizeLocale(locale)}
+	name := fmt.Sprintf("%s.%s.%s", k.purpose, k.channel, k.locale)
+
+	next := &compiled{}
+	var err error
+	if t.Subject != "" {
+		if next.subject, err = template.New(name + ".subject").Option("missingkey=error").Parse(t.Subject); err != nil {
+			return err
+		}
+	}
+	if t.Text != "" {
+		if next.text, err = template.New(name + ".txt").Option("missingkey=error").Parse(t.Text); err != nil {
+			return err
+		}
+	}
+	if t.HTML != "" {
+		if next.html, err = htmltemplate.New(name + ".html").Option("missingkey=error").Parse(t.HTML); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.templates[k]; ok {
+		if next.subject == nil {
+			next.subject = old.subject
+		}
+		if next.text == nil {
+			next.text = old.text
+		}
+		if next.html == nil {
+			next.html = old.html
+		}
+	}
+	c.templates[k] = next
+	return nil
+}
+
+// LoadFS adds the templates in dir of fsys. Files not named after the
+// pattern in the package documentation are ignored.
+func (c *Catalog) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		parts := strings.Split(entry.Name(), ".")
+		if entry.IsDir() || len(parts) != 5 || parts[4] != "tmpl" {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		var t Template
+		switch parts[3] {
+		case "subject":
+			t.Subject = strings.TrimSpace(string(b))
+		case "txt":
+			t.Text = string(b)
+		case "html":
+			t.HTML = string(b)
+		default:
+			continue
+		}
+		if err := c.Add(parts[0], parts[1], parts[2], t); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Locales returns the locales tried for locale, in order: locale, its
+// configured fallbacks, its parents such as "pt" for "pt-BR", and the
+// default locale.
+func (c *Catalog) Locales(locale string) []string {
+	var chain []string
+	seen := map[string]bool{}
+	add := func(l string) {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var walk func(l string)
+	walk = func(l string) {
+		if seen[l] {
+			return
+		}
+		add(l)
+		for _, f := range c.fallbacks[l] {
+			walk(f)
+		}
+		if i := strings.LastIndex(l, "-"); i > 0 {
+			walk(l[:i])
+		}
+	}
+	walk(normalizeLocale(locale))
+	add(c.defaultLocale)
+	return chain
+}
+
+// lookup finds the templates for a message. The body decides where the
+// HTML comes from, so the two always match; the subject is looked up on its
+// own. Locales are tried first, so a generic message in the reader's
+// language wins over a specific one in another.
+func (c *Catalog) lookup(purpose, channel, locale string) (*compiled, string, error) {
+	locales := c.Locales(locale)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	find := func(has func(*compiled) bool) (*compiled, string) {
+		for _, l := range locales {
+			for _, p := range []string{purpose, Default} {
+				for _, ch := range []string{channel, Default} {
+					if t, ok := c.templates[key{purpose: p, channel: ch, locale: l}]; ok && has(t) {
+						return t, l
+					}
+				}
+			}
+		}
+		return nil, ""
+	}
+
+	body, found := find(func(t *compiled) bool { return t.text != nil })
+	if body == nil {
+		return nil, "", fmt.Errorf("%w: %s message for %s in %s", ErrNoTemplate, channel, purpose, locale)
+	}
+	result := &compiled{text: body.text, html: body.html, subject: body.subject}
+	if result.subject == nil {
+		if subject, _ := find(func(t *compiled) bool { return t.subject != nil }); subject != nil {
+			result.subject = subject.subject
+		}
+	}
+	return result, found, nil
+}
+
+// Render writes the message for purpose on channel in locale. data.Purpose,
+// data.Channel and data.Locale are set from the arguments, data.Vars
+// defaults to the Catalog's vars, and ExpiresIn and ExpiresInMinutes are
+// derived from ExpiresAt when unset.
+func (c *Catalog) Render(purpose, channel, locale string, data Data) (*Message, error) {
+	t, found, err := c.lookup(purpose, channel, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Purpose = purpose
+	data.Channel = channel
+	data.Locale = found
+	if data.Vars == nil {
+		data.Vars = c.vars
+	}
+	if data.ExpiresIn == 0 && !data.ExpiresAt.IsZero() {
+		data.ExpiresIn = time.Until(data.ExpiresAt).Round(time.Second)
+	}
+	if data.ExpiresInMinutes == 0 && data.ExpiresIn > 0 {
+		data.ExpiresInMinutes = int((data.ExpiresIn + time.Minute - 1) / time.Minute)
+	}
+
+	msg := &Message{}
+	var buf bytes.Buffer
+	if err := t.text.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	msg.Text = buf.String()
+
+	if t.subject != nil {
+		buf.Reset()
+		if err := t.subject.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.Subject = buf.String()
+	}
+	if t.html != nil {
+		buf.Reset()
+		if err := t.html.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = buf.String()
+	}
+
+	msg.Encoding, msg.Segments = Segments(msg.Text)
+	if c.smsChannels[channel] && c.maxSegments > 0 && msg.Segments > c.maxSegments {
+		return nil, fmt.Errorf("%w: %s message for %s in %s needs %d segments, at most %d allowed",
+			ErrTooLong, channel, purpose, found, msg.Segments, c.maxSegments)
+	}
+	return msg, nil
+}
+
+type contextKey int
+
+const (
+	purposeKey contextKey = iota
+	localeKey
+)
+
+// WithPurpose returns a copy of ctx carrying the purpose messages are
+// written for.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, purposeKey, purpose)
+}
+
+// WithLocale returns a copy of ctx carrying the locale messages are written
+// in, for example from the request's Accept-Language.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+func fromContext(ctx context.Context) (purpose, locale string) {
+	purpose, _ = ctx.Value(purposeKey).(string)
+	locale, _ = ctx.Value(localeKey).(string)
+	if purpose == "" {
+		purpose = Default
+	}
+	return purpose, locale
+}
+
+// Composer returns a sender.Composer writing messages from the catalog, with
+// the purpose and locale carried by the context.
+func (c *Catalog) Composer() sender.Composer {
+	return func(ctx context.Context, channel, to string, otp *fastotp.OTP, token string) (sender.Message, error) {
+		purpose, locale := fromContext(ctx)
+		msg, err := c.Render(purpose, channel, locale, Data{
+			Token:      token,
+			Identifier: otp.Identifier,
+			ExpiresAt:  otp.ExpiresAt,
+			ExpiresIn:  otp.ExpiresAt.Sub(otp.CreatedAt),
+		})
+		if err != nil {
+			return sender.Message{}, err
+		}
+		return sender.Message{
+			Channel: channel,
+			To:      to,
+			Subject: msg.Subject,
+			Text:    msg.Text,
+			HTML:    msg.HTML,
+			OTP:     otp,
+			Token:   token,
+		}, nil
+	}
+}
+
+// normalizeLocale turns "pt_br" into "pt-BR".
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
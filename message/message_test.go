@@ -0,0 +1,113 @@
+package message
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog_Defaults(t *testing.T) {
+	c := NewCatalog()
+
+	msg, err := c.Render("login", "email", "de-DE", Data{Token: "123456", ExpiresIn: 5 * time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "Your verification code", msg.Subject)
+	assert.Contains(t, msg.Text, "Your verification code is 123456.")
+	assert.Contains(t, msg.Text, "expires in 5 minutes")
+	assert.Contains(t, msg.HTML, "<strong>123456</strong>")
+
+	msg, err = c.Render("login", "sms", "en", Data{Token: "123456", ExpiresIn: 90 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, "Your verification code is 123456. It expires in 2 min.", msg.Text)
+	assert.Empty(t, msg.HTML)
+	assert.Equal(t, GSM7, msg.Encoding)
+	assert.Equal(t, 1, msg.Segments)
+
+	msg, err = c.Render("login", "whatsapp", "en", Data{Token: "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "Your verification code is 123456.", msg.Text)
+}
+
+func TestCatalog_LocaleFallback(t *testing.T) {
+	c := NewCatalog(WithFallback("pt-BR", "pt-PT"))
+	require.NoError(t, c.LoadFS(fstest.MapFS{
+		"t/default.sms.pt.txt.tmpl":    {Data: []byte("Seu código: {{.Token}}")},
+		"t/default.sms.pt-PT.txt.tmpl": {Data: []byte("O seu código: {{.Token}}")},
+		"t/login.sms.en.txt.tmpl":      {Data: []byte("Login code: {{.Token}}")},
+		"t/README.md":                  {Data: []byte("ignored")},
+	}, "t"))
+
+	assert.Equal(t, []string{"pt-BR", "pt-PT", "pt", "en"}, c.Locales("pt_br"))
+
+	msg, err := c.Render("login", "sms", "pt-BR", Data{Token: "1234"})
+	require.NoError(t, err)
+	assert.Equal(t, "O seu código: 1234", msg.Text)
+
+	// a generic message in the reader's language beats a specific one in English
+	msg, err = c.Render("login", "sms", "pt-AO", Data{Token: "1234"})
+	require.NoError(t, err)
+	assert.Equal(t, "Seu código: 1234", msg.Text)
+
+	msg, err = c.Render("login", "sms", "fr", Data{Token: "1234"})
+	require.NoError(t, err)
+	assert.Equal(t, "Login code: 1234", msg.Text)
+}
+
+func TestCatalog_PurposeTemplates(t *testing.T) {
+	c := NewCatalog(WithVars(map[string]interface{}{"Product": "Acme"}))
+	require.NoError(t, c.Add("reset", "email", "en", Template{
+		Subject: "Reset your {{.Vars.Product}} password",
+		Text:    "Use {{.Token}} to reset the password of {{.Identifier}}.",
+		HTML:    "<p>Use <b>{{.Token}}</b> to reset the password of {{.Identifier}}.</p>",
+	}))
+
+	msg, err := c.Render("reset", "email", "en-GB", Data{Token: "ABC123", Identifier: "<script>"})
+	require.NoError(t, err)
+	assert.Equal(t, "Reset your Acme password", msg.Subject)
+	assert.Equal(t, "Use ABC123 to reset the password of <script>.", msg.Text)
+	assert.Equal(t, "<p>Use <b>ABC123</b> to reset the password of &lt;script&gt;.</p>", msg.HTML)
+
+	// the HTML of the default email does not leak into a purpose without one
+	require.NoError(t, c.Add("invite", "email", "en", Template{Text: "Join with {{.Token}}"}))
+	msg, err = c.Render("invite", "email", "en", Data{Token: "1"})
+	require.NoError(t, err)
+	assert.Empty(t, msg.HTML)
+	assert.Equal(t, "Your verification code", msg.Subject)
+}
+
+func TestCatalog_Errors(t *testing.T) {
+	c := NewCatalog(WithDefaultLocale("fr"), WithMaxSegments(1))
+	_, err := c.Render("login", "sms", "fr", Data{Token: "1"})
+	assert.ErrorIs(t, err, ErrNoTemplate)
+
+	require.NoError(t, c.Add(Default, "sms", "fr", Template{Text: "Votre code : {{.Token}} ✓ {{.Vars.Missing}}"}))
+	_, err = c.Render("login", "sms", "fr", Data{Token: "1", Vars: map[string]interface{}{}})
+	assert.Error(t, err)
+
+	require.NoError(t, c.Add(Default, "sms", "fr", Template{Text: "Votre code : {{.Token}} ✓ merci de ne le communiquer à personne, même pas à notre service client."}))
+	_, err = c.Render("login", "sms", "fr", Data{Token: "1"})
+	assert.ErrorIs(t, err, ErrTooLong)
+
+	assert.Error(t, c.Add(Default, "sms", "fr", Template{Text: "{{.Token"}))
+}
+
+func TestCatalog_Composer(t *testing.T) {
+	c := NewCatalog()
+	require.NoError(t, c.Add("login", "sms", "es", Template{Text: "Tu código es {{.Token}} ({{.ExpiresInMinutes}} min)"}))
+
+	ctx := WithLocale(WithPurpose(context.Background(), "login"), "es-MX")
+	now := time.Now()
+	otp := &fastotp.OTP{Identifier: "user", CreatedAt: now, ExpiresAt: now.Add(10 * time.Minute)}
+
+	msg, err := c.Composer()(ctx, "sms", "+52", otp, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, "+52", msg.To)
+	assert.Equal(t, "Tu código es 123456 (10 min)", msg.Text)
+	assert.Equal(t, "123456", msg.Token)
+}
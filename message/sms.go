@@ -0,0 +1,53 @@
+package message
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character encoding an SMS is sent with.
+type Encoding string
+
+const (
+	// GSM7 is the GSM 03.38 7-bit alphabet: 160 characters in a single
+	// segment, 153 per segment when split.
+	GSM7 Encoding = "GSM-7"
+	// UCS2 is used for text outside the GSM alphabet: 70 UTF-16 code units
+	// in a single segment, 67 per segment when split.
+	UCS2 Encoding = "UCS-2"
+)
+
+// gsmBasic is the GSM 03.38 basic character set.
+const gsmBasic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsmExtended characters take two septets, an escape and the character.
+const gsmExtended = "^{}\\[~]|€\f"
+
+// Segments reports the encoding text is sent with as an SMS and how many
+// segments it takes.
+func Segments(text string) (Encoding, int) {
+	septets := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsmBasic, r):
+			septets++
+		case strings.ContainsRune(gsmExtended, r):
+			septets += 2
+		default:
+			return UCS2, count(len(utf16.Encode([]rune(text))), 70, 67)
+		}
+	}
+	return GSM7, count(septets, 160, 153)
+}
+
+func count(units, single, multi int) int {
+	switch {
+	case units == 0:
+		return 0
+	case units <= single:
+		return 1
+	default:
+		return (units + multi - 1) / multi
+	}
+}
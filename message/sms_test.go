@@ -0,0 +1,37 @@
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		text     string
+		encoding Encoding
+		segments int
+	}{
+		{"", GSM7, 0},
+		{"Your code is 123456.", GSM7, 1},
+		{strings.Repeat("a", 160), GSM7, 1},
+		{strings.Repeat("a", 161), GSM7, 2},
+		{strings.Repeat("a", 306), GSM7, 2},
+		{strings.Repeat("a", 307), GSM7, 3},
+		{strings.Repeat("€", 80), GSM7, 1},
+		{strings.Repeat("€", 81), GSM7, 2},
+		{"Votre clé est 123456.", GSM7, 1},
+		{"Seu código é 123456.", UCS2, 1},
+		{"Votre code est 123456 ✓", UCS2, 1},
+		{strings.Repeat("ж", 70), UCS2, 1},
+		{strings.Repeat("ж", 71), UCS2, 2},
+		{strings.Repeat("😀", 35), UCS2, 1},
+		{strings.Repeat("😀", 36), UCS2, 2},
+	}
+	for _, tt := range tests {
+		encoding, segments := Segments(tt.text)
+		assert.Equal(t, tt.encoding, encoding, tt.text)
+		assert.Equal(t, tt.segments, segments, tt.text)
+	}
+}
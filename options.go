@@ -0,0 +1,53 @@
+package fastotp
+
+import (
+	httpclient "github.com/CeoFred/fast-otp/lib"
+)
+
+// Option configures a FastOTP instance.
+type Option func(*FastOTP)
+
+// WithHTTPClient makes FastOTP send its requests through client instead of the
+// default lib.APIClient.
+func WithHTTPClient(client HttpClient) Option {
+	return func(f *FastOTP) {
+		f.client = client
+	}
+}
+
+// WithBaseURL overrides the FastOTP API base URL.
+func WithBaseURL(url string) Option {
+	return func(f *FastOTP) {
+		f.baseURL = url
+	}
+}
+
+// WithAPIClientOptions passes opts to the default lib.APIClient. It has no
+// effect when combined with WithHTTPClient.
+func WithAPIClientOptions(opts ...httpclient.Option) Option {
+	return func(f *FastOTP) {
+		f.clientOpts = append(f.clientOpts, opts...)
+	}
+}
+
+// WithCircuitBreaker guards each FastOTP API endpoint with a circuit breaker,
+// so requests fail fast with ErrCircuitOpen while the API is degraded.
+func WithCircuitBreaker(settings httpclient.BreakerSettings) Option {
+	return WithAPIClientOptions(httpclient.WithCircuitBreaker(settings))
+}
+
+// WithCredentials makes the default lib.APIClient ask provider for the API
+// key on every request, so keys can be rotated without a restart. The key
+// given to NewFastOTP is then ignored.
+func WithCredentials(provider httpclient.CredentialsProvider) Option {
+	return WithAPIClientOptions(httpclient.WithCredentials(provider))
+}
+
+// WithPayloadValidator runs v on every payload before an OTP is generated,
+// including by GenerateForPurpose. Validators run in the order given, and
+// the first error stops the request.
+func WithPayloadValidator(v PayloadValidator) Option {
+	return func(f *FastOTP) {
+		f.validators = append(f.validators, v)
+	}
+}
@@ -0,0 +1,278 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/ttlmap"
+)
+
+var (
+	// ErrUnknownPolicy is returned when no policy is registered for a purpose.
+	ErrUnknownPolicy = errors.New("unknown policy")
+	// ErrNoDeliveryChannel is returned when none of the requested delivery
+	// channels is allowed by the policy.
+	ErrNoDeliveryChannel = errors.New("no delivery channel allowed by policy")
+	// ErrResendCooldown is returned when an OTP is requested again before the
+	// policy's cooldown has elapsed.
+	ErrResendCooldown = errors.New("resend cooldown has not elapsed")
+	// ErrMaxResends is returned when an OTP has been resent as often as the
+	// policy allows.
+	ErrMaxResends = errors.New("maximum number of resends reached")
+	// ErrMaxAttempts is returned when an OTP has been checked as often as the
+	// policy allows.
+	ErrMaxAttempts = errors.New("maximum number of validation attempts reached")
+	// ErrPurposeMismatch is returned when a validated OTP was issued for a
+	// different purpose.
+	ErrPurposeMismatch = errors.New("otp was issued for a different purpose")
+)
+
+// Policy describes how OTPs for one purpose, such as login or password reset,
+// are generated and checked.
+type Policy struct {
+	Type        OTPType
+	TokenLength int
+	// Validity is how long the OTP is valid, in seconds.
+	Validity int
+	// Channels lists the delivery channels the purpose may use. Empty allows
+	// every channel.
+	Channels []string
+	// MaxResends is how often a pending OTP may be sent again. Zero means
+	// no limit.
+	MaxResends int
+	// MaxAttempts is how often an OTP may be checked. Zero means no limit.
+	MaxAttempts int
+	// Cooldown is the minimum time between two sends of the same OTP.
+	Cooldown time.Duration
+}
+
+func (p Policy) allows(channel string) bool {
+	if len(p.Channels) == 0 {
+		return true
+	}
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPolicy registers policy for purpose. See FastOTP.RegisterPolicy.
+func WithPolicy(purpose string, policy Policy) Option {
+	return func(f *FastOTP) {
+		f.RegisterPolicy(purpose, policy)
+	}
+}
+
+// RegisterPolicy registers policy for purpose, replacing any existing one.
+func (f *FastOTP) RegisterPolicy(purpose string, policy Policy) {
+	f.policiesMu.Lock()
+	defer f.policiesMu.Unlock()
+
+	if f.policies == nil {
+		f.policies = make(map[string]Policy)
+	}
+	f.policies[purpose] = policy
+}
+
+// Policy returns the policy registered for purpose.
+func (f *FastOTP) Policy(purpose string) (Policy, bool) {
+	f.policiesMu.RLock()
+	defer f.policiesMu.RUnlock()
+
+	policy, ok := f.policies[purpose]
+	return policy, ok
+}
+
+// purposeIdentifier scopes identifier to purpose, so that an OTP issued for
+// one purpose cannot be validated for another.
+func purposeIdentifier(purpose, identifier string) string {
+	return purpose + ":" + identifier
+}
+
+// GenerateForPurpose generates an OTP for identifier following the policy
+// registered for purpose. Delivery channels the policy does not allow are
+// dropped, and sending again is subject to the policy's cooldown and resend
+// limit.
+func (f *FastOTP) GenerateForPurpose(ctx context.Context, purpose, identifier string, delivery OTPDelivery) (*OTP, error) {
+	policy, ok := f.Policy(purpose)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPolicy, purpose)
+	}
+
+	allowed := make(OTPDelivery, len(delivery))
+	for channel, target := range delivery {
+		if policy.allows(channel) {
+			allowed[channel] = target
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, ErrNoDeliveryChannel
+	}
+
+	scoped := purposeIdentifier(purpose, identifier)
+	resend, release, err := f.tracker.beforeSend(scoped, policy)
+	operation := AuditGenerate
+	if resend {
+		operation = AuditResend
+	}
+	if err != nil {
+		f.audit(ctx, operation, purpose, identifier, "", err)
+		return nil, err
+	}
+
+	otp, err := f.generateOTP(ctx, GenerateOTPPayload{
+		Delivery:    allowed,
+		Identifier:  scoped,
+		Type:        policy.Type,
+		TokenLength: policy.TokenLength,
+		Validity:    policy.Validity,
+	})
+	f.audit(ctx, operation, purpose, identifier, otpID(otp), err)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	otp.Identifier = identifier
+	return otp, nil
+}
+
+// ValidateForPurpose validates token for identifier, and checks that the OTP
+// was issued by GenerateForPurpose for the same purpose.
+func (f *FastOTP) ValidateForPurpose(ctx context.Context, purpose, identifier, token string) (*OTP, error) {
+	policy, ok := f.Policy(purpose)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPolicy, purpose)
+	}
+
+	scoped := purposeIdentifier(purpose, identifier)
+	if err := f.tracker.attempt(scoped, policy); err != nil {
+		f.audit(ctx, AuditValidate, purpose, identifier, "", err)
+		return nil, err
+	}
+
+	otp, err := f.validateOTP(ctx, ValidateOTPPayload{
+		Identifier: scoped,
+		Token:      token,
+	})
+	if err == nil && otp.Identifier != scoped {
+		err = ErrPurposeMismatch
+	}
+	f.audit(ctx, AuditValidate, purpose, identifier, otpID(otp), err)
+	if err != nil {
+		return nil, err
+	}
+
+	if otp.Status == OTPStatusValidated {
+		f.tracker.forget(scoped)
+	}
+	otp.Identifier = identifier
+	return otp, nil
+}
+
+// policyTracker keeps the per OTP counters needed to enforce policies.
+type policyTracker struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries ttlmap.Map[string, *trackedOTP]
+}
+
+type trackedOTP struct {
+	sends     int
+	attempts  int
+	lastSent  time.Time
+	expiresAt time.Time
+}
+
+func (t *policyTracker) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// lookup returns the live entry for identifier.
+func (t *policyTracker) lookup(identifier string, now time.Time) *trackedOTP {
+	entry, _ := t.entries.Get(identifier, now)
+	return entry
+}
+
+// beforeSend checks whether identifier may be sent an OTP and, if so,
+// records the send straight away so that concurrent sends see it. It reports
+// whether this is a resend of a pending OTP, and returns a function undoing
+// the record for a send that failed.
+func (t *policyTracker) beforeSend(identifier string, policy Policy) (bool, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock()
+	entry := t.lookup(identifier, now)
+	resend := entry != nil
+	if resend {
+		if wait := entry.lastSent.Add(policy.Cooldown).Sub(now); wait > 0 {
+			return true, nil, fmt.Errorf("%w: retry in %s", ErrResendCooldown, wait.Round(time.Second))
+		}
+		if policy.MaxResends > 0 && entry.sends > policy.MaxResends {
+			return true, nil, ErrMaxResends
+		}
+	} else {
+		entry = &trackedOTP{}
+	}
+
+	prev := *entry
+	entry.sends++
+	entry.lastSent = now
+	entry.expiresAt = now.Add(time.Duration(policy.Validity) * time.Second)
+	t.entries.Set(identifier, entry, entry.expiresAt, now)
+	return resend, func() { t.unsend(identifier, entry, prev, now) }, nil
+}
+
+// unsend undoes a send recorded by beforeSend at sentAt, leaving alone an
+// entry that has been forgotten or replaced since.
+func (t *policyTracker) unsend(identifier string, entry *trackedOTP, prev trackedOTP, sentAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock()
+	if t.lookup(identifier, now) != entry {
+		return
+	}
+	entry.sends--
+	if entry.sends <= 0 {
+		t.entries.Delete(identifier)
+		return
+	}
+	// a later send keeps its own timestamps
+	if prev.sends > 0 && entry.lastSent.Equal(sentAt) {
+		entry.lastSent = prev.lastSent
+		entry.expiresAt = prev.expiresAt
+		t.entries.Set(identifier, entry, entry.expiresAt, now)
+	}
+}
+
+func (t *policyTracker) attempt(identifier string, policy Policy) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.lookup(identifier, t.clock())
+	if entry == nil {
+		return nil
+	}
+	if policy.MaxAttempts > 0 && entry.attempts >= policy.MaxAttempts {
+		return ErrMaxAttempts
+	}
+	entry.attempts++
+	return nil
+}
+
+func (t *policyTracker) forget(identifier string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries.Delete(identifier)
+}
@@ -0,0 +1,184 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func TestGenerateForPurpose(t *testing.T) {
+	var generated []GenerateOTPPayload
+	now := time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPolicy("login", Policy{
+			Type:        OTPTypeNumeric,
+			TokenLength: 6,
+			Validity:    300,
+			Channels:    []string{"email"},
+			MaxResends:  1,
+			Cooldown:    30 * time.Second,
+		}),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				p := payload.(GenerateOTPPayload)
+				generated = append(generated, p)
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier}})
+			},
+		}),
+	)
+	fastOtp.tracker.now = func() time.Time { return now }
+
+	delivery := OTPDelivery{"email": "test@example.com", "sms": "+2348000000000"}
+	otp, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+	assert.Equal(t, "user123", otp.Identifier)
+	require.Len(t, generated, 1)
+	assert.Equal(t, GenerateOTPPayload{
+		Delivery:    OTPDelivery{"email": "test@example.com"},
+		Identifier:  "login:user123",
+		Type:        OTPTypeNumeric,
+		TokenLength: 6,
+		Validity:    300,
+	}, generated[0])
+
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	assert.ErrorIs(t, err, ErrResendCooldown)
+
+	now = now.Add(30 * time.Second)
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Second)
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	assert.ErrorIs(t, err, ErrMaxResends)
+
+	// limits reset once the OTP has expired
+	now = now.Add(5 * time.Minute)
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", OTPDelivery{"sms": "+2348000000000"})
+	assert.ErrorIs(t, err, ErrNoDeliveryChannel)
+
+	_, err = fastOtp.GenerateForPurpose(context.TODO(), "payment", "user123", delivery)
+	assert.ErrorIs(t, err, ErrUnknownPolicy)
+}
+
+func TestGenerateForPurpose_ConcurrentSends(t *testing.T) {
+	var calls int32
+	fail := true
+	release := make(chan struct{})
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPolicy("login", Policy{Validity: 300, Cooldown: time.Minute}),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				if fail {
+					return httpmock.NewJsonResponse(http.StatusInternalServerError, ErrorResponse{Message: "Server Error"})
+				}
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1"}})
+			},
+		}),
+	)
+	delivery := OTPDelivery{"email": "test@example.com"}
+
+	// only one of several concurrent sends reaches the API
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+			errs <- err
+		}()
+	}
+	var cooldowns int
+	for i := 0; i < 4; i++ {
+		if errors.Is(<-errs, ErrResendCooldown) {
+			cooldowns++
+		}
+	}
+	assert.Equal(t, 4, cooldowns)
+	close(release)
+	assert.Error(t, <-errs)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the failed send does not count against the cooldown
+	fail = false
+	otp, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", delivery)
+	require.NoError(t, err)
+	assert.Equal(t, "otp-1", otp.ID)
+}
+
+func TestValidateForPurpose(t *testing.T) {
+	var validated []ValidateOTPPayload
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPolicy("login", Policy{Validity: 300, MaxAttempts: 2}),
+		WithPolicy("password_reset", Policy{Validity: 300}),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				if endpoint == "/generate" {
+					p := payload.(GenerateOTPPayload)
+					return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier}})
+				}
+				p := payload.(ValidateOTPPayload)
+				validated = append(validated, p)
+				if p.Token != "123456" {
+					return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "invalid token"})
+				}
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					Identifier: "login:user123",
+					Status:     OTPStatusValidated,
+				}})
+			},
+		}),
+	)
+
+	_, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", OTPDelivery{"email": "test@example.com"})
+	require.NoError(t, err)
+
+	_, err = fastOtp.ValidateForPurpose(context.TODO(), "login", "user123", "000000")
+	require.Error(t, err)
+	otp, err := fastOtp.ValidateForPurpose(context.TODO(), "login", "user123", "123456")
+	require.NoError(t, err)
+	assert.Equal(t, "user123", otp.Identifier)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+	assert.Equal(t, "login:user123", validated[1].Identifier)
+
+	// the API answering for another purpose's OTP is rejected
+	_, err = fastOtp.ValidateForPurpose(context.TODO(), "password_reset", "user123", "123456")
+	assert.ErrorIs(t, err, ErrPurposeMismatch)
+}
+
+func TestValidateForPurpose_MaxAttempts(t *testing.T) {
+	calls := 0
+	fastOtp := NewFastOTP(mockAPIKey,
+		WithPolicy("login", Policy{Validity: 300, MaxAttempts: 2}),
+		WithHTTPClient(mockedHTTPClient{
+			PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+				calls++
+				if endpoint == "/generate" {
+					return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{})
+				}
+				return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "invalid token"})
+			},
+		}),
+	)
+
+	_, err := fastOtp.GenerateForPurpose(context.TODO(), "login", "user123", OTPDelivery{"email": "test@example.com"})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = fastOtp.ValidateForPurpose(context.TODO(), "login", "user123", "000000")
+		assert.ErrorContains(t, err, "invalid token")
+	}
+	_, err = fastOtp.ValidateForPurpose(context.TODO(), "login", "user123", "123456")
+	assert.ErrorIs(t, err, ErrMaxAttempts)
+	assert.Equal(t, 3, calls)
+}
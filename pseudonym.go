@@ -0,0 +1,140 @@
+package fastotp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/ttlmap"
+)
+
+// ErrNoPseudonymKey is returned by NewPseudonymizer without keys.
+var ErrNoPseudonymKey = errors.New("no pseudonym key")
+
+// PseudonymKey is a secret identifiers are pseudonymised with. ID names the
+// key in the pseudonyms it makes, so keep it short and never reuse it for
+// another secret.
+type PseudonymKey struct {
+	ID     string
+	Secret []byte
+}
+
+// Pseudonymizer replaces identifiers with keyed hashes, so that raw emails
+// and user IDs never reach the API. Pseudonyms look like "<key id>.<hash>".
+type Pseudonymizer struct {
+	current  PseudonymKey
+	previous []PseudonymKey
+
+	mu    sync.Mutex
+	known ttlmap.Map[string, string]
+}
+
+// NewPseudonymizer creates a new Pseudonymizer making pseudonyms with
+// current. OTPs generated under the previous keys, during a rotation, can
+// still be validated.
+func NewPseudonymizer(current PseudonymKey, previous ...PseudonymKey) (*Pseudonymizer, error) {
+	for _, key := range append([]PseudonymKey{current}, previous...) {
+		if key.ID == "" || len(key.Secret) == 0 || strings.Contains(key.ID, ".") {
+			return nil, ErrNoPseudonymKey
+		}
+	}
+	return &Pseudonymizer{current: current, previous: previous}, nil
+}
+
+// Pseudonym returns the pseudonym of identifier under the current key.
+func (p *Pseudonymizer) Pseudonym(identifier string) string {
+	return pseudonym(p.current, identifier)
+}
+
+// pseudonyms returns the pseudonyms of identifier under every key, the
+// current one first.
+func (p *Pseudonymizer) pseudonyms(identifier string) []string {
+	out := []string{pseudonym(p.current, identifier)}
+	for _, key := range p.previous {
+		out = append(out, pseudonym(key, identifier))
+	}
+	return out
+}
+
+func pseudonym(key PseudonymKey, identifier string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(identifier))
+	return key.ID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// remember records that pseudonym stands for identifier until expiresAt, so
+// GetOtp can map it back.
+func (p *Pseudonymizer) remember(pseudonym, identifier string, expiresAt time.Time) {
+	now := time.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(time.Hour)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.known.Set(pseudonym, identifier, expiresAt, now)
+}
+
+// Identifier returns the identifier pseudonym stands for, if it was seen by
+// this Pseudonymizer and its OTP has not expired.
+func (p *Pseudonymizer) Identifier(pseudonym string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.known.Get(pseudonym, time.Now())
+}
+
+// Erase forgets the pseudonyms of identifier.
+func (p *Pseudonymizer) Erase(_ context.Context, identifier string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pseudonym := range p.pseudonyms(identifier) {
+		p.known.Delete(pseudonym)
+	}
+	return nil
+}
+
+// WithPseudonymizer sends identifiers to the API as pseudonyms made by p.
+// Returned OTPs carry the caller's identifier again: GenerateOTP and
+// ValidateOTP know it, and GetOtp looks it up among the pseudonyms p has
+// seen, falling back to the pseudonym.
+//
+// During a key rotation, a code rejected under the current key is tried
+// again under each previous key, which the API may count as further
+// attempts.
+func WithPseudonymizer(p *Pseudonymizer) Option {
+	return func(f *FastOTP) {
+		f.pseudonymizer = p
+	}
+}
+
+// unpseudonymize puts identifier back on otp, and remembers the pseudonym
+// it was sent as.
+func (f *FastOTP) unpseudonymize(otp *OTP, identifier string) {
+	if f.pseudonymizer == nil || otp == nil {
+		return
+	}
+	f.pseudonymizer.remember(otp.Identifier, identifier, otp.ExpiresAt)
+	otp.Identifier = identifier
+}
+
+// isRejected reports whether err is the API turning down a code or an
+// identifier it does not know, as opposed to refusing the request itself.
+func isRejected(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
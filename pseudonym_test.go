@@ -0,0 +1,93 @@
+package fastotp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+// pseudonymAPI issues OTPs and only validates them for the identifier they
+// were generated for, recording every identifier it is sent.
+type pseudonymAPI struct {
+	issued map[string]string
+	seen   []string
+}
+
+func (a *pseudonymAPI) client() mockedHTTPClient {
+	return mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			switch p := payload.(type) {
+			case GenerateOTPPayload:
+				a.seen = append(a.seen, p.Identifier)
+				a.issued["otp-1"] = p.Identifier
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Identifier: p.Identifier, Status: OTPStatusPending}})
+			case ValidateOTPPayload:
+				a.seen = append(a.seen, p.Identifier)
+				if a.issued["otp-1"] != p.Identifier {
+					return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "Invalid or expired token."})
+				}
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: "otp-1", Identifier: p.Identifier, Status: OTPStatusValidated}})
+			}
+			return nil, nil
+		},
+		GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{ID: id, Identifier: a.issued[id]}})
+		},
+	}
+}
+
+func TestPseudonymizer(t *testing.T) {
+	ctx := context.Background()
+	api := &pseudonymAPI{issued: map[string]string{}}
+	oldKey := PseudonymKey{ID: "k1", Secret: []byte("old-secret")}
+	newKey := PseudonymKey{ID: "k2", Secret: []byte("new-secret")}
+
+	old, err := NewPseudonymizer(oldKey)
+	require.NoError(t, err)
+	fastOtp := NewFastOTP(mockAPIKey, WithPseudonymizer(old), WithHTTPClient(api.client()))
+
+	otp, err := fastOtp.GenerateOTP(ctx, GenerateOTPPayload{Identifier: "user@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", otp.Identifier)
+	require.Len(t, api.seen, 1)
+	assert.True(t, strings.HasPrefix(api.seen[0], "k1."))
+	assert.NotContains(t, api.seen[0], "user")
+	assert.Equal(t, old.Pseudonym("user@example.com"), api.seen[0])
+
+	otp, err = fastOtp.GetOtp(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", otp.Identifier)
+
+	// after a rotation, the code issued under the old key still validates
+	rotated, err := NewPseudonymizer(newKey, oldKey)
+	require.NoError(t, err)
+	fastOtp = NewFastOTP(mockAPIKey, WithPseudonymizer(rotated), WithHTTPClient(api.client()))
+
+	otp, err = fastOtp.ValidateOTP(ctx, ValidateOTPPayload{Identifier: "user@example.com", Token: "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", otp.Identifier)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+	require.Len(t, api.seen, 3)
+	assert.True(t, strings.HasPrefix(api.seen[1], "k2."))
+	assert.Equal(t, api.seen[0], api.seen[2])
+
+	// an unknown pseudonym is returned as is
+	api.issued["otp-2"] = "k9.unknown"
+	otp, err = fastOtp.GetOtp(ctx, "otp-2")
+	require.NoError(t, err)
+	assert.Equal(t, "k9.unknown", otp.Identifier)
+}
+
+func TestPseudonymizer_RejectsBadKeys(t *testing.T) {
+	_, err := NewPseudonymizer(PseudonymKey{ID: "k1"})
+	assert.ErrorIs(t, err, ErrNoPseudonymKey)
+	_, err = NewPseudonymizer(PseudonymKey{ID: "k.1", Secret: []byte("secret")})
+	assert.ErrorIs(t, err, ErrNoPseudonymKey)
+	_, err = NewPseudonymizer(PseudonymKey{ID: "k1", Secret: []byte("secret")}, PseudonymKey{Secret: []byte("secret")})
+	assert.ErrorIs(t, err, ErrNoPseudonymKey)
+}
@@ -0,0 +1,224 @@
+// Package recovery issues backup codes that let users sign in when they
+// have lost access to their other factors.
+//
+// A Manager generates a set of human-friendly codes per user, shown to the
+// user once and kept only as salted hashes in a Store. Each code is
+// accepted once; generating a new set replaces the old one.
+package recovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CeoFred/fast-otp/internal/randutil"
+)
+
+var (
+	// ErrInvalidCode is returned by Verify for a code that is not in the
+	// user's set.
+	ErrInvalidCode = errors.New("invalid recovery code")
+	// ErrUsed is returned by Verify for a code that was already used.
+	ErrUsed = errors.New("recovery code already used")
+)
+
+const (
+	// Alphabet leaves out characters that are easily confused, such as 0
+	// and o, or 1, i and l.
+	Alphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+	defaultCount  = 10
+	defaultLength = 10
+	minLength     = 8
+	groupSize     = 5
+	saltSize      = 16
+)
+
+// Manager generates and verifies recovery codes.
+type Manager struct {
+	store  Store
+	count  int
+	length int
+	pepper []byte
+	now    func() time.Time
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithCount sets how many codes a set holds, at least one. Defaults to 10.
+func WithCount(n int) Option {
+	return func(m *Manager) {
+		m.count = n
+	}
+}
+
+// WithLength sets how many characters of Alphabet a code has, not counting
+// the dashes between groups of five. Defaults to 10, about 50 bits; codes
+// shorter than 8 characters, about 40 bits, are refused.
+func WithLength(n int) Option {
+	return func(m *Manager) {
+		m.length = n
+	}
+}
+
+// WithPepper keys the code hashes with key. Someone holding a copy of the
+// store could otherwise test guessed codes offline, at hashing speed rather
+// than through Verify; without key they cannot check a guess at all.
+// Rotating key leaves every user with codes that no longer verify, so it
+// has to be followed by a new Generate for each of them.
+func WithPepper(key []byte) Option {
+	return func(m *Manager) {
+		m.pepper = key
+	}
+}
+
+// New creates a new Manager keeping hashes in store. It fails if the options
+// ask for no codes or for codes too short to resist guessing.
+func New(store Store, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store:  store,
+		count:  defaultCount,
+		length: defaultLength,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.count < 1 {
+		return nil, fmt.Errorf("invalid recovery code count %d: at least 1 is needed", m.count)
+	}
+	if m.length < minLength {
+		return nil, fmt.Errorf("invalid recovery code length %d: at least %d is needed", m.length, minLength)
+	}
+	return m, nil
+}
+
+// Generate creates a new set of codes for user, replacing any earlier set,
+// and returns the codes formatted for display, such as "7kq2m-x9hfd". They
+// cannot be retrieved again.
+func (m *Manager) Generate(ctx context.Context, user string) ([]string, error) {
+	now := m.now()
+	codes := make([]string, m.count)
+	hashes := make([]Hash, m.count)
+	for i := range codes {
+		code, err := randutil.String(Alphabet, m.length)
+		if err != nil {
+			return nil, err
+		}
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		// IDs are random, so that a code verified while its set is being
+		// replaced cannot mark a code of the new set as used
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		codes[i] = format(code)
+		hashes[i] = Hash{
+			ID:        hex.EncodeToString(id),
+			Salt:      salt,
+			Sum:       m.hash(salt, code),
+			CreatedAt: now,
+		}
+	}
+
+	if err := m.store.Replace(ctx, user, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts code if it is an unused code of user, and marks it used.
+// Case, spaces and dashes are ignored. It fails with ErrUsed for a code
+// that was used before, and ErrInvalidCode otherwise.
+//
+// Verify does not limit attempts; guard it like a password check, for
+// example with an httpotp.Lockout.
+func (m *Manager) Verify(ctx context.Context, user, code string) error {
+	hashes, err := m.store.List(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	// compare with every hash, so the time taken does not tell which
+	// codes came close
+	code = normalize(code)
+	var match *Hash
+	for i := range hashes {
+		if hmac.Equal(hashes[i].Sum, m.hash(hashes[i].Salt, code)) && match == nil {
+			match = &hashes[i]
+		}
+	}
+	if match == nil {
+		return ErrInvalidCode
+	}
+	if !match.UsedAt.IsZero() {
+		return ErrUsed
+	}
+	return m.store.MarkUsed(ctx, user, match.ID, m.now())
+}
+
+// Remaining returns how many unused codes user has left.
+func (m *Manager) Remaining(ctx context.Context, user string) (int, error) {
+	hashes, err := m.store.List(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, h := range hashes {
+		if h.UsedAt.IsZero() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Erase removes the codes of user. It implements fastotp.Eraser.
+func (m *Manager) Erase(ctx context.Context, user string) error {
+	return m.store.Delete(ctx, user)
+}
+
+func (m *Manager) hash(salt []byte, code string) []byte {
+	mac := hmac.New(sha256.New, m.pepper)
+	mac.Write(salt)
+	mac.Write([]byte(code))
+	return mac.Sum(nil)
+}
+
+// format splits code into dash separated groups of five.
+func format(code string) string {
+	var b strings.Builder
+	for i := 0; i < len(code); i += groupSize {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		end := i + groupSize
+		if end > len(code) {
+			end = len(code)
+		}
+		b.WriteString(code[i:end])
+	}
+	return b.String()
+}
+
+// normalize undoes format, and the changes users make when typing a code.
+func normalize(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return r
+	}, code)
+}
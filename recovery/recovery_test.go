@@ -0,0 +1,125 @@
+package recovery
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ fastotp.Eraser = (*Manager)(nil)
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	m, err := New(s, WithPepper([]byte("pepper")))
+	require.NoError(t, err)
+
+	codes, err := m.Generate(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+	format := regexp.MustCompile(`^[` + Alphabet + `]{5}-[` + Alphabet + `]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Regexp(t, format, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	// only hashes are stored
+	hashes, err := s.List(ctx, "user-1")
+	require.NoError(t, err)
+	for _, h := range hashes {
+		assert.Len(t, h.Sum, 32)
+		assert.Len(t, h.Salt, saltSize)
+		assert.True(t, h.UsedAt.IsZero())
+	}
+
+	remaining, err := m.Remaining(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, remaining)
+
+	// typed sloppily, the code still works, but only once
+	require.NoError(t, m.Verify(ctx, "user-1", " "+strings.ToUpper(strings.ReplaceAll(codes[3], "-", " "))))
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", codes[3]), ErrUsed)
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", "aaaaa-aaaaa"), ErrInvalidCode)
+	assert.ErrorIs(t, m.Verify(ctx, "user-2", codes[0]), ErrInvalidCode)
+
+	remaining, err = m.Remaining(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 9, remaining)
+
+	// a new set replaces the old one
+	fresh, err := m.Generate(ctx, "user-1")
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.Verify(ctx, "user-1", codes[0]), ErrInvalidCode)
+	assert.NoError(t, m.Verify(ctx, "user-1", fresh[0]))
+
+	require.NoError(t, m.Erase(ctx, "user-1"))
+	remaining, err = m.Remaining(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestManager_Options(t *testing.T) {
+	m, err := New(NewMemoryStore(), WithCount(3), WithLength(12))
+	require.NoError(t, err)
+	codes, err := m.Generate(context.Background(), "user-1")
+	require.NoError(t, err)
+	require.Len(t, codes, 3)
+	assert.Regexp(t, `^\w{5}-\w{5}-\w{2}$`, codes[0])
+
+	// a different pepper does not accept the codes
+	other, err := New(m.store, WithPepper([]byte("other")))
+	require.NoError(t, err)
+	assert.ErrorIs(t, other.Verify(context.Background(), "user-1", codes[0]), ErrInvalidCode)
+}
+
+func TestNew_RejectsWeakOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"no codes":       WithCount(0),
+		"negative count": WithCount(-1),
+		"short codes":    WithLength(7),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(NewMemoryStore(), opt)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := New(NewMemoryStore(), WithCount(1), WithLength(8))
+	assert.NoError(t, err)
+}
+
+func TestManager_VerifyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(NewMemoryStore())
+	require.NoError(t, err)
+	codes, err := m.Generate(ctx, "user-1")
+	require.NoError(t, err)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.Verify(ctx, "user-1", codes[0]) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, accepted)
+}
@@ -0,0 +1,90 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Hash is a recovery code as kept by a Store.
+type Hash struct {
+	// ID identifies the code within its set.
+	ID string
+	// Salt and Sum are the inputs and output of the code's HMAC.
+	Salt []byte
+	Sum  []byte
+	// CreatedAt is when the set was generated.
+	CreatedAt time.Time
+	// UsedAt is when the code was used, or the zero time while it is
+	// unused.
+	UsedAt time.Time
+}
+
+// Store keeps the recovery code hashes of users. Implementations are safe
+// for concurrent use.
+type Store interface {
+	// Replace stores codes as the set of user, dropping any previous set.
+	Replace(ctx context.Context, user string, codes []Hash) error
+	// List returns the set of user, which is empty if there is none.
+	List(ctx context.Context, user string) ([]Hash, error)
+	// MarkUsed records that the code with id was used at t. It fails with
+	// ErrUsed if the code was already used, and ErrInvalidCode if the set
+	// holds no such code, so that each code is accepted only once.
+	MarkUsed(ctx context.Context, user, id string, t time.Time) error
+	// Delete removes the set of user.
+	Delete(ctx context.Context, user string) error
+}
+
+// MemoryStore is a Store keeping hashes in memory.
+type MemoryStore struct {
+	mu   sync.Mutex
+	sets map[string][]Hash
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sets: make(map[string][]Hash)}
+}
+
+// Replace implements Store.
+func (m *MemoryStore) Replace(_ context.Context, user string, codes []Hash) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sets[user] = append([]Hash(nil), codes...)
+	return nil
+}
+
+// List implements Store.
+func (m *MemoryStore) List(_ context.Context, user string) ([]Hash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Hash(nil), m.sets[user]...), nil
+}
+
+// MarkUsed implements Store.
+func (m *MemoryStore) MarkUsed(_ context.Context, user, id string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set := m.sets[user]
+	for i := range set {
+		if set[i].ID != id {
+			continue
+		}
+		if !set[i].UsedAt.IsZero() {
+			return fmt.Errorf("%w: %s", ErrUsed, id)
+		}
+		set[i].UsedAt = t
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidCode, id)
+}
+
+// Delete implements Store.
+func (m *MemoryStore) Delete(_ context.Context, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sets, user)
+	return nil
+}
@@ -0,0 +1,180 @@
+package fastotp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoTenant is returned when the context passed to a Registry carries
+	// no tenant ID.
+	ErrNoTenant = errors.New("no tenant in context")
+	// ErrUnknownTenant is returned when a Registry has no client for a tenant.
+	ErrUnknownTenant = errors.New("unknown tenant")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenantID.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID carried by ctx, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// Registry holds one FastOTP client per tenant, each with its own API key and
+// defaults. Tenants can be added and removed while the registry is in use.
+type Registry struct {
+	opts []Option
+
+	mu      sync.RWMutex
+	clients map[string]*FastOTP
+}
+
+// NewRegistry creates a new, empty Registry. opts are applied to every
+// tenant's client before the tenant's own options. Unless they say otherwise
+// all clients send requests through the shared httpclient.FastOTPClient, and
+// so share its connection pool. A Cache set with WithCache can be shared
+// too: each tenant's entries are kept under keys of its own.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		opts:    opts,
+		clients: make(map[string]*FastOTP),
+	}
+}
+
+// Add creates the client for tenantID, replacing any existing one.
+func (r *Registry) Add(tenantID, apiKey string, opts ...Option) *FastOTP {
+	all := make([]Option, 0, len(r.opts)+len(opts))
+	all = append(all, r.opts...)
+	all = append(all, opts...)
+	client := NewFastOTP(apiKey, all...)
+	if client.cache != nil {
+		client.cache = tenantCache{cache: client.cache, prefix: strconv.Itoa(len(tenantID)) + ":" + tenantID + ":"}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[tenantID] = client
+	return client
+}
+
+// Remove removes the client for tenantID and reports whether there was one.
+// Requests already using the client are not affected.
+func (r *Registry) Remove(tenantID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.clients[tenantID]
+	delete(r.clients, tenantID)
+	return ok
+}
+
+// Get returns the client for tenantID.
+func (r *Registry) Get(tenantID string) (*FastOTP, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	client, ok := r.clients[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, tenantID)
+	}
+	return client, nil
+}
+
+// Tenants returns the IDs of all registered tenants, sorted.
+func (r *Registry) Tenants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]string, 0, len(r.clients))
+	for tenantID := range r.clients {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// FromContext returns the client for the tenant carried by ctx.
+func (r *Registry) FromContext(ctx context.Context) (*FastOTP, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return r.Get(tenantID)
+}
+
+// GenerateOTP generates an OTP with the client of the tenant carried by ctx.
+func (r *Registry) GenerateOTP(ctx context.Context, payload GenerateOTPPayload) (*OTP, error) {
+	client, err := r.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.GenerateOTP(ctx, payload)
+}
+
+// ValidateOTP validates an OTP with the client of the tenant carried by ctx.
+func (r *Registry) ValidateOTP(ctx context.Context, payload ValidateOTPPayload) (*OTP, error) {
+	client, err := r.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.ValidateOTP(ctx, payload)
+}
+
+// GetOtp gets an OTP with the client of the tenant carried by ctx.
+func (r *Registry) GetOtp(ctx context.Context, id string) (*OTP, error) {
+	client, err := r.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetOtp(ctx, id)
+}
+
+// CancelOTP cancels an OTP with the client of the tenant carried by ctx.
+func (r *Registry) CancelOTP(ctx context.Context, id string) (*OTP, error) {
+	client, err := r.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.CancelOTP(ctx, id)
+}
+
+// tenantCache keeps a tenant's OTPs in a Cache that may be shared with other
+// tenants, prefixing their IDs so that one tenant cannot read another's.
+// The prefix starts with the length of the tenant ID, so no two tenants'
+// keys can collide.
+type tenantCache struct {
+	cache  Cache
+	prefix string
+}
+
+func (c tenantCache) Get(ctx context.Context, id string) (*OTP, bool) {
+	otp, ok := c.cache.Get(ctx, c.prefix+id)
+	if !ok {
+		return nil, false
+	}
+	otp = otp.clone()
+	otp.ID = strings.TrimPrefix(otp.ID, c.prefix)
+	return otp, true
+}
+
+func (c tenantCache) Set(ctx context.Context, otp *OTP, ttl time.Duration) {
+	keyed := otp.clone()
+	keyed.ID = c.prefix + otp.ID
+	c.cache.Set(ctx, keyed, ttl)
+}
+
+func (c tenantCache) Delete(ctx context.Context, id string) {
+	c.cache.Delete(ctx, c.prefix+id)
+}
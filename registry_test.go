@@ -0,0 +1,107 @@
+package fastotp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+func tenantClient(identifier string) Option {
+	return WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: identifier}})
+		},
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(WithBaseURL("https://otp.example.com"))
+	brandA := registry.Add("brand-a", "key-a", tenantClient("a"))
+	registry.Add("brand-b", "key-b", tenantClient("b"))
+
+	assert.Equal(t, []string{"brand-a", "brand-b"}, registry.Tenants())
+	assert.Equal(t, "https://otp.example.com", brandA.baseURL)
+	assert.Equal(t, "key-a", brandA.apiKey)
+
+	payload := GenerateOTPPayload{Identifier: "user"}
+	otp, err := registry.GenerateOTP(WithTenant(context.TODO(), "brand-b"), payload)
+	require.NoError(t, err)
+	assert.Equal(t, "b", otp.Identifier)
+
+	otp, err = registry.GenerateOTP(WithTenant(context.TODO(), "brand-a"), payload)
+	require.NoError(t, err)
+	assert.Equal(t, "a", otp.Identifier)
+
+	_, err = registry.GenerateOTP(context.TODO(), payload)
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	assert.True(t, registry.Remove("brand-b"))
+	assert.False(t, registry.Remove("brand-b"))
+	_, err = registry.ValidateOTP(WithTenant(context.TODO(), "brand-b"), ValidateOTPPayload{})
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestRegistry_ConcurrentUse(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add("brand-a", "key-a", tenantClient("a"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			registry.Add("brand-b", "key-b", tenantClient("b"))
+			registry.Remove("brand-b")
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := registry.GenerateOTP(WithTenant(context.TODO(), "brand-a"), GenerateOTPPayload{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegistry_SharedCache(t *testing.T) {
+	tenantGets := func(identifier string) Option {
+		return WithHTTPClient(mockedHTTPClient{
+			GetFunc: func(ctx context.Context, id string) (*http.Response, error) {
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{
+					ID:         id,
+					Identifier: identifier,
+					Status:     OTPStatusPending,
+					ExpiresAt:  time.Now().Add(time.Hour),
+				}})
+			},
+		})
+	}
+	cache := NewLRUCache(10)
+	registry := NewRegistry(WithCache(cache, time.Minute))
+	brandA := registry.Add("brand-a", "key-a", tenantGets("a"))
+	registry.Add("brand-b", "key-b", tenantGets("b"))
+
+	ctxA := WithTenant(context.TODO(), "brand-a")
+	ctxB := WithTenant(context.TODO(), "brand-b")
+	for i := 0; i < 2; i++ {
+		otp, err := registry.GetOtp(ctxA, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, "otp-1", otp.ID)
+		assert.Equal(t, "a", otp.Identifier)
+
+		// brand-b does not see brand-a's cached OTP
+		otp, err = registry.GetOtp(ctxB, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, "otp-1", otp.ID)
+		assert.Equal(t, "b", otp.Identifier)
+	}
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, brandA.CacheStats())
+
+	_, ok := cache.Get(context.TODO(), "otp-1")
+	assert.False(t, ok, "entries are kept under tenant keys")
+}
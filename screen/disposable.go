@@ -0,0 +1,179 @@
+package screen
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed disposable.txt
+var disposableTXT string
+
+// Source provides an up to date list of disposable email domains.
+type Source interface {
+	Domains(ctx context.Context) ([]string, error)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(ctx context.Context) ([]string, error)
+
+// Domains calls f(ctx).
+func (f SourceFunc) Domains(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// URLSource fetches domains from url, in the format of ParseDomains. A nil
+// client means http.DefaultClient.
+func URLSource(url string, client *http.Client) Source {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return SourceFunc(func(ctx context.Context) ([]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+		}
+		return ParseDomains(resp.Body)
+	})
+}
+
+// ParseDomains reads one domain per line, skipping blank lines and lines
+// starting with "#".
+func ParseDomains(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// DisposableList is a set of disposable email domains, starting from a
+// list embedded in the package. It is safe for concurrent use.
+type DisposableList struct {
+	onUpdate func(domains int)
+
+	mu       sync.RWMutex
+	embedded map[string]struct{}
+	updated  map[string]struct{}
+}
+
+// ListOption configures a DisposableList.
+type ListOption func(*DisposableList)
+
+// WithUpdateHook calls fn after each successful Update with the number of
+// domains on the list.
+func WithUpdateHook(fn func(domains int)) ListOption {
+	return func(l *DisposableList) {
+		l.onUpdate = fn
+	}
+}
+
+// NewDisposableList creates a new DisposableList holding the embedded
+// domains.
+func NewDisposableList(opts ...ListOption) *DisposableList {
+	embedded, _ := ParseDomains(strings.NewReader(disposableTXT))
+	l := &DisposableList{embedded: domainSet(embedded)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func domainSet(domains []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		set[strings.TrimSuffix(strings.ToLower(domain), ".")] = struct{}{}
+	}
+	return set
+}
+
+// Contains reports whether domain, or a domain it is a subdomain of, is on
+// the list.
+func (l *DisposableList) Contains(domain string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for {
+		if _, ok := l.embedded[domain]; ok {
+			return true
+		}
+		if _, ok := l.updated[domain]; ok {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Len returns the number of domains on the list.
+func (l *DisposableList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	n := len(l.embedded)
+	for domain := range l.updated {
+		if _, ok := l.embedded[domain]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Update fetches domains from src, replacing those of the previous update.
+// The embedded domains are kept. On error the list is left unchanged.
+func (l *DisposableList) Update(ctx context.Context, src Source) error {
+	domains, err := src.Domains(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.updated = domainSet(domains)
+	l.mu.Unlock()
+
+	if l.onUpdate != nil {
+		l.onUpdate(l.Len())
+	}
+	return nil
+}
+
+// Refresh updates l from src straight away and then every interval, until
+// ctx is done. Errors are passed to onError, if not nil.
+func (l *DisposableList) Refresh(ctx context.Context, src Source, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Update(ctx, src); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
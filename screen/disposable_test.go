@@ -0,0 +1,63 @@
+package screen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisposableList_Update(t *testing.T) {
+	var counts []int
+	list := NewDisposableList(WithUpdateHook(func(domains int) {
+		counts = append(counts, domains)
+	}))
+	embedded := list.Len()
+	require.Greater(t, embedded, 50)
+	assert.True(t, list.Contains("mailinator.com"))
+	assert.False(t, list.Contains("throwaway.example"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "# updated list\nthrowaway.example\n\nMailinator.com\n")
+	}))
+	defer server.Close()
+
+	require.NoError(t, list.Update(context.Background(), URLSource(server.URL, nil)))
+	assert.True(t, list.Contains("throwaway.example"))
+	assert.True(t, list.Contains("inbox.throwaway.example"))
+	assert.Equal(t, []int{embedded + 1}, counts)
+
+	// a failed update keeps the list
+	err := list.Update(context.Background(), SourceFunc(func(ctx context.Context) ([]string, error) {
+		return nil, errors.New("feed unavailable")
+	}))
+	assert.Error(t, err)
+	assert.True(t, list.Contains("throwaway.example"))
+
+	// the next update replaces the previous one, but keeps the embedded list
+	require.NoError(t, list.Update(context.Background(), SourceFunc(func(ctx context.Context) ([]string, error) {
+		return []string{"other.example"}, nil
+	})))
+	assert.False(t, list.Contains("throwaway.example"))
+	assert.True(t, list.Contains("mailinator.com"))
+}
+
+func TestParseDomains(t *testing.T) {
+	domains, err := ParseDomains(strings.NewReader("# comment\n a.example \n\nb.example"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.example", "b.example"}, domains)
+}
+
+func TestURLSource_BadStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := URLSource(server.URL, server.Client()).Domains(context.Background())
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,335 @@
+// Package screen decides which delivery targets may receive codes, to keep
+// throwaway email addresses and premium-rate phone numbers from being used
+// to abuse OTP delivery.
+//
+// A Policy checks every target against denylists and allowlists of email
+// domains, country calling codes and regular expressions, and rejects
+// addresses at disposable email providers. It plugs into
+// fastotp.WithPayloadValidator, so it runs before GenerateOTP reaches the
+// API.
+package screen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/validate"
+)
+
+// ErrRejected matches every *RejectionError.
+var ErrRejected = errors.New("delivery target rejected")
+
+// Reason says why a target was rejected.
+type Reason string
+
+const (
+	// ReasonDeniedDomain is given for an email domain on the denylist.
+	ReasonDeniedDomain Reason = "denied_domain"
+	// ReasonDisposableEmail is given for an address at a disposable email
+	// provider.
+	ReasonDisposableEmail Reason = "disposable_email"
+	// ReasonDeniedCallingCode is given for a phone number starting with a
+	// denied calling code or prefix.
+	ReasonDeniedCallingCode Reason = "denied_calling_code"
+	// ReasonDeniedPattern is given for a target matching a denied pattern.
+	ReasonDeniedPattern Reason = "denied_pattern"
+	// ReasonNotAllowed is given for a target missing from an allowlist.
+	ReasonNotAllowed Reason = "not_allowed"
+	// ReasonInvalidTarget is given for a target that cannot be read as an
+	// email address or phone number, when rules depend on it.
+	ReasonInvalidTarget Reason = "invalid_target"
+)
+
+// RejectionError is returned for a target a Policy turns down. It matches
+// ErrRejected with errors.Is, and unwraps to an *fastotp.APIError with
+// status 422 carrying the field error for the channel.
+type RejectionError struct {
+	Channel string
+	Target  string
+	Reason  Reason
+	// Rule is the domain, calling code or pattern that matched, if any.
+	Rule string
+}
+
+// Error implements the error interface.
+func (e *RejectionError) Error() string {
+	if e.Rule != "" {
+		return fmt.Sprintf("%s: %s target %s (%s)", ErrRejected, e.Channel, e.Reason, e.Rule)
+	}
+	return fmt.Sprintf("%s: %s target %s", ErrRejected, e.Channel, e.Reason)
+}
+
+// Is reports whether target is ErrRejected.
+func (e *RejectionError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// Unwrap returns the rejection as a validation error of the payload.
+func (e *RejectionError) Unwrap() error {
+	return &fastotp.APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Message:    "The given data was invalid.",
+		Errors:     map[string][]string{"delivery." + e.Channel: {e.message()}},
+	}
+}
+
+func (e *RejectionError) message() string {
+	switch e.Reason {
+	case ReasonDisposableEmail:
+		return "Disposable email addresses are not accepted."
+	case ReasonInvalidTarget:
+		return "The delivery target is invalid."
+	default:
+		return "The delivery target is not accepted."
+	}
+}
+
+// Policy checks delivery targets. Deny rules are checked first; then, for
+// each kind of allowlist that is set, the target must match it.
+type Policy struct {
+	allowDomains      []string
+	denyDomains       []string
+	allowCallingCodes []string
+	denyCallingCodes  []string
+	allowPatterns     []*regexp.Regexp
+	denyPatterns      []*regexp.Regexp
+	disposable        *DisposableList
+	defaultRegion     string
+	emailChannels     validate.ChannelSet
+	phoneChannels     validate.ChannelSet
+}
+
+// Option configures a Policy.
+type Option func(*Policy)
+
+// AllowDomains only accepts email addresses at domains, or their
+// subdomains.
+func AllowDomains(domains ...string) Option {
+	return func(p *Policy) {
+		p.allowDomains = append(p.allowDomains, normalizeDomains(domains)...)
+	}
+}
+
+// DenyDomains rejects email addresses at domains, or their subdomains.
+func DenyDomains(domains ...string) Option {
+	return func(p *Policy) {
+		p.denyDomains = append(p.denyDomains, normalizeDomains(domains)...)
+	}
+}
+
+// AllowCallingCodes only accepts phone numbers starting with one of codes,
+// such as "234" or "+44".
+func AllowCallingCodes(codes ...string) Option {
+	return func(p *Policy) {
+		p.allowCallingCodes = append(p.allowCallingCodes, normalizeCodes(codes)...)
+	}
+}
+
+// DenyCallingCodes rejects phone numbers starting with one of codes. Codes
+// may be longer than a country calling code, to deny number ranges such as
+// the premium-rate "+1900".
+func DenyCallingCodes(codes ...string) Option {
+	return func(p *Policy) {
+		p.denyCallingCodes = append(p.denyCallingCodes, normalizeCodes(codes)...)
+	}
+}
+
+// AllowPattern only accepts targets, on any channel, matching one of the
+// allowed patterns. Email addresses and phone numbers are matched in their
+// normal form.
+func AllowPattern(re *regexp.Regexp) Option {
+	return func(p *Policy) {
+		p.allowPatterns = append(p.allowPatterns, re)
+	}
+}
+
+// DenyPattern rejects targets, on any channel, matching re.
+func DenyPattern(re *regexp.Regexp) Option {
+	return func(p *Policy) {
+		p.denyPatterns = append(p.denyPatterns, re)
+	}
+}
+
+// WithDisposableList checks email domains against list instead of a list
+// holding the embedded domains. A nil list accepts disposable addresses.
+func WithDisposableList(list *DisposableList) Option {
+	return func(p *Policy) {
+		p.disposable = list
+	}
+}
+
+// WithDefaultRegion reads phone numbers without a country calling code as
+// national numbers of region. See validate.WithDefaultRegion.
+func WithDefaultRegion(region string) Option {
+	return func(p *Policy) {
+		p.defaultRegion = region
+	}
+}
+
+// WithEmailChannels sets the delivery channels whose targets are email
+// addresses. Defaults to "email".
+func WithEmailChannels(channels ...string) Option {
+	return func(p *Policy) {
+		p.emailChannels = validate.NewChannelSet(channels...)
+	}
+}
+
+// WithPhoneChannels sets the delivery channels whose targets are phone
+// numbers. Defaults to "sms", "whatsapp" and "voice".
+func WithPhoneChannels(channels ...string) Option {
+	return func(p *Policy) {
+		p.phoneChannels = validate.NewChannelSet(channels...)
+	}
+}
+
+func normalizeDomains(domains []string) []string {
+	out := make([]string, len(domains))
+	for i, domain := range domains {
+		out[i] = strings.TrimSuffix(strings.ToLower(domain), ".")
+	}
+	return out
+}
+
+func normalizeCodes(codes []string) []string {
+	out := make([]string, len(codes))
+	for i, code := range codes {
+		out[i] = strings.TrimPrefix(strings.Map(func(r rune) rune {
+			if r == ' ' || r == '-' {
+				return -1
+			}
+			return r
+		}, code), "+")
+	}
+	return out
+}
+
+// New creates a new Policy. Unless WithDisposableList says otherwise, it
+// rejects addresses at the embedded disposable email domains.
+func New(opts ...Option) *Policy {
+	p := &Policy{
+		disposable:    NewDisposableList(),
+		emailChannels: validate.DefaultEmailChannels(),
+		phoneChannels: validate.DefaultPhoneChannels(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Check returns a *RejectionError if target may not receive codes on
+// channel.
+func (p *Policy) Check(ctx context.Context, channel, target string) error {
+	reject := func(reason Reason, rule string) error {
+		return &RejectionError{Channel: channel, Target: target, Reason: reason, Rule: rule}
+	}
+
+	normalized := target
+	switch {
+	case p.emailChannels[channel]:
+		address, err := validate.NormalizeEmail(target)
+		if err != nil {
+			return reject(ReasonInvalidTarget, "")
+		}
+		normalized = address
+		if err := p.checkDomain(address[strings.LastIndexByte(address, '@')+1:], reject); err != nil {
+			return err
+		}
+	case p.phoneChannels[channel]:
+		number, err := validate.NormalizePhone(target, p.defaultRegion)
+		if err != nil {
+			if len(p.allowCallingCodes) > 0 || len(p.denyCallingCodes) > 0 {
+				return reject(ReasonInvalidTarget, "")
+			}
+		} else {
+			normalized = number
+			if err := p.checkNumber(number[1:], reject); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, re := range p.denyPatterns {
+		if re.MatchString(normalized) {
+			return reject(ReasonDeniedPattern, re.String())
+		}
+	}
+	if len(p.allowPatterns) > 0 && !matchesAny(p.allowPatterns, normalized) {
+		return reject(ReasonNotAllowed, "")
+	}
+	return nil
+}
+
+func (p *Policy) checkDomain(domain string, reject func(Reason, string) error) error {
+	if rule, ok := matchDomain(p.denyDomains, domain); ok {
+		return reject(ReasonDeniedDomain, rule)
+	}
+	if p.disposable != nil && p.disposable.Contains(domain) {
+		return reject(ReasonDisposableEmail, domain)
+	}
+	if len(p.allowDomains) > 0 {
+		if _, ok := matchDomain(p.allowDomains, domain); !ok {
+			return reject(ReasonNotAllowed, "")
+		}
+	}
+	return nil
+}
+
+func (p *Policy) checkNumber(digits string, reject func(Reason, string) error) error {
+	for _, code := range p.denyCallingCodes {
+		if strings.HasPrefix(digits, code) {
+			return reject(ReasonDeniedCallingCode, "+"+code)
+		}
+	}
+	if len(p.allowCallingCodes) > 0 {
+		for _, code := range p.allowCallingCodes {
+			if strings.HasPrefix(digits, code) {
+				return nil
+			}
+		}
+		return reject(ReasonNotAllowed, "")
+	}
+	return nil
+}
+
+func matchDomain(rules []string, domain string) (string, bool) {
+	for _, rule := range rules {
+		if domain == rule || strings.HasSuffix(domain, "."+rule) {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePayload implements fastotp.PayloadValidator. It checks every
+// target of payload.Delivery, in channel order, and returns the first
+// rejection.
+func (p *Policy) ValidatePayload(ctx context.Context, payload *fastotp.GenerateOTPPayload) error {
+	channels := make([]string, 0, len(payload.Delivery))
+	for channel := range payload.Delivery {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	for _, channel := range channels {
+		if err := p.Check(ctx, channel, payload.Delivery[channel]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package screen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ fastotp.PayloadValidator = (*Policy)(nil)
+
+func TestPolicy_Check(t *testing.T) {
+	ctx := context.Background()
+	p := New(
+		DenyDomains("blocked.example"),
+		DenyCallingCodes("+1900", "+882"),
+		AllowCallingCodes("234", "+1"),
+		DenyPattern(regexp.MustCompile(`^test\+`)),
+		WithDefaultRegion("NG"),
+	)
+
+	tests := []struct {
+		channel, target string
+		reason          Reason
+		rule            string
+	}{
+		{"email", "user@example.com", "", ""},
+		{"email", "user@blocked.example", ReasonDeniedDomain, "blocked.example"},
+		{"email", "user@mail.blocked.example", ReasonDeniedDomain, "blocked.example"},
+		{"email", "user@notblocked.example", "", ""},
+		{"email", "someone@Mailinator.com", ReasonDisposableEmail, "mailinator.com"},
+		{"email", "someone@eu.mailinator.com", ReasonDisposableEmail, "eu.mailinator.com"},
+		{"email", "test+1@example.com", ReasonDeniedPattern, `^test\+`},
+		{"email", "not an address", ReasonInvalidTarget, ""},
+		{"sms", "08012345678", "", ""},
+		{"sms", "+1 900 555 0123", ReasonDeniedCallingCode, "+1900"},
+		{"sms", "+1 212 555 0123", "", ""},
+		{"sms", "+44 20 7946 0958", ReasonNotAllowed, ""},
+		{"sms", "12", ReasonInvalidTarget, ""},
+		{"push", "device-token", "", ""},
+	}
+	for _, tt := range tests {
+		err := p.Check(ctx, tt.channel, tt.target)
+		if tt.reason == "" {
+			assert.NoError(t, err, tt.target)
+			continue
+		}
+		var rejection *RejectionError
+		if assert.True(t, errors.As(err, &rejection), tt.target) {
+			assert.Equal(t, tt.reason, rejection.Reason, tt.target)
+			assert.Equal(t, tt.rule, rejection.Rule, tt.target)
+			assert.Equal(t, tt.channel, rejection.Channel)
+		}
+		assert.ErrorIs(t, err, ErrRejected)
+	}
+}
+
+func TestPolicy_Allowlists(t *testing.T) {
+	ctx := context.Background()
+	p := New(
+		AllowDomains("example.com"),
+		AllowPattern(regexp.MustCompile(`^[a-z]+@`)),
+		WithDisposableList(nil),
+	)
+
+	assert.NoError(t, p.Check(ctx, "email", "alice@example.com"))
+	assert.NoError(t, p.Check(ctx, "email", "alice@staff.example.com"))
+	assert.ErrorIs(t, p.Check(ctx, "email", "alice@example.org"), ErrRejected)
+	assert.ErrorIs(t, p.Check(ctx, "email", "alice2@example.com"), ErrRejected)
+
+	// phone numbers only have to pass the pattern allowlist here
+	assert.ErrorIs(t, p.Check(ctx, "sms", "+2348012345678"), ErrRejected)
+	assert.NoError(t, New(WithDisposableList(nil)).Check(ctx, "email", "someone@mailinator.com"))
+}
+
+func TestPolicy_ValidatePayload(t *testing.T) {
+	p := New(DenyCallingCodes("882"))
+	err := p.ValidatePayload(context.Background(), &fastotp.GenerateOTPPayload{Delivery: fastotp.OTPDelivery{
+		"sms":   "+882 1234 5678",
+		"email": "someone@yopmail.com",
+	}})
+
+	var rejection *RejectionError
+	require.True(t, errors.As(err, &rejection))
+	assert.Equal(t, "email", rejection.Channel)
+	assert.Equal(t, ReasonDisposableEmail, rejection.Reason)
+
+	apiErr, ok := fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, map[string][]string{"delivery.email": {"Disposable email addresses are not accepted."}}, apiErr.Errors)
+
+	assert.NoError(t, p.ValidatePayload(context.Background(), &fastotp.GenerateOTPPayload{Delivery: fastotp.OTPDelivery{"email": "user@example.com"}}))
+}
@@ -0,0 +1,59 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSender is a Sender for development that writes messages to an
+// io.Writer instead of delivering them.
+type WriterSender struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewWriterSender creates a new WriterSender writing to w.
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w, now: time.Now}
+}
+
+// NewConsoleSender creates a new WriterSender writing to standard output.
+func NewConsoleSender() *WriterSender {
+	return NewWriterSender(os.Stdout)
+}
+
+// FileSender is a WriterSender appending to a file.
+type FileSender struct {
+	*WriterSender
+	file *os.File
+}
+
+// OpenFileSender opens the file at path, creating it if needed, and returns
+// a FileSender appending to it.
+func OpenFileSender(path string) (*FileSender, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSender{WriterSender: NewWriterSender(f), file: f}, nil
+}
+
+// Close closes the file.
+func (s *FileSender) Close() error {
+	return s.file.Close()
+}
+
+// Send implements Sender.
+func (s *WriterSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "--- %s %s to %s\nSubject: %s\n\n%s\n\n",
+		s.now().Format(time.RFC3339), msg.Channel, msg.To, msg.Subject, msg.Text)
+	return err
+}
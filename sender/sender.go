@@ -0,0 +1,274 @@
+// Package sender delivers locally generated codes over email, SMS or any
+// other channel.
+//
+// A Sender delivers one Message. A Dispatcher routes each channel of an
+// fastotp.OTPDelivery to the Sender registered for it, retries failed sends
+// and reports the outcome per channel in the OTP's DeliveryDetails. A
+// Dispatcher is a local.Deliverer:
+//
+//	dispatcher := sender.NewDispatcher()
+//	dispatcher.Register("email", sender.NewSMTPSender(smtpConfig))
+//	dispatcher.Register("sms", sender.NewSMSGateway(smsConfig), sender.WithRetry(5, time.Second))
+//	provider := local.New(dispatcher)
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+var (
+	// ErrNoSender is reported for a channel no Sender is registered for.
+	ErrNoSender = errors.New("no sender for channel")
+	// ErrNotDelivered is returned when a code could not be delivered on any
+	// channel.
+	ErrNotDelivered = errors.New("code not delivered")
+)
+
+const (
+	defaultAttempts = 3
+	defaultBackoff  = time.Second
+)
+
+// Message is a code to deliver to one recipient.
+type Message struct {
+	// Channel is the delivery channel, such as "email" or "sms".
+	Channel string
+	// To is the recipient's address on the channel.
+	To string
+	// Subject is used by channels with a subject line, such as email.
+	Subject string
+	// Text is the plain text body.
+	Text string
+	// HTML is an optional HTML body for channels that support it.
+	HTML string
+
+	OTP   *fastotp.OTP
+	Token string
+}
+
+// Sender delivers messages on one channel.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SenderFunc adapts a function to a Sender.
+type SenderFunc func(ctx context.Context, msg Message) error
+
+// Send calls f(ctx, msg).
+func (f SenderFunc) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// permanentError marks an error that retrying will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the Dispatcher does not retry the send, for example
+// because the recipient's address was rejected.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type channel struct {
+	sender   Sender
+	attempts int
+	backoff  time.Duration
+}
+
+// ChannelOption configures a channel of a Dispatcher.
+type ChannelOption func(*channel)
+
+// WithRetry makes the Dispatcher try a send up to attempts times, waiting
+// backoff before the second attempt and twice as long before each further
+// one. Defaults to 3 attempts and a 1s backoff.
+func WithRetry(attempts int, backoff time.Duration) ChannelOption {
+	return func(c *channel) {
+		c.attempts = attempts
+		c.backoff = backoff
+	}
+}
+
+// Composer builds the message delivering token on a channel.
+type Composer func(ctx context.Context, channel, to string, otp *fastotp.OTP, token string) (Message, error)
+
+// Dispatcher delivers codes by handing them to the Sender registered for
+// each channel. It implements local.Deliverer.
+type Dispatcher struct {
+	mu       sync.RWMutex
+	channels map[string]*channel
+
+	compose Composer
+	now     func() time.Time
+}
+
+// DispatcherOption configures a Dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithComposer sets how messages are written. The default is a short plain
+// text message with the code and its expiry.
+func WithComposer(compose Composer) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.compose = compose
+	}
+}
+
+// NewDispatcher creates a new Dispatcher without senders.
+func NewDispatcher(opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		channels: make(map[string]*channel),
+		compose:  defaultComposer,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Register makes the Dispatcher deliver on channel through s, replacing any
+// Sender registered for it before.
+func (d *Dispatcher) Register(name string, s Sender, opts ...ChannelOption) {
+	c := &channel{sender: s, attempts: defaultAttempts, backoff: defaultBackoff}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.attempts < 1 {
+		c.attempts = 1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels[name] = c
+}
+
+func (d *Dispatcher) channel(name string) *channel {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.channels[name]
+}
+
+// Deliver sends token on every channel of delivery, in parallel, and records
+// the outcome of each in otp.DeliveryDetails.Statuses. It fails with
+// ErrNotDelivered only when no channel succeeded.
+func (d *Dispatcher) Deliver(ctx context.Context, otp *fastotp.OTP, token string, delivery fastotp.OTPDelivery) error {
+	channels := make([]string, 0, len(delivery))
+	for name := range delivery {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+
+	statuses := make([]fastotp.DeliveryStatus, len(channels))
+	var wg sync.WaitGroup
+	for i, name := range channels {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			statuses[i] = d.send(ctx, name, delivery[name], otp, token)
+		}(i, name)
+	}
+	wg.Wait()
+
+	if otp.DeliveryDetails.Statuses == nil {
+		otp.DeliveryDetails.Statuses = make(map[string]fastotp.DeliveryStatus, len(channels))
+	}
+	var failures []string
+	for i, name := range channels {
+		otp.DeliveryDetails.Statuses[name] = statuses[i]
+		if statuses[i].State != fastotp.DeliveryStateSent {
+			failures = append(failures, name+": "+statuses[i].Error)
+		}
+	}
+
+	if len(failures) == len(channels) {
+		return fmt.Errorf("%w: %s", ErrNotDelivered, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// send delivers on one channel, retrying as configured.
+func (d *Dispatcher) send(ctx context.Context, name, to string, otp *fastotp.OTP, token string) fastotp.DeliveryStatus {
+	status := fastotp.DeliveryStatus{State: fastotp.DeliveryStateFailed}
+
+	c := d.channel(name)
+	if c == nil {
+		status.Error = fmt.Sprintf("%s: %s", ErrNoSender, name)
+		return status
+	}
+
+	msg, err := d.compose(ctx, name, to, otp, token)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	backoff := c.backoff
+	for status.Attempts < c.attempts {
+		if status.Attempts > 0 {
+			if err := sleep(ctx, backoff); err != nil {
+				break
+			}
+			backoff *= 2
+		}
+
+		status.Attempts++
+		err = c.sender.Send(ctx, msg)
+		if err == nil {
+			status.State = fastotp.DeliveryStateSent
+			status.Error = ""
+			status.DeliveredAt = d.now().UTC()
+			return status
+		}
+		status.Error = err.Error()
+		if IsPermanent(err) {
+			break
+		}
+	}
+	return status
+}
+
+func defaultComposer(_ context.Context, channel, to string, otp *fastotp.OTP, token string) (Message, error) {
+	text := fmt.Sprintf("Your verification code is %s.", token)
+	if !otp.ExpiresAt.IsZero() && !otp.CreatedAt.IsZero() {
+		text += fmt.Sprintf(" It expires in %s.", otp.ExpiresAt.Sub(otp.CreatedAt).Round(time.Second))
+	}
+	return Message{
+		Channel: channel,
+		To:      to,
+		Subject: "Your verification code",
+		Text:    text,
+		OTP:     otp,
+		Token:   token,
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,113 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+	"github.com/CeoFred/fast-otp/local"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ local.Deliverer = (*Dispatcher)(nil)
+
+func TestDispatcher_Retry(t *testing.T) {
+	var calls int32
+	d := NewDispatcher()
+	d.Register("sms", SenderFunc(func(ctx context.Context, msg Message) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("gateway busy")
+		}
+		return nil
+	}), WithRetry(3, time.Millisecond))
+
+	otp := &fastotp.OTP{}
+	require.NoError(t, d.Deliver(context.Background(), otp, "123456", fastotp.OTPDelivery{"sms": "+1"}))
+
+	status := otp.DeliveryDetails.Statuses["sms"]
+	assert.Equal(t, fastotp.DeliveryStateSent, status.State)
+	assert.Equal(t, 3, status.Attempts)
+	assert.Empty(t, status.Error)
+	assert.False(t, status.DeliveredAt.IsZero())
+}
+
+func TestDispatcher_PermanentErrorsAreNotRetried(t *testing.T) {
+	var calls int32
+	d := NewDispatcher()
+	d.Register("email", SenderFunc(func(ctx context.Context, msg Message) error {
+		atomic.AddInt32(&calls, 1)
+		return Permanent(errors.New("mailbox unavailable"))
+	}), WithRetry(5, time.Millisecond))
+
+	otp := &fastotp.OTP{}
+	err := d.Deliver(context.Background(), otp, "123456", fastotp.OTPDelivery{"email": "user@example.com"})
+	assert.ErrorIs(t, err, ErrNotDelivered)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	status := otp.DeliveryDetails.Statuses["email"]
+	assert.Equal(t, fastotp.DeliveryStateFailed, status.State)
+	assert.Equal(t, "mailbox unavailable", status.Error)
+}
+
+func TestDispatcher_PartialDelivery(t *testing.T) {
+	var sent Message
+	d := NewDispatcher()
+	d.Register("email", SenderFunc(func(ctx context.Context, msg Message) error {
+		sent = msg
+		return nil
+	}))
+
+	otp := &fastotp.OTP{CreatedAt: time.Unix(0, 0), ExpiresAt: time.Unix(300, 0)}
+	err := d.Deliver(context.Background(), otp, "123456", fastotp.OTPDelivery{"email": "user@example.com", "sms": "+1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, fastotp.DeliveryStateSent, otp.DeliveryDetails.Statuses["email"].State)
+	assert.Equal(t, fastotp.DeliveryStateFailed, otp.DeliveryDetails.Statuses["sms"].State)
+	assert.Contains(t, otp.DeliveryDetails.Statuses["sms"].Error, ErrNoSender.Error())
+
+	assert.Equal(t, "user@example.com", sent.To)
+	assert.Equal(t, "Your verification code is 123456. It expires in 5m0s.", sent.Text)
+}
+
+func TestDispatcher_RetryStopsWithContext(t *testing.T) {
+	d := NewDispatcher()
+	d.Register("sms", SenderFunc(func(ctx context.Context, msg Message) error {
+		return errors.New("gateway busy")
+	}), WithRetry(10, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	otp := &fastotp.OTP{}
+	assert.ErrorIs(t, d.Deliver(ctx, otp, "123456", fastotp.OTPDelivery{"sms": "+1"}), ErrNotDelivered)
+	assert.Equal(t, 1, otp.DeliveryDetails.Statuses["sms"].Attempts)
+}
+
+func TestDispatcher_WithLocalProvider(t *testing.T) {
+	var out bytes.Buffer
+	d := NewDispatcher()
+	d.Register("email", NewWriterSender(&out))
+	provider := local.New(d)
+
+	otp, err := provider.GenerateOTP(context.Background(), fastotp.GenerateOTPPayload{
+		Delivery:    fastotp.OTPDelivery{"email": "user@example.com"},
+		Identifier:  "user",
+		Type:        fastotp.OTPTypeNumeric,
+		TokenLength: 6,
+		Validity:    60,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.DeliveryStateSent, otp.DeliveryDetails.Statuses["email"].State)
+	assert.Contains(t, out.String(), "email to user@example.com")
+
+	// the statuses are stored with the OTP
+	stored, err := provider.GetOtp(context.Background(), otp.ID)
+	require.NoError(t, err)
+	assert.Equal(t, otp.DeliveryDetails, stored.DeliveryDetails)
+}
@@ -0,0 +1,79 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SMSGatewayConfig configures an SMSGateway.
+type SMSGatewayConfig struct {
+	// URL is the gateway endpoint messages are posted to.
+	URL string
+	// Header is added to every request, for example to authenticate.
+	Header http.Header
+	// Encode builds the request body and its content type. The default
+	// sends {"to": ..., "message": ...} as JSON.
+	Encode func(msg Message) (body []byte, contentType string, err error)
+	// Client sends the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// SMSGateway is a Sender posting messages to an HTTP SMS gateway. Any 2xx
+// answer counts as delivered. 429 and 5xx answers are retried; other
+// answers are permanent failures.
+type SMSGateway struct {
+	config SMSGatewayConfig
+}
+
+// NewSMSGateway creates a new SMSGateway.
+func NewSMSGateway(config SMSGatewayConfig) *SMSGateway {
+	if config.Encode == nil {
+		config.Encode = encodeJSON
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &SMSGateway{config: config}
+}
+
+func encodeJSON(msg Message) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]string{"to": msg.To, "message": msg.Text})
+	return body, "application/json", err
+}
+
+// Send implements Sender.
+func (g *SMSGateway) Send(ctx context.Context, msg Message) error {
+	body, contentType, err := g.config.Encode(msg)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	for key, values := range g.config.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := g.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("sms gateway answered %s: %s", resp.Status, bytes.TrimSpace(detail))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return err
+	}
+	return Permanent(err)
+}
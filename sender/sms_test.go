@@ -0,0 +1,66 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMSGateway(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	gateway := NewSMSGateway(SMSGatewayConfig{
+		URL:    server.URL,
+		Header: http.Header{"Authorization": {"Bearer token"}},
+	})
+	require.NoError(t, gateway.Send(context.Background(), Message{To: "+2348012345678", Text: "Your code is 123456."}))
+	assert.Equal(t, map[string]string{"to": "+2348012345678", "message": "Your code is 123456."}, got)
+}
+
+func TestSMSGateway_Errors(t *testing.T) {
+	for status, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", status)
+		}))
+
+		err := NewSMSGateway(SMSGatewayConfig{URL: server.URL}).Send(context.Background(), Message{To: "+1", Text: "code"})
+		server.Close()
+
+		require.Error(t, err, "status %d", status)
+		assert.Contains(t, err.Error(), "nope")
+		assert.Equal(t, permanent, IsPermanent(err), "status %d", status)
+	}
+}
+
+func TestSMSGateway_CustomEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "+1", r.PostForm.Get("To"))
+		assert.Equal(t, "code", r.PostForm.Get("Body"))
+	}))
+	defer server.Close()
+
+	gateway := NewSMSGateway(SMSGatewayConfig{
+		URL: server.URL,
+		Encode: func(msg Message) ([]byte, string, error) {
+			return []byte("To=%2B1&Body=" + msg.Text), "application/x-www-form-urlencoded", nil
+		},
+	})
+	require.NoError(t, gateway.Send(context.Background(), Message{To: "+1", Text: "code"}))
+}
@@ -0,0 +1,188 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPConfig configures an SMTPSender.
+type SMTPConfig struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// From is the sender address, optionally with a display name.
+	From string
+	// Auth, if set, authenticates with the server. net/smtp only sends
+	// credentials over TLS or to localhost.
+	Auth smtp.Auth
+	// TLSConfig is used for STARTTLS, which is used whenever the server
+	// offers it. Defaults to verifying the server against Addr's host.
+	TLSConfig *tls.Config
+	// Timeout bounds a whole send when the context has no earlier deadline.
+	// Defaults to 30s.
+	Timeout time.Duration
+}
+
+// SMTPSender is a Sender delivering email through an SMTP server.
+type SMTPSender struct {
+	config SMTPConfig
+	now    func() time.Time
+}
+
+// NewSMTPSender creates a new SMTPSender.
+func NewSMTPSender(config SMTPConfig) *SMTPSender {
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &SMTPSender{config: config, now: time.Now}
+}
+
+// Send implements Sender. Addresses the server rejects are reported as
+// permanent errors.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.config.From)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid from address: %w", err))
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid recipient: %w", err))
+	}
+
+	body, err := s.compose(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.config.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		config := s.config.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: host}
+		}
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if s.config.Auth != nil {
+		if err := client.Auth(s.config.Auth); err != nil {
+			return Permanent(err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return classifySMTP(err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return classifySMTP(err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classifySMTP(err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTP(err)
+	}
+	return client.Quit()
+}
+
+// classifySMTP marks 5xx replies, which the server will not change its mind
+// about, as permanent.
+func classifySMTP(err error) error {
+	if tpErr, ok := err.(*textproto.Error); ok && tpErr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
+
+// compose writes the message headers and a plain text body, or a
+// multipart/alternative body when msg has HTML.
+func (s *SMTPSender) compose(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", s.now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(parts.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,204 @@
+package sender
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type smtpMessage struct {
+	from string
+	to   []string
+	auth string
+	data string
+}
+
+// fakeSMTP is an in-process SMTP server accepting just enough of the
+// protocol for net/smtp. Recipients containing "reject" are refused.
+type fakeSMTP struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTP{listener: l}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeSMTP) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-fake")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			msg.auth = arg
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if strings.Contains(to, "reject") {
+				_ = tp.PrintfLine("550 no such user")
+				continue
+			}
+			msg.to = append(msg.to, to)
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = smtpMessage{}
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSender_PlainText(t *testing.T) {
+	server := newFakeSMTP(t)
+	s := NewSMTPSender(SMTPConfig{
+		Addr: server.addr(),
+		From: "Acme <no-reply@acme.test>",
+		Auth: smtp.PlainAuth("", "user", "secret", "127.0.0.1"),
+	})
+
+	err := s.Send(context.Background(), Message{
+		Channel: "email",
+		To:      "user@example.com",
+		Subject: "Your code ✓",
+		Text:    "Your code is 123456.",
+	})
+	require.NoError(t, err)
+
+	received := server.received()
+	require.Len(t, received, 1)
+	assert.Equal(t, "no-reply@acme.test", received[0].from)
+	assert.Equal(t, []string{"user@example.com"}, received[0].to)
+	assert.NotEmpty(t, received[0].auth)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(received[0].data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Your code ✓", subject)
+	body, err := io.ReadAll(parsed.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Your code is 123456.")
+}
+
+func TestSMTPSender_Multipart(t *testing.T) {
+	server := newFakeSMTP(t)
+	s := NewSMTPSender(SMTPConfig{Addr: server.addr(), From: "no-reply@acme.test"})
+
+	err := s.Send(context.Background(), Message{
+		To:   "user@example.com",
+		Text: "Your code is 123456.",
+		HTML: "<p>Your code is <b>123456</b>.</p>",
+	})
+	require.NoError(t, err)
+
+	received := server.received()
+	require.Len(t, received, 1)
+	parsed, err := mail.ReadMessage(strings.NewReader(received[0].data))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, types)
+}
+
+func TestSMTPSender_RejectedRecipientIsPermanent(t *testing.T) {
+	server := newFakeSMTP(t)
+	s := NewSMTPSender(SMTPConfig{Addr: server.addr(), From: "no-reply@acme.test"})
+
+	err := s.Send(context.Background(), Message{To: "reject@example.com", Text: "code"})
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+
+	err = s.Send(context.Background(), Message{To: "not an address", Text: "code"})
+	assert.True(t, IsPermanent(err))
+}
+
+func TestSMTPSender_UnreachableIsRetryable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s := NewSMTPSender(SMTPConfig{Addr: addr, From: "no-reply@acme.test", Timeout: time.Second})
+	err = s.Send(context.Background(), Message{To: "user@example.com", Text: "code"})
+	require.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// CancelStore is a fastotp.CancelStore keeping cancellations as records of
+// an OTPStore, so that every FastOTP instance sharing the store rejects the
+// codes of cancelled OTPs.
+type CancelStore struct {
+	store OTPStore
+}
+
+// NewCancelStore creates a new CancelStore keeping cancellations in s. A
+// record that already exists for the OTP, such as one of a local provider,
+// has its status set to cancelled.
+func NewCancelStore(s OTPStore) *CancelStore {
+	return &CancelStore{store: s}
+}
+
+// Cancel implements fastotp.CancelStore. The record expires at until, so
+// that Sweep removes it.
+func (c *CancelStore) Cancel(ctx context.Context, id string, until time.Time) error {
+	now := time.Now()
+	err := c.store.Put(ctx, &Record{OTP: fastotp.OTP{
+		ID:        id,
+		Status:    fastotp.OTPStatusCancelled,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: until,
+	}})
+	if errors.Is(err, ErrExists) {
+		_, err = c.store.UpdateStatus(ctx, id, fastotp.OTPStatusCancelled)
+	}
+	return err
+}
+
+// Cancelled implements fastotp.CancelStore.
+func (c *CancelStore) Cancelled(ctx context.Context, id string) (bool, error) {
+	record, err := c.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return record.OTP.Status == fastotp.OTPStatusCancelled, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ fastotp.CancelStore = (*CancelStore)(nil)
+
+func TestCancelStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore()
+	c := NewCancelStore(s)
+
+	cancelled, err := c.Cancelled(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+
+	require.NoError(t, c.Cancel(ctx, "otp-1", now.Add(time.Minute)))
+	cancelled, err = c.Cancelled(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	// an existing record is marked as cancelled
+	require.NoError(t, s.Put(ctx, newRecord("otp-2", "user", now)))
+	require.NoError(t, c.Cancel(ctx, "otp-2", now.Add(time.Minute)))
+	record, err := s.Get(ctx, "otp-2")
+	require.NoError(t, err)
+	assert.Equal(t, fastotp.OTPStatusCancelled, record.OTP.Status)
+	assert.Equal(t, "user", record.OTP.Identifier)
+
+	// cancellations are swept once the OTP has expired
+	n, err := s.DeleteExpired(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	cancelled, err = c.Cancelled(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+}
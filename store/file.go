@@ -0,0 +1,305 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// ErrClosed is returned by a FileStore after Close.
+var ErrClosed = errors.New("store is closed")
+
+// logEntry is one line of a FileStore's log.
+type logEntry struct {
+	Op     string  `json:"op"`
+	Record *Record `json:"record,omitempty"`
+	ID     string  `json:"id,omitempty"`
+}
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+)
+
+// FileStore is an OTPStore keeping records in memory and every change in an
+// append-only log file, which is replayed by OpenFileStore. Each change is
+// synced to disk before it is acknowledged. Compact rewrites the log with
+// just the current records.
+type FileStore struct {
+	path string
+
+	mu    sync.Mutex
+	file  *os.File
+	table table
+}
+
+// OpenFileStore opens the log at path, creating it if needed, and loads the
+// records it holds. A last line left incomplete by a crash is discarded.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{path: path, file: file, table: newTable()}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// drop a partial write
+			if len(b) > 0 {
+				if err := s.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(b))
+
+		var e logEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		switch {
+		case e.Op == opSet && e.Record != nil:
+			s.table.set(e.Record)
+		case e.Op == opDelete:
+			s.table.remove(e.ID)
+		default:
+			return fmt.Errorf("%s:%d: unknown entry %q", s.path, line, e.Op)
+		}
+	}
+
+	_, err := s.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// append writes entries to the log and syncs it.
+func (s *FileStore) append(entries ...logEntry) error {
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	var buf []byte
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Put implements OTPStore.
+func (s *FileStore) Put(_ context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.OTP.ID == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidRecord)
+	}
+	if _, err := s.table.get(record.OTP.ID); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, record.OTP.ID)
+	}
+
+	next := record.clone()
+	next.Version = 1
+	if err := s.append(logEntry{Op: opSet, Record: next}); err != nil {
+		return err
+	}
+	s.table.set(next)
+	record.Version = next.Version
+	return nil
+}
+
+// Get implements OTPStore.
+func (s *FileStore) Get(_ context.Context, id string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.table.get(id)
+}
+
+// GetByIdentifier implements OTPStore.
+func (s *FileStore) GetByIdentifier(_ context.Context, identifier string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.table.latest(identifier)
+}
+
+// UpdateStatus implements OTPStore.
+func (s *FileStore) UpdateStatus(_ context.Context, id string, status fastotp.OTPStatus) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.table.get(id)
+	if err != nil {
+		return nil, err
+	}
+	record.OTP.Status = status
+	record.OTP.UpdatedAt = time.Now()
+	record.Version++
+
+	if err := s.append(logEntry{Op: opSet, Record: record}); err != nil {
+		return nil, err
+	}
+	s.table.set(record)
+	return record, nil
+}
+
+// CompareAndSwap implements OTPStore.
+func (s *FileStore) CompareAndSwap(_ context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.table.get(record.OTP.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Version != record.Version {
+		return fmt.Errorf("%w: %s", ErrConflict, record.OTP.ID)
+	}
+
+	next := record.clone()
+	next.Version++
+	if err := s.append(logEntry{Op: opSet, Record: next}); err != nil {
+		return err
+	}
+	s.table.set(next)
+	record.Version = next.Version
+	return nil
+}
+
+// DeleteExpired implements OTPStore.
+func (s *FileStore) DeleteExpired(_ context.Context, t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.table.expired(t)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	entries := make([]logEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = logEntry{Op: opDelete, ID: id}
+	}
+	if err := s.append(entries...); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.table.remove(id)
+	}
+	return len(ids), nil
+}
+
+// Erase removes every record of identifier, and compacts the log so that
+// they do not linger in it.
+func (s *FileStore) Erase(_ context.Context, identifier string) error {
+	s.mu.Lock()
+	ids := s.table.ids(identifier)
+	entries := make([]logEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = logEntry{Op: opDelete, ID: id}
+	}
+	err := s.append(entries...)
+	if err == nil {
+		for _, id := range ids {
+			s.table.remove(id)
+		}
+	}
+	s.mu.Unlock()
+
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return s.Compact()
+}
+
+// Compact rewrites the log so it only holds the current records, replacing
+// the old file atomically.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// keep the insertion order, which breaks ties in GetByIdentifier
+	entries := make([]*entry, 0, len(s.table.byID))
+	for _, e := range s.table.byID {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, e := range entries {
+		if err := encoder.Encode(logEntry{Op: opSet, Record: e.record}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	s.file.Close()
+	s.file = tmp
+	_, err = tmp.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Close closes the log file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
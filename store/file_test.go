@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "otps.log")
+	now := time.Unix(1700000000, 0).UTC()
+
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+	require.NoError(t, s.Put(ctx, newRecord("otp-2", "user", now.Add(time.Hour))))
+	_, err = s.UpdateStatus(ctx, "otp-1", fastotp.OTPStatusValidated)
+	require.NoError(t, err)
+	_, err = s.DeleteExpired(ctx, now.Add(time.Minute*30))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	assert.ErrorIs(t, s.Put(ctx, newRecord("otp-3", "user", now)), ErrClosed)
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Get(ctx, "otp-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	got, err := s.Get(ctx, "otp-2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.Version)
+}
+
+func TestFileStore_DiscardsPartialWrite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "otps.log")
+	now := time.Unix(1700000000, 0).UTC()
+
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+	require.NoError(t, s.Close())
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"set","record":{"OTP":{"id":"otp-2"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, newRecord("otp-2", "user", now)))
+	require.NoError(t, s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = s.Get(ctx, "otp-2")
+	assert.NoError(t, err)
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "otps.log")
+	now := time.Unix(1700000000, 0).UTC()
+
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+	for i := 0; i < 10; i++ {
+		_, err = s.UpdateStatus(ctx, "otp-1", fastotp.OTPStatusPending)
+		require.NoError(t, err)
+	}
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Compact())
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	// writes keep going to the compacted log
+	require.NoError(t, s.Put(ctx, newRecord("otp-2", "user", now)))
+	require.NoError(t, s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	got, err := s.Get(ctx, "otp-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), got.Version)
+	_, err = s.Get(ctx, "otp-2")
+	assert.NoError(t, err)
+}
+
+func TestFileStore_EraseLeavesNoTrace(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "otps.log")
+	now := time.Unix(1700000000, 0).UTC()
+
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Put(ctx, newRecord("otp-1", "erase-me@example.com", now)))
+	require.NoError(t, s.Put(ctx, newRecord("otp-2", "keep-me@example.com", now)))
+	require.NoError(t, s.Erase(ctx, "erase-me@example.com"))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "erase-me")
+	assert.Contains(t, string(b), "keep-me")
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// MemoryStore is an OTPStore keeping records in memory.
+type MemoryStore struct {
+	mu    sync.Mutex
+	table table
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{table: newTable()}
+}
+
+// Put implements OTPStore.
+func (m *MemoryStore) Put(_ context.Context, record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.table.put(record)
+	return err
+}
+
+// Get implements OTPStore.
+func (m *MemoryStore) Get(_ context.Context, id string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.table.get(id)
+}
+
+// GetByIdentifier implements OTPStore.
+func (m *MemoryStore) GetByIdentifier(_ context.Context, identifier string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.table.latest(identifier)
+}
+
+// UpdateStatus implements OTPStore.
+func (m *MemoryStore) UpdateStatus(_ context.Context, id string, status fastotp.OTPStatus) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.table.updateStatus(id, status, time.Now())
+}
+
+// CompareAndSwap implements OTPStore.
+func (m *MemoryStore) CompareAndSwap(_ context.Context, record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.table.swap(record)
+	return err
+}
+
+// DeleteExpired implements OTPStore.
+func (m *MemoryStore) DeleteExpired(_ context.Context, t time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := m.table.expired(t)
+	for _, id := range ids {
+		m.table.remove(id)
+	}
+	return len(ids), nil
+}
+
+// Erase removes every record of identifier.
+func (m *MemoryStore) Erase(_ context.Context, identifier string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range m.table.ids(identifier) {
+		m.table.remove(id)
+	}
+	return nil
+}
+
+// Len returns the number of stored records.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.table.byID)
+}
+
+type entry struct {
+	record *Record
+	seq    uint64
+}
+
+// table indexes records by ID and identifier. It is not safe for concurrent
+// use; MemoryStore and FileStore guard it with their own locks.
+type table struct {
+	byID         map[string]*entry
+	byIdentifier map[string]map[string]struct{}
+	seq          uint64
+}
+
+func newTable() table {
+	return table{
+		byID:         make(map[string]*entry),
+		byIdentifier: make(map[string]map[string]struct{}),
+	}
+}
+
+// set stores a copy of record as is, replacing any record with its ID.
+func (t *table) set(record *Record) {
+	id := record.OTP.ID
+	if old, ok := t.byID[id]; ok && old.record.OTP.Identifier != record.OTP.Identifier {
+		t.unindex(id, old.record.OTP.Identifier)
+	}
+
+	t.seq++
+	t.byID[id] = &entry{record: record.clone(), seq: t.seq}
+
+	ids, ok := t.byIdentifier[record.OTP.Identifier]
+	if !ok {
+		ids = make(map[string]struct{})
+		t.byIdentifier[record.OTP.Identifier] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (t *table) unindex(id, identifier string) {
+	ids := t.byIdentifier[identifier]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(t.byIdentifier, identifier)
+	}
+}
+
+// ids returns the IDs of the records of identifier.
+func (t *table) ids(identifier string) []string {
+	ids := make([]string, 0, len(t.byIdentifier[identifier]))
+	for id := range t.byIdentifier[identifier] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (t *table) remove(id string) {
+	if e, ok := t.byID[id]; ok {
+		t.unindex(id, e.record.OTP.Identifier)
+		delete(t.byID, id)
+	}
+}
+
+func (t *table) put(record *Record) (*Record, error) {
+	if record.OTP.ID == "" {
+		return nil, fmt.Errorf("%w: empty id", ErrInvalidRecord)
+	}
+	if _, ok := t.byID[record.OTP.ID]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrExists, record.OTP.ID)
+	}
+	record.Version = 1
+	t.set(record)
+	return record, nil
+}
+
+func (t *table) get(id string) (*Record, error) {
+	e, ok := t.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return e.record.clone(), nil
+}
+
+func (t *table) latest(identifier string) (*Record, error) {
+	var latest *entry
+	for id := range t.byIdentifier[identifier] {
+		e := t.byID[id]
+		if latest == nil || e.record.OTP.CreatedAt.After(latest.record.OTP.CreatedAt) ||
+			(e.record.OTP.CreatedAt.Equal(latest.record.OTP.CreatedAt) && e.seq > latest.seq) {
+			latest = e
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("%w: identifier %s", ErrNotFound, identifier)
+	}
+	return latest.record.clone(), nil
+}
+
+func (t *table) swap(record *Record) (*Record, error) {
+	e, ok := t.byID[record.OTP.ID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, record.OTP.ID)
+	}
+	if e.record.Version != record.Version {
+		return nil, fmt.Errorf("%w: %s", ErrConflict, record.OTP.ID)
+	}
+	record.Version++
+	t.set(record)
+	return record, nil
+}
+
+func (t *table) updateStatus(id string, status fastotp.OTPStatus, now time.Time) (*Record, error) {
+	record, err := t.get(id)
+	if err != nil {
+		return nil, err
+	}
+	record.OTP.Status = status
+	record.OTP.UpdatedAt = now
+	return t.swap(record)
+}
+
+func (t *table) expired(before time.Time) []string {
+	var ids []string
+	for id, e := range t.byID {
+		if expiresAt := e.record.OTP.ExpiresAt; !expiresAt.IsZero() && expiresAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
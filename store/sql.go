@@ -0,0 +1,349 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// Placeholder is the bind parameter style of a database driver.
+type Placeholder int
+
+const (
+	// Question uses ? placeholders, as SQLite and MySQL do.
+	Question Placeholder = iota
+	// Dollar uses $1, $2, ... placeholders, as PostgreSQL does.
+	Dollar
+)
+
+const defaultTable = "fastotp_otps"
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLOption configures an SQLStore.
+type SQLOption func(*SQLStore)
+
+// WithTable sets the name of the table holding the records, which is also
+// used as the prefix of the migrations table and indexes. Defaults to
+// "fastotp_otps".
+func WithTable(name string) SQLOption {
+	return func(s *SQLStore) {
+		s.table = name
+	}
+}
+
+// WithPlaceholder sets the placeholder style of the driver. Defaults to
+// Question.
+func WithPlaceholder(p Placeholder) SQLOption {
+	return func(s *SQLStore) {
+		s.placeholder = p
+	}
+}
+
+// SQLStore is an OTPStore keeping records in a database/sql database. Call
+// Migrate before using it to create or upgrade its tables.
+//
+// Times are stored as Unix nanoseconds and delivery details as JSON text, so
+// the schema only relies on column types every common database has.
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+// NewSQLStore creates a new SQLStore using db.
+func NewSQLStore(db *sql.DB, opts ...SQLOption) (*SQLStore, error) {
+	s := &SQLStore{db: db, table: defaultTable}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !tableName.MatchString(s.table) {
+		return nil, fmt.Errorf("invalid table name %q", s.table)
+	}
+	return s, nil
+}
+
+// migrations are applied in order. Released migrations must never change;
+// schema changes are made by appending new ones.
+var migrations = [][]string{
+	{
+		`CREATE TABLE {table} (
+			id VARCHAR(255) NOT NULL PRIMARY KEY,
+			identifier VARCHAR(255) NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			type VARCHAR(32) NOT NULL,
+			delivery_methods TEXT NOT NULL,
+			delivery_details TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			version BIGINT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`,
+	},
+	{
+		`CREATE INDEX {table}_identifier ON {table} (identifier, created_at)`,
+		`CREATE INDEX {table}_expires_at ON {table} (expires_at)`,
+	},
+}
+
+// Migrate brings the schema up to date. Each migration runs in its own
+// transaction and is recorded in the "<table>_migrations" table.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.query(
+		`CREATE TABLE IF NOT EXISTS {table}_migrations (version INTEGER NOT NULL PRIMARY KEY, applied_at BIGINT NOT NULL)`))
+	if err != nil {
+		return err
+	}
+
+	for i, statements := range migrations {
+		if err := s.migrate(ctx, i+1, statements); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) migrate(ctx context.Context, version int, statements []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied int
+	err = tx.QueryRowContext(ctx, s.query(`SELECT COUNT(*) FROM {table}_migrations WHERE version = ?`), version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, s.query(statement)); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, s.query(`INSERT INTO {table}_migrations (version, applied_at) VALUES (?, ?)`),
+		version, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// query fills in the table name and rewrites placeholders for the driver.
+func (s *SQLStore) query(q string) string {
+	q = strings.ReplaceAll(q, "{table}", s.table)
+	if s.placeholder != Dollar {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+const columns = `id, identifier, status, type, delivery_methods, delivery_details, secret, attempts, version, created_at, updated_at, expires_at`
+
+// Put implements OTPStore.
+func (s *SQLStore) Put(ctx context.Context, record *Record) error {
+	if record.OTP.ID == "" {
+		return fmt.Errorf("%w: empty id", ErrInvalidRecord)
+	}
+
+	next := *record
+	next.Version = 1
+	args, err := encodeRecord(&next)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.query(`INSERT INTO {table} (`+columns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), args...)
+	if err != nil {
+		// drivers report duplicate keys differently, so look the ID up
+		if _, getErr := s.Get(ctx, record.OTP.ID); getErr == nil {
+			return fmt.Errorf("%w: %s", ErrExists, record.OTP.ID)
+		}
+		return err
+	}
+	record.Version = next.Version
+	return nil
+}
+
+// Get implements OTPStore.
+func (s *SQLStore) Get(ctx context.Context, id string) (*Record, error) {
+	row := s.db.QueryRowContext(ctx, s.query(`SELECT `+columns+` FROM {table} WHERE id = ?`), id)
+	record, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return record, err
+}
+
+// GetByIdentifier implements OTPStore. Records created at the same instant
+// are told apart by their ID.
+func (s *SQLStore) GetByIdentifier(ctx context.Context, identifier string) (*Record, error) {
+	row := s.db.QueryRowContext(ctx, s.query(
+		`SELECT `+columns+` FROM {table} WHERE identifier = ? ORDER BY created_at DESC, id DESC LIMIT 1`), identifier)
+	record, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: identifier %s", ErrNotFound, identifier)
+	}
+	return record, err
+}
+
+// UpdateStatus implements OTPStore.
+func (s *SQLStore) UpdateStatus(ctx context.Context, id string, status fastotp.OTPStatus) (*Record, error) {
+	res, err := s.db.ExecContext(ctx, s.query(
+		`UPDATE {table} SET status = ?, updated_at = ?, version = version + 1 WHERE id = ?`),
+		string(status), time.Now().UnixNano(), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.Get(ctx, id)
+}
+
+// CompareAndSwap implements OTPStore.
+func (s *SQLStore) CompareAndSwap(ctx context.Context, record *Record) error {
+	next := *record
+	next.Version++
+	args, err := encodeRecord(&next)
+	if err != nil {
+		return err
+	}
+
+	// args starts with the id; it goes into the WHERE clause instead
+	args = append(args[1:], record.OTP.ID, record.Version)
+	res, err := s.db.ExecContext(ctx, s.query(`UPDATE {table} SET
+		identifier = ?, status = ?, type = ?, delivery_methods = ?, delivery_details = ?, secret = ?,
+		attempts = ?, version = ?, created_at = ?, updated_at = ?, expires_at = ?
+		WHERE id = ? AND version = ?`), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.Get(ctx, record.OTP.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrConflict, record.OTP.ID)
+	}
+	record.Version = next.Version
+	return nil
+}
+
+// DeleteExpired implements OTPStore.
+func (s *SQLStore) DeleteExpired(ctx context.Context, t time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE expires_at > 0 AND expires_at < ?`), t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Erase removes every record of identifier.
+func (s *SQLStore) Erase(ctx context.Context, identifier string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE identifier = ?`), identifier)
+	return err
+}
+
+func encodeRecord(r *Record) ([]interface{}, error) {
+	methods, err := json.Marshal(r.OTP.DeliveryMethods)
+	if err != nil {
+		return nil, err
+	}
+	details, err := json.Marshal(r.OTP.DeliveryDetails)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		r.OTP.ID,
+		r.OTP.Identifier,
+		string(r.OTP.Status),
+		string(r.OTP.Type),
+		string(methods),
+		string(details),
+		base64.StdEncoding.EncodeToString(r.Secret),
+		r.Attempts,
+		r.Version,
+		unixNano(r.OTP.CreatedAt),
+		unixNano(r.OTP.UpdatedAt),
+		unixNano(r.OTP.ExpiresAt),
+	}, nil
+}
+
+func scanRecord(row *sql.Row) (*Record, error) {
+	var (
+		r                                 Record
+		status, otpType, methods, details string
+		secret                            string
+		createdAt, updatedAt, expiresAt   int64
+	)
+	err := row.Scan(&r.OTP.ID, &r.OTP.Identifier, &status, &otpType, &methods, &details, &secret,
+		&r.Attempts, &r.Version, &createdAt, &updatedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	r.OTP.Status = fastotp.OTPStatus(status)
+	r.OTP.Type = fastotp.OTPType(otpType)
+	if err := json.Unmarshal([]byte(methods), &r.OTP.DeliveryMethods); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(details), &r.OTP.DeliveryDetails); err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		if r.Secret, err = base64.StdEncoding.DecodeString(secret); err != nil {
+			return nil, err
+		}
+	}
+	r.OTP.CreatedAt = fromUnixNano(createdAt)
+	r.OTP.UpdatedAt = fromUnixNano(updatedAt)
+	r.OTP.ExpiresAt = fromUnixNano(expiresAt)
+	return &r, nil
+}
+
+// unixNano stores the zero time as 0 rather than as an overflowed value.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
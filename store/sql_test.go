@@ -0,0 +1,20 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLStore_InvalidTable(t *testing.T) {
+	_, err := NewSQLStore(nil, WithTable("otps; DROP TABLE users"))
+	assert.Error(t, err)
+}
+
+func TestSQLStore_DollarPlaceholders(t *testing.T) {
+	s, err := NewSQLStore(nil, WithPlaceholder(Dollar))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id FROM fastotp_otps WHERE id = $1 AND version = $2",
+		s.query("SELECT id FROM {table} WHERE id = ? AND version = ?"))
+}
@@ -0,0 +1,55 @@
+//go:build sqlite
+
+// The SQLite tests pull in a large driver, so they only run with
+//
+//	go test -tags sqlite ./store
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", filepath.Join(t.TempDir(), "otps.db"))
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLStore(t *testing.T) {
+	for name, placeholder := range map[string]Placeholder{"Question": Question, "Dollar": Dollar} {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, func(t *testing.T) OTPStore {
+				s, err := NewSQLStore(openSQLite(t), WithPlaceholder(placeholder))
+				require.NoError(t, err)
+				require.NoError(t, s.Migrate(context.Background()))
+				return s
+			})
+		})
+	}
+}
+
+func TestSQLStore_MigrateTwice(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	s, err := NewSQLStore(db, WithTable("otps"))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Migrate(ctx))
+	require.NoError(t, s.Migrate(ctx))
+
+	var versions int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM otps_migrations`).Scan(&versions))
+	assert.Equal(t, len(migrations), versions)
+}
@@ -0,0 +1,94 @@
+// Package store persists OTPs for the parts of an application that need to
+// remember them, such as lockouts, caches, audit trails and local providers.
+//
+// MemoryStore keeps records in memory, FileStore in an append-only log file
+// and SQLStore in a database/sql database. All of them implement OTPStore.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+var (
+	// ErrNotFound is returned when no record matches.
+	ErrNotFound = errors.New("otp not found")
+	// ErrExists is returned by Put when a record with the same ID is stored.
+	ErrExists = errors.New("otp already exists")
+	// ErrConflict is returned by CompareAndSwap when the stored record was
+	// changed since it was read.
+	ErrConflict = errors.New("otp was modified concurrently")
+	// ErrInvalidRecord is returned by Put for a record without an OTP ID.
+	ErrInvalidRecord = errors.New("invalid otp record")
+)
+
+// Record is an OTP as kept by a store.
+type Record struct {
+	OTP fastotp.OTP
+	// Secret is opaque data kept with the OTP, such as a salted hash of its
+	// token.
+	Secret []byte
+	// Attempts counts the validation attempts made against the OTP.
+	Attempts int
+	// Version is set by the store and increases on every change. It is what
+	// CompareAndSwap compares.
+	Version int64
+}
+
+func (r *Record) clone() *Record {
+	c := *r
+	if r.OTP.DeliveryMethods != nil {
+		c.OTP.DeliveryMethods = append([]string(nil), r.OTP.DeliveryMethods...)
+	}
+	if r.OTP.DeliveryDetails.Statuses != nil {
+		c.OTP.DeliveryDetails.Statuses = make(map[string]fastotp.DeliveryStatus, len(r.OTP.DeliveryDetails.Statuses))
+		for channel, status := range r.OTP.DeliveryDetails.Statuses {
+			c.OTP.DeliveryDetails.Statuses[channel] = status
+		}
+	}
+	if r.Secret != nil {
+		c.Secret = append([]byte(nil), r.Secret...)
+	}
+	return &c
+}
+
+// OTPStore stores OTP records. Implementations are safe for concurrent use,
+// and return copies that callers may modify.
+type OTPStore interface {
+	// Put stores a new record and sets its Version.
+	Put(ctx context.Context, record *Record) error
+	// Get returns the record with the OTP ID id.
+	Get(ctx context.Context, id string) (*Record, error)
+	// GetByIdentifier returns the most recently created record for identifier.
+	GetByIdentifier(ctx context.Context, identifier string) (*Record, error)
+	// UpdateStatus sets the status of the record with the OTP ID id and
+	// returns the updated record.
+	UpdateStatus(ctx context.Context, id string, status fastotp.OTPStatus) (*Record, error)
+	// CompareAndSwap replaces the stored record with record if the stored
+	// Version still equals record.Version, and advances record.Version.
+	CompareAndSwap(ctx context.Context, record *Record) error
+	// DeleteExpired deletes the records that expired before t and returns
+	// how many there were.
+	DeleteExpired(ctx context.Context, t time.Time) (int, error)
+}
+
+// Sweep deletes expired records from s every interval until ctx is done.
+// Errors are passed to onError, which may be nil.
+func Sweep(ctx context.Context, s OTPStore, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.DeleteExpired(ctx, now); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
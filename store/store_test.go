@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecord(id, identifier string, createdAt time.Time) *Record {
+	return &Record{
+		OTP: fastotp.OTP{
+			ID:              id,
+			Identifier:      identifier,
+			Status:          fastotp.OTPStatusPending,
+			Type:            fastotp.OTPTypeNumeric,
+			DeliveryMethods: []string{"email"},
+			DeliveryDetails: fastotp.DeliveryDetails{Email: "user@example.com"},
+			CreatedAt:       createdAt,
+			UpdatedAt:       createdAt,
+			ExpiresAt:       createdAt.Add(5 * time.Minute),
+		},
+		Secret: []byte("salted-hash"),
+	}
+}
+
+// testStore runs the behaviour every OTPStore shares.
+func testStore(t *testing.T, newStore func(t *testing.T) OTPStore) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0).UTC()
+
+	t.Run("PutGet", func(t *testing.T) {
+		s := newStore(t)
+		record := newRecord("otp-1", "user", now)
+		require.NoError(t, s.Put(ctx, record))
+		assert.Equal(t, int64(1), record.Version)
+
+		got, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, record, got)
+
+		assert.ErrorIs(t, s.Put(ctx, newRecord("otp-1", "other", now)), ErrExists)
+		assert.ErrorIs(t, s.Put(ctx, newRecord("", "user", now)), ErrInvalidRecord)
+
+		_, err = s.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("GetReturnsCopy", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+
+		got, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		got.Secret[0] = 'X'
+		got.OTP.DeliveryMethods[0] = "sms"
+
+		again, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("salted-hash"), again.Secret)
+		assert.Equal(t, []string{"email"}, again.OTP.DeliveryMethods)
+	})
+
+	t.Run("GetByIdentifier", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+		require.NoError(t, s.Put(ctx, newRecord("otp-3", "user", now.Add(time.Second))))
+		require.NoError(t, s.Put(ctx, newRecord("otp-2", "other", now.Add(time.Minute))))
+
+		got, err := s.GetByIdentifier(ctx, "user")
+		require.NoError(t, err)
+		assert.Equal(t, "otp-3", got.OTP.ID)
+
+		_, err = s.GetByIdentifier(ctx, "nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("UpdateStatus", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+
+		got, err := s.UpdateStatus(ctx, "otp-1", fastotp.OTPStatusValidated)
+		require.NoError(t, err)
+		assert.Equal(t, fastotp.OTPStatusValidated, got.OTP.Status)
+		assert.Equal(t, int64(2), got.Version)
+		assert.True(t, got.OTP.UpdatedAt.After(now))
+
+		_, err = s.UpdateStatus(ctx, "missing", fastotp.OTPStatusValidated)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+
+		first, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		second, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+
+		first.Attempts++
+		require.NoError(t, s.CompareAndSwap(ctx, first))
+		assert.Equal(t, int64(2), first.Version)
+
+		second.Attempts++
+		assert.ErrorIs(t, s.CompareAndSwap(ctx, second), ErrConflict)
+
+		got, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, got.Attempts)
+
+		missing := newRecord("missing", "user", now)
+		assert.ErrorIs(t, s.CompareAndSwap(ctx, missing), ErrNotFound)
+	})
+
+	t.Run("CompareAndSwapConcurrent", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+
+		var wg sync.WaitGroup
+		var increments int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					for {
+						record, err := s.Get(ctx, "otp-1")
+						if !assert.NoError(t, err) {
+							return
+						}
+						record.Attempts++
+						if err := s.CompareAndSwap(ctx, record); err == nil {
+							atomic.AddInt32(&increments, 1)
+							break
+						} else if !assert.ErrorIs(t, err, ErrConflict) {
+							return
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		got, err := s.Get(ctx, "otp-1")
+		require.NoError(t, err)
+		assert.Equal(t, int(increments), got.Attempts)
+		assert.Equal(t, 40, got.Attempts)
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("old", "user", now)))
+		require.NoError(t, s.Put(ctx, newRecord("new", "user", now.Add(time.Hour))))
+		forever := newRecord("forever", "user", now)
+		forever.OTP.ExpiresAt = time.Time{}
+		require.NoError(t, s.Put(ctx, forever))
+
+		n, err := s.DeleteExpired(ctx, now.Add(30*time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		_, err = s.Get(ctx, "old")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Get(ctx, "new")
+		assert.NoError(t, err)
+		_, err = s.Get(ctx, "forever")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Put(ctx, newRecord("otp-1", "user", now)))
+		require.NoError(t, s.Put(ctx, newRecord("otp-2", "user", now.Add(time.Minute))))
+		require.NoError(t, s.Put(ctx, newRecord("otp-3", "other", now)))
+
+		eraser, ok := s.(fastotp.Eraser)
+		require.True(t, ok)
+		require.NoError(t, eraser.Erase(ctx, "user"))
+		require.NoError(t, eraser.Erase(ctx, "nobody"))
+
+		_, err := s.GetByIdentifier(ctx, "user")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Get(ctx, "otp-2")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = s.Get(ctx, "otp-3")
+		assert.NoError(t, err)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) OTPStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, func(t *testing.T) OTPStore {
+		s, err := OpenFileStore(filepath.Join(t.TempDir(), "otps.log"))
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestSweep(t *testing.T) {
+	s := NewMemoryStore()
+	record := newRecord("otp-1", "user", time.Now().Add(-time.Hour))
+	require.NoError(t, s.Put(context.Background(), record))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Sweep(ctx, s, time.Millisecond, nil)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,142 @@
+package fastotp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const transactionIdentifierPrefix = "txn:"
+
+var (
+	// ErrInvalidTransaction is returned when a Transaction cannot be
+	// canonicalised.
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	// ErrTransactionMismatch is returned when a validated OTP was issued for a
+	// different transaction.
+	ErrTransactionMismatch = errors.New("otp was issued for a different transaction")
+)
+
+// Transaction is the payment an OTP approves. Binding an OTP to it means a
+// code approved for one transaction cannot approve a modified one.
+type Transaction struct {
+	// Amount is a non-negative decimal such as "1250.00".
+	Amount string
+	// Currency is an ISO 4217 code such as "NGN".
+	Currency string
+	Payee    string
+	// Nonce distinguishes otherwise identical transactions.
+	Nonce string
+}
+
+// TransactionBinder derives OTP identifiers from transactions with an HMAC
+// key that must be kept secret.
+type TransactionBinder struct {
+	key []byte
+}
+
+// NewTransactionBinder creates a new TransactionBinder using key.
+func NewTransactionBinder(key []byte) *TransactionBinder {
+	return &TransactionBinder{key: append([]byte(nil), key...)}
+}
+
+// Identifier derives the OTP identifier binding subject, usually the user
+// approving the payment, to txn.
+func (b *TransactionBinder) Identifier(subject string, txn Transaction) (string, error) {
+	canonical, err := txn.canonical(subject)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write(canonical)
+	return transactionIdentifierPrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// canonical encodes the transaction so that equivalent transactions, such as
+// amounts "10.5" and "10.50", encode identically and no field can bleed into
+// the next one.
+func (t Transaction) canonical(subject string) ([]byte, error) {
+	amount, err := canonicalAmount(t.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(t.Currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return nil, fmt.Errorf("%w: currency %q", ErrInvalidTransaction, t.Currency)
+	}
+
+	payee := strings.TrimSpace(t.Payee)
+	if payee == "" {
+		return nil, fmt.Errorf("%w: missing payee", ErrInvalidTransaction)
+	}
+	if t.Nonce == "" {
+		return nil, fmt.Errorf("%w: missing nonce", ErrInvalidTransaction)
+	}
+
+	var b strings.Builder
+	for _, field := range []string{"v1", subject, amount, currency, payee, t.Nonce} {
+		b.WriteString(strconv.Itoa(len(field)))
+		b.WriteByte(':')
+		b.WriteString(field)
+	}
+	return []byte(b.String()), nil
+}
+
+func canonicalAmount(amount string) (string, error) {
+	amount = strings.TrimSpace(amount)
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if whole == "" || strings.Trim(whole, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return "", fmt.Errorf("%w: amount %q", ErrInvalidTransaction, amount)
+	}
+
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if fraction == "" {
+		return whole, nil
+	}
+	return whole + "." + fraction, nil
+}
+
+// GenerateTransactionOTP generates an OTP bound to txn. The identifier of
+// payload is replaced by the one derived by binder; the other fields are
+// sent as given.
+func (f *FastOTP) GenerateTransactionOTP(ctx context.Context, binder *TransactionBinder, subject string, txn Transaction, payload GenerateOTPPayload) (*OTP, error) {
+	identifier, err := binder.Identifier(subject, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.Identifier = identifier
+	return f.GenerateOTP(ctx, payload)
+}
+
+// ValidateTransactionOTP validates token for txn. It fails unless the OTP was
+// generated for exactly the same subject and transaction.
+func (f *FastOTP) ValidateTransactionOTP(ctx context.Context, binder *TransactionBinder, subject string, txn Transaction, token string) (*OTP, error) {
+	identifier, err := binder.Identifier(subject, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := f.ValidateOTP(ctx, ValidateOTPPayload{
+		Identifier: identifier,
+		Token:      token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(otp.Identifier), []byte(identifier)) {
+		return nil, ErrTransactionMismatch
+	}
+	return otp, nil
+}
@@ -0,0 +1,127 @@
+package fastotp
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/stretchr/testify.v1/require"
+)
+
+var testTransaction = Transaction{
+	Amount:   "1250.50",
+	Currency: "NGN",
+	Payee:    "ACME Stores",
+	Nonce:    "b7c1d2",
+}
+
+func TestTransactionBinder_Identifier(t *testing.T) {
+	binder := NewTransactionBinder([]byte("secret"))
+
+	identifier, err := binder.Identifier("user123", testTransaction)
+	require.NoError(t, err)
+	assert.Contains(t, identifier, "txn:")
+
+	equivalent := testTransaction
+	equivalent.Amount = "01250.5"
+	equivalent.Currency = " ngn"
+	same, err := binder.Identifier("user123", equivalent)
+	require.NoError(t, err)
+	assert.Equal(t, identifier, same)
+
+	tampered := map[string]func(*Transaction){
+		"amount":   func(txn *Transaction) { txn.Amount = "1250.51" },
+		"currency": func(txn *Transaction) { txn.Currency = "USD" },
+		"payee":    func(txn *Transaction) { txn.Payee = "ACME Store" },
+		"nonce":    func(txn *Transaction) { txn.Nonce = "b7c1d3" },
+	}
+	for name, tamper := range tampered {
+		txn := testTransaction
+		tamper(&txn)
+		other, err := binder.Identifier("user123", txn)
+		require.NoError(t, err)
+		assert.NotEqual(t, identifier, other, name)
+	}
+
+	other, err := binder.Identifier("user124", testTransaction)
+	require.NoError(t, err)
+	assert.NotEqual(t, identifier, other, "subject")
+
+	other, err = NewTransactionBinder([]byte("other secret")).Identifier("user123", testTransaction)
+	require.NoError(t, err)
+	assert.NotEqual(t, identifier, other, "key")
+
+	// fields cannot be shifted into each other
+	a, err := binder.Identifier("user1", Transaction{Amount: "1", Currency: "NGN", Payee: "23", Nonce: "n"})
+	require.NoError(t, err)
+	b, err := binder.Identifier("user1", Transaction{Amount: "1", Currency: "NGN", Payee: "2", Nonce: "3n"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestTransactionBinder_InvalidTransaction(t *testing.T) {
+	binder := NewTransactionBinder([]byte("secret"))
+
+	for _, txn := range []Transaction{
+		{Amount: "-1", Currency: "NGN", Payee: "ACME", Nonce: "n"},
+		{Amount: "1e3", Currency: "NGN", Payee: "ACME", Nonce: "n"},
+		{Amount: "", Currency: "NGN", Payee: "ACME", Nonce: "n"},
+		{Amount: "10", Currency: "NAIRA", Payee: "ACME", Nonce: "n"},
+		{Amount: "10", Currency: "NGN", Payee: " ", Nonce: "n"},
+		{Amount: "10", Currency: "NGN", Payee: "ACME"},
+	} {
+		_, err := binder.Identifier("user123", txn)
+		assert.ErrorIs(t, err, ErrInvalidTransaction, txn)
+	}
+}
+
+func TestTransactionOTP(t *testing.T) {
+	// the mocked API only validates a token for the identifier it was issued to
+	issued := map[string]string{}
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			if endpoint == "/generate" {
+				p := payload.(GenerateOTPPayload)
+				issued[p.Identifier] = "123456"
+				return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier, Status: OTPStatusPending}})
+			}
+			p := payload.(ValidateOTPPayload)
+			if token, ok := issued[p.Identifier]; !ok || token != p.Token {
+				return httpmock.NewJsonResponse(http.StatusBadRequest, ErrorResponse{Message: "invalid token"})
+			}
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: p.Identifier, Status: OTPStatusValidated}})
+		},
+	}))
+	binder := NewTransactionBinder([]byte("secret"))
+
+	_, err := fastOtp.GenerateTransactionOTP(context.TODO(), binder, "user123", testTransaction, GenerateOTPPayload{
+		Delivery:    OTPDelivery{"email": "test@example.com"},
+		Identifier:  "ignored",
+		TokenLength: 6,
+		Type:        OTPTypeNumeric,
+		Validity:    120,
+	})
+	require.NoError(t, err)
+
+	tampered := testTransaction
+	tampered.Payee = "Mallory"
+	_, err = fastOtp.ValidateTransactionOTP(context.TODO(), binder, "user123", tampered, "123456")
+	require.Error(t, err)
+
+	otp, err := fastOtp.ValidateTransactionOTP(context.TODO(), binder, "user123", testTransaction, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, OTPStatusValidated, otp.Status)
+}
+
+func TestValidateTransactionOTP_Mismatch(t *testing.T) {
+	fastOtp := NewFastOTP(mockAPIKey, WithHTTPClient(mockedHTTPClient{
+		PostFunc: func(ctx context.Context, endpoint string, payload interface{}) (*http.Response, error) {
+			return httpmock.NewJsonResponse(http.StatusOK, OTPResponse{OTP: OTP{Identifier: "txn:other", Status: OTPStatusValidated}})
+		},
+	}))
+
+	_, err := fastOtp.ValidateTransactionOTP(context.TODO(), NewTransactionBinder([]byte("secret")), "user123", testTransaction, "123456")
+	assert.ErrorIs(t, err, ErrTransactionMismatch)
+}
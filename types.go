@@ -7,6 +7,9 @@ type (
 
 	// OTPStatus status of otp
 	OTPStatus string
+
+	// DeliveryState state of a delivery on one channel
+	DeliveryState string
 )
 
 const (
@@ -22,6 +25,13 @@ const (
 	OTPStatusPending OTPStatus = "pending"
 	// OTPStatusValidated validated otp status
 	OTPStatusValidated OTPStatus = "validated"
+	// OTPStatusCancelled otp cancelled with CancelOTP
+	OTPStatusCancelled OTPStatus = "cancelled"
+
+	// DeliveryStateSent the code was handed to the channel
+	DeliveryStateSent DeliveryState = "sent"
+	// DeliveryStateFailed every attempt to send the code failed
+	DeliveryStateFailed DeliveryState = "failed"
 )
 
 // String returns the string value of OTPType
@@ -32,3 +42,7 @@ func (o OTPType) String() string {
 func (o OTPStatus) String() string {
 	return string(o)
 }
+
+func (d DeliveryState) String() string {
+	return string(d)
+}
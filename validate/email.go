@@ -0,0 +1,135 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	// ErrInvalidEmail is returned for an email address that is not
+	// syntactically valid.
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrNoMailServer is returned when the domain of an email address does
+	// not accept mail.
+	ErrNoMailServer = errors.New("domain does not accept mail")
+)
+
+// MXResolver looks up mail exchangers. *net.Resolver implements it.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// MXResolverFunc adapts a function to an MXResolver.
+type MXResolverFunc func(ctx context.Context, name string) ([]*net.MX, error)
+
+// LookupMX calls f(ctx, name).
+func (f MXResolverFunc) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return f(ctx, name)
+}
+
+// HostResolver looks up the addresses of a host. An MXResolver that also
+// implements it, as *net.Resolver does, lets domains without MX records
+// receive mail at their own address (RFC 5321 §5.1).
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// atext holds the characters RFC 5322 allows in a dot-atom besides letters
+// and digits.
+const atext = "!#$%&'*+-/=?^_`{|}~"
+
+// NormalizeEmail checks the syntax of address and returns it with its
+// domain in lower case ASCII, converting internationalised domain names to
+// punycode: "Ana@Bücher.Example" becomes "Ana@xn--bcher-kva.example". The
+// local part is kept as is, since mail servers may treat it case
+// sensitively. Quoted local parts and address literals are rejected.
+func NormalizeEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return "", fmt.Errorf("%w: missing @", ErrInvalidEmail)
+	}
+	local, domain := address[:at], address[at+1:]
+
+	if err := checkLocalPart(local); err != nil {
+		return "", err
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: domain %q: %v", ErrInvalidEmail, domain, err)
+	}
+	ascii = strings.ToLower(ascii)
+	if !strings.Contains(ascii, ".") || len(ascii) > 253 {
+		return "", fmt.Errorf("%w: domain %q", ErrInvalidEmail, domain)
+	}
+	if len(local)+1+len(ascii) > 254 {
+		return "", fmt.Errorf("%w: too long", ErrInvalidEmail)
+	}
+	return local + "@" + ascii, nil
+}
+
+// checkLocalPart accepts a dot-atom, allowing UTF-8 as RFC 6531 does.
+func checkLocalPart(local string) error {
+	if local == "" || len(local) > 64 {
+		return fmt.Errorf("%w: local part must be 1 to 64 bytes long", ErrInvalidEmail)
+	}
+	if strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return fmt.Errorf("%w: misplaced dot in local part", ErrInvalidEmail)
+	}
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+		case r < 0x80 && strings.ContainsRune(atext, r):
+		case r >= 0x80:
+		default:
+			return fmt.Errorf("%w: unexpected %q in local part", ErrInvalidEmail, r)
+		}
+	}
+	return nil
+}
+
+// checkMX reports ErrNoMailServer if the domain of a normalised address
+// has no mail exchanger, or publishes a null MX (RFC 7505). A domain without
+// MX records still accepts mail at its A or AAAA record when resolver is a
+// HostResolver; other resolvers reject it. Lookup failures other than a
+// missing domain are returned as is, so callers may choose to let the
+// address through.
+func checkMX(ctx context.Context, resolver MXResolver, address string) error {
+	domain := address[strings.LastIndexByte(address, '@')+1:]
+	records, err := resolver.LookupMX(ctx, domain)
+	if isNotFound(err) || (err == nil && len(records) == 0) {
+		return checkImplicitMX(ctx, resolver, domain)
+	}
+	if err != nil {
+		return err
+	}
+	if len(records) == 1 && strings.TrimSuffix(records[0].Host, ".") == "" {
+		return fmt.Errorf("%w: %s", ErrNoMailServer, domain)
+	}
+	return nil
+}
+
+// checkImplicitMX looks up the address records of a domain without MX
+// records, which mail is then delivered to.
+func checkImplicitMX(ctx context.Context, resolver MXResolver, domain string) error {
+	hosts, ok := resolver.(HostResolver)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoMailServer, domain)
+	}
+	addrs, err := hosts.LookupHost(ctx, domain)
+	if isNotFound(err) || (err == nil && len(addrs) == 0) {
+		return fmt.Errorf("%w: %s", ErrNoMailServer, domain)
+	}
+	return err
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,104 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		address, want string
+	}{
+		{"user@example.com", "user@example.com"},
+		{" User.Name+tag@Example.COM ", "User.Name+tag@example.com"},
+		{"ana@bücher.example", "ana@xn--bcher-kva.example"},
+		{"josé@example.com", "josé@example.com"},
+		{"o'brien@sub.example.co.uk", "o'brien@sub.example.co.uk"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.address)
+		if assert.NoError(t, err, tt.address) {
+			assert.Equal(t, tt.want, got, tt.address)
+		}
+	}
+
+	for _, address := range []string{
+		"",
+		"user",
+		"@example.com",
+		"user@",
+		"user@localhost",
+		".user@example.com",
+		"us..er@example.com",
+		"us er@example.com",
+		`"quoted"@example.com`,
+		"user@exa mple.com",
+		"user@[192.0.2.1]",
+	} {
+		_, err := NormalizeEmail(address)
+		assert.ErrorIs(t, err, ErrInvalidEmail, address)
+	}
+}
+
+func TestCheckMX(t *testing.T) {
+	ctx := context.Background()
+	resolver := MXResolverFunc(func(ctx context.Context, name string) ([]*net.MX, error) {
+		switch name {
+		case "example.com":
+			return []*net.MX{{Host: "mx.example.com.", Pref: 10}}, nil
+		case "null.example":
+			return []*net.MX{{Host: ".", Pref: 0}}, nil
+		case "slow.example":
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	})
+
+	assert.NoError(t, checkMX(ctx, resolver, "user@example.com"))
+	assert.ErrorIs(t, checkMX(ctx, resolver, "user@null.example"), ErrNoMailServer)
+	assert.ErrorIs(t, checkMX(ctx, resolver, "user@missing.example"), ErrNoMailServer)
+
+	var dnsErr *net.DNSError
+	err := checkMX(ctx, resolver, "user@slow.example")
+	assert.True(t, errors.As(err, &dnsErr))
+	assert.NotErrorIs(t, err, ErrNoMailServer)
+}
+
+var _ HostResolver = (*net.Resolver)(nil)
+
+// hostResolver answers host lookups from hosts.
+type hostResolver struct {
+	MXResolverFunc
+	hosts map[string][]string
+}
+
+func (r hostResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestCheckMX_ImplicitMX(t *testing.T) {
+	ctx := context.Background()
+	resolver := hostResolver{
+		MXResolverFunc: func(ctx context.Context, name string) ([]*net.MX, error) {
+			if name == "null.example" {
+				return []*net.MX{{Host: ".", Pref: 0}}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		},
+		hosts: map[string][]string{
+			"a.example":    {"192.0.2.1"},
+			"null.example": {"192.0.2.2"},
+		},
+	}
+
+	assert.NoError(t, checkMX(ctx, resolver, "user@a.example"))
+	assert.ErrorIs(t, checkMX(ctx, resolver, "user@null.example"), ErrNoMailServer)
+	assert.ErrorIs(t, checkMX(ctx, resolver, "user@missing.example"), ErrNoMailServer)
+}
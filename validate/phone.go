@@ -0,0 +1,188 @@
+package validate
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPhone is returned for a phone number that cannot be
+	// normalised.
+	ErrInvalidPhone = errors.New("invalid phone number")
+	// ErrUnknownRegion is returned for a region or calling code missing from
+	// the country table.
+	ErrUnknownRegion = errors.New("unknown region")
+)
+
+// Country is the numbering plan of a region, as found in the embedded
+// country table.
+type Country struct {
+	// Region is the ISO 3166-1 alpha-2 code, such as "NG".
+	Region string
+	// CallingCode is the country calling code without "+", such as "234".
+	CallingCode string
+	// InternationalPrefix is dialled before a calling code from the region,
+	// such as "00".
+	InternationalPrefix string
+	// TrunkPrefix is dialled before national numbers within the region,
+	// such as "0". It is empty where numbers are dialled as is.
+	TrunkPrefix string
+	// MinLength and MaxLength bound the length of national significant
+	// numbers, which exclude the trunk prefix.
+	MinLength, MaxLength int
+}
+
+//go:embed countries.csv
+var countriesCSV string
+
+var (
+	byRegion      = make(map[string]Country)
+	byCallingCode = make(map[string][]Country)
+)
+
+func init() {
+	r := csv.NewReader(strings.NewReader(countriesCSV))
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("validate: reading country table: %v", err))
+	}
+	for _, record := range records {
+		c := Country{
+			Region:              record[0],
+			CallingCode:         record[1],
+			InternationalPrefix: record[2],
+			TrunkPrefix:         record[3],
+		}
+		if c.MinLength, err = strconv.Atoi(record[4]); err == nil {
+			c.MaxLength, err = strconv.Atoi(record[5])
+		}
+		if err != nil {
+			panic(fmt.Sprintf("validate: country table: %s: %v", c.Region, err))
+		}
+		byRegion[c.Region] = c
+		byCallingCode[c.CallingCode] = append(byCallingCode[c.CallingCode], c)
+	}
+}
+
+// LookupRegion returns the numbering plan of region, an ISO 3166-1 alpha-2
+// code.
+func LookupRegion(region string) (Country, bool) {
+	c, ok := byRegion[strings.ToUpper(region)]
+	return c, ok
+}
+
+// LookupNumber returns the numbering plan of the calling code e164 starts
+// with. Where regions share a calling code, as in North America, it returns
+// the main one.
+func LookupNumber(e164 string) (Country, bool) {
+	digits := strings.TrimPrefix(e164, "+")
+	// calling codes are prefix free, and one to three digits long
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if countries, ok := byCallingCode[digits[:n]]; ok {
+			return countries[0], true
+		}
+	}
+	return Country{}, false
+}
+
+// NormalizePhone returns number in E.164 format, such as "+2348012345678".
+// Numbers without a "+" or an international prefix are read as national
+// numbers of defaultRegion, which may be empty if all numbers are
+// international. Spaces, dots, dashes and parentheses are ignored.
+func NormalizePhone(number, defaultRegion string) (string, error) {
+	digits, international, err := phoneDigits(number)
+	if err != nil {
+		return "", err
+	}
+
+	var home Country
+	if defaultRegion != "" {
+		var ok bool
+		if home, ok = LookupRegion(defaultRegion); !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownRegion, defaultRegion)
+		}
+	}
+
+	if !international {
+		switch {
+		case home.InternationalPrefix != "" && strings.HasPrefix(digits, home.InternationalPrefix):
+			digits, international = digits[len(home.InternationalPrefix):], true
+		case strings.HasPrefix(digits, "00"):
+			digits, international = digits[2:], true
+		}
+	}
+
+	if international {
+		return normalizeInternational(digits)
+	}
+	if home.Region == "" {
+		return "", fmt.Errorf("%w: %s has no country calling code", ErrInvalidPhone, number)
+	}
+	national, ok := nationalNumber(home, digits)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not a valid %s number", ErrInvalidPhone, number, home.Region)
+	}
+	return "+" + home.CallingCode + national, nil
+}
+
+// phoneDigits strips the punctuation from number, and reports whether it
+// started with "+".
+func phoneDigits(number string) (string, bool, error) {
+	number = strings.TrimSpace(number)
+	international := strings.HasPrefix(number, "+")
+	if international {
+		number = number[1:]
+	}
+
+	var b strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return "", false, fmt.Errorf("%w: unexpected %q", ErrInvalidPhone, r)
+		}
+	}
+	if b.Len() == 0 {
+		return "", false, fmt.Errorf("%w: no digits", ErrInvalidPhone)
+	}
+	return b.String(), international, nil
+}
+
+func normalizeInternational(digits string) (string, error) {
+	for n := 1; n <= 3 && n < len(digits); n++ {
+		countries, ok := byCallingCode[digits[:n]]
+		if !ok {
+			continue
+		}
+		for _, c := range countries {
+			if national, ok := nationalNumber(c, digits[n:]); ok {
+				return "+" + c.CallingCode + national, nil
+			}
+		}
+		return "", fmt.Errorf("%w: +%s is not a valid %s number", ErrInvalidPhone, digits, countries[0].Region)
+	}
+	return "", fmt.Errorf("%w: +%s", ErrUnknownRegion, digits)
+}
+
+// nationalNumber returns the national significant number of digits in c,
+// dropping a trunk prefix that was dialled or, as in "+44 (0)20", written
+// after the calling code.
+func nationalNumber(c Country, digits string) (string, bool) {
+	if c.TrunkPrefix != "" && strings.HasPrefix(digits, c.TrunkPrefix) {
+		if trimmed := digits[len(c.TrunkPrefix):]; c.fits(trimmed) {
+			return trimmed, true
+		}
+	}
+	return digits, c.fits(digits)
+}
+
+func (c Country) fits(national string) bool {
+	return len(national) >= c.MinLength && len(national) <= c.MaxLength
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		number, region, want string
+	}{
+		{"+234 801 234 5678", "", "+2348012345678"},
+		{"08012345678", "NG", "+2348012345678"},
+		{"0801-234-5678", "ng", "+2348012345678"},
+		{"009 234 801 234 5678", "NG", "+2348012345678"},
+		{"00 234 801 234 5678", "", "+2348012345678"},
+		{"+44 (0)20 7946 0958", "", "+442079460958"},
+		{"020 7946 0958", "GB", "+442079460958"},
+		{"(212) 555-0123", "US", "+12125550123"},
+		{"1 212 555 0123", "US", "+12125550123"},
+		{"011 44 20 7946 0958", "US", "+442079460958"},
+		{"+1 416 555 0123", "GB", "+14165550123"},
+		{"06 1 234 5678", "HU", "+3612345678"},
+		{"+49 30 1234567", "", "+49301234567"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.number, tt.region)
+		if assert.NoError(t, err, tt.number) {
+			assert.Equal(t, tt.want, got, tt.number)
+		}
+	}
+}
+
+func TestNormalizePhone_Invalid(t *testing.T) {
+	tests := []struct {
+		number, region string
+		err            error
+	}{
+		{"08012345678", "", ErrInvalidPhone},
+		{"+234 801", "", ErrInvalidPhone},
+		{"0801234567890123", "NG", ErrInvalidPhone},
+		{"+234 801 CALL ME", "", ErrInvalidPhone},
+		{"", "NG", ErrInvalidPhone},
+		{"+999 1234 5678", "", ErrUnknownRegion},
+		{"08012345678", "XX", ErrUnknownRegion},
+	}
+	for _, tt := range tests {
+		_, err := NormalizePhone(tt.number, tt.region)
+		assert.ErrorIs(t, err, tt.err, tt.number)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, ok := LookupRegion("ng")
+	require.True(t, ok)
+	assert.Equal(t, "234", c.CallingCode)
+	assert.Equal(t, "0", c.TrunkPrefix)
+
+	c, ok = LookupNumber("+14165550123")
+	require.True(t, ok)
+	assert.Equal(t, "US", c.Region)
+
+	c, ok = LookupNumber("+442079460958")
+	require.True(t, ok)
+	assert.Equal(t, "GB", c.Region)
+
+	_, ok = LookupNumber("+999")
+	assert.False(t, ok)
+}
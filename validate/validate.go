@@ -0,0 +1,154 @@
+// Package validate normalises and checks the delivery targets of OTPs:
+// phone numbers are rewritten to E.164 using an embedded table of country
+// numbering plans, and email addresses are checked for syntax, converted to
+// ASCII domains and optionally checked for mail servers.
+//
+// A Validator plugs into fastotp.WithPayloadValidator, so that bad targets
+// are reported as field errors before a request reaches the API.
+package validate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	fastotp "github.com/CeoFred/fast-otp"
+)
+
+// Validator checks the delivery targets of GenerateOTPPayloads.
+type Validator struct {
+	defaultRegion string
+	resolver      MXResolver
+	emailChannels ChannelSet
+	phoneChannels ChannelSet
+}
+
+// Option configures a Validator.
+type Option func(*Validator)
+
+// WithDefaultRegion reads phone numbers without a country calling code as
+// national numbers of region, an ISO 3166-1 alpha-2 code such as "NG".
+func WithDefaultRegion(region string) Option {
+	return func(v *Validator) {
+		v.defaultRegion = region
+	}
+}
+
+// WithMXResolver rejects email addresses whose domain has no mail server,
+// as reported by resolver. A domain without MX records is only accepted
+// when resolver is also a HostResolver and finds its address. Lookups
+// failing for other reasons, such as a timeout, let the address through.
+func WithMXResolver(resolver MXResolver) Option {
+	return func(v *Validator) {
+		v.resolver = resolver
+	}
+}
+
+// WithEmailChannels sets the delivery channels whose targets are email
+// addresses. Defaults to "email".
+func WithEmailChannels(channels ...string) Option {
+	return func(v *Validator) {
+		v.emailChannels = NewChannelSet(channels...)
+	}
+}
+
+// WithPhoneChannels sets the delivery channels whose targets are phone
+// numbers. Defaults to "sms", "whatsapp" and "voice".
+func WithPhoneChannels(channels ...string) Option {
+	return func(v *Validator) {
+		v.phoneChannels = NewChannelSet(channels...)
+	}
+}
+
+// ChannelSet is a set of delivery channel names, such as "email" or "sms".
+type ChannelSet map[string]bool
+
+// NewChannelSet returns the set of channels.
+func NewChannelSet(channels ...string) ChannelSet {
+	s := make(ChannelSet, len(channels))
+	for _, channel := range channels {
+		s[channel] = true
+	}
+	return s
+}
+
+// DefaultEmailChannels returns the channels whose targets are email
+// addresses unless configured otherwise: "email".
+func DefaultEmailChannels() ChannelSet {
+	return NewChannelSet("email")
+}
+
+// DefaultPhoneChannels returns the channels whose targets are phone numbers
+// unless configured otherwise: "sms", "whatsapp" and "voice".
+func DefaultPhoneChannels() ChannelSet {
+	return NewChannelSet("sms", "whatsapp", "voice")
+}
+
+// New creates a new Validator.
+func New(opts ...Option) *Validator {
+	v := &Validator{
+		emailChannels: DefaultEmailChannels(),
+		phoneChannels: DefaultPhoneChannels(),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Phone returns number in E.164 format.
+func (v *Validator) Phone(number string) (string, error) {
+	return NormalizePhone(number, v.defaultRegion)
+}
+
+// Email returns address normalised, after checking its domain accepts mail
+// if an MX resolver is set.
+func (v *Validator) Email(ctx context.Context, address string) (string, error) {
+	normalized, err := NormalizeEmail(address)
+	if err != nil {
+		return "", err
+	}
+	if v.resolver != nil {
+		if err := checkMX(ctx, v.resolver, normalized); errors.Is(err, ErrNoMailServer) {
+			return "", err
+		}
+	}
+	return normalized, nil
+}
+
+// ValidatePayload implements fastotp.PayloadValidator. It rewrites the
+// email and phone targets of payload.Delivery to their normal form, and
+// reports those it cannot normalise under "delivery.<channel>". Targets of
+// other channels are left alone.
+func (v *Validator) ValidatePayload(ctx context.Context, payload *fastotp.GenerateOTPPayload) error {
+	errs := map[string][]string{}
+	for channel, target := range payload.Delivery {
+		field := "delivery." + channel
+		switch {
+		case v.emailChannels[channel]:
+			normalized, err := v.Email(ctx, target)
+			switch {
+			case errors.Is(err, ErrNoMailServer):
+				errs[field] = []string{"The email domain does not accept mail."}
+			case err != nil:
+				errs[field] = []string{"The email must be a valid email address."}
+			default:
+				payload.Delivery[channel] = normalized
+			}
+		case v.phoneChannels[channel]:
+			normalized, err := v.Phone(target)
+			switch {
+			case errors.Is(err, ErrUnknownRegion):
+				errs[field] = []string{"The phone number's country is not supported."}
+			case err != nil:
+				errs[field] = []string{"The phone number must be a valid phone number, including its country code."}
+			default:
+				payload.Delivery[channel] = normalized
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &fastotp.APIError{StatusCode: http.StatusUnprocessableEntity, Message: "The given data was invalid.", Errors: errs}
+	}
+	return nil
+}
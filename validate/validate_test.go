@@ -0,0 +1,76 @@
+package validate
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	fastotp "github.com/CeoFred/fast-otp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ fastotp.PayloadValidator = (*Validator)(nil)
+
+func TestValidator_ValidatePayload(t *testing.T) {
+	ctx := context.Background()
+	v := New(
+		WithDefaultRegion("NG"),
+		WithMXResolver(MXResolverFunc(func(ctx context.Context, name string) ([]*net.MX, error) {
+			if name == "example.com" {
+				return []*net.MX{{Host: "mx.example.com."}}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		})),
+	)
+
+	payload := &fastotp.GenerateOTPPayload{Delivery: fastotp.OTPDelivery{
+		"email": "User@EXAMPLE.com",
+		"sms":   "0801 234 5678",
+		"push":  "device-token",
+	}}
+	require.NoError(t, v.ValidatePayload(ctx, payload))
+	assert.Equal(t, fastotp.OTPDelivery{
+		"email": "User@example.com",
+		"sms":   "+2348012345678",
+		"push":  "device-token",
+	}, payload.Delivery)
+
+	payload = &fastotp.GenerateOTPPayload{Delivery: fastotp.OTPDelivery{
+		"email":    "user@nowhere.example",
+		"sms":      "12345",
+		"whatsapp": "+999 1234 5678",
+	}}
+	err := v.ValidatePayload(ctx, payload)
+	apiErr, ok := fastotp.AsAPIError(err)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, map[string][]string{
+		"delivery.email":    {"The email domain does not accept mail."},
+		"delivery.sms":      {"The phone number must be a valid phone number, including its country code."},
+		"delivery.whatsapp": {"The phone number's country is not supported."},
+	}, apiErr.Errors)
+}
+
+func TestValidator_Channels(t *testing.T) {
+	v := New(WithEmailChannels("mail"), WithPhoneChannels("text"))
+	payload := &fastotp.GenerateOTPPayload{Delivery: fastotp.OTPDelivery{
+		"mail":  "USER@EXAMPLE.COM",
+		"text":  "+2348012345678",
+		"email": "not an email",
+	}}
+	require.NoError(t, v.ValidatePayload(context.Background(), payload))
+	assert.Equal(t, "USER@example.com", payload.Delivery["mail"])
+	assert.Equal(t, "not an email", payload.Delivery["email"])
+}
+
+func TestDefaultChannels(t *testing.T) {
+	assert.Equal(t, ChannelSet{"email": true}, DefaultEmailChannels())
+	assert.Equal(t, ChannelSet{"sms": true, "whatsapp": true, "voice": true}, DefaultPhoneChannels())
+
+	// each call returns a new set, so callers cannot change the defaults
+	DefaultEmailChannels()["mail"] = true
+	assert.False(t, DefaultEmailChannels()["mail"])
+}